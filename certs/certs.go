@@ -0,0 +1,194 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"moksarab/config"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// loadedCertificate is the certificate served over HTTPS, either the supplied one or one issued by the generated CA.
+var loadedCertificate tls.Certificate
+
+// caPem is the PEM of the generated CA, to be trusted by the clients. It is empty when the certificate is supplied.
+var caPem []byte
+
+// mu guards loadedCertificate and caPem, which the workspace listeners may load concurrently.
+var mu sync.Mutex
+
+// LoadCertificate loads the supplied certificate, or generates a CA and a certificate issued by it for config.TlsHosts.
+func LoadCertificate() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return loadCertificate()
+}
+
+// Certificate returns the certificate served over HTTPS, it is empty until loaded.
+func Certificate() tls.Certificate {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return loadedCertificate
+}
+
+// GeneratedCaPem returns the PEM of the generated CA, it is empty when the certificate is supplied or not loaded yet.
+func GeneratedCaPem() []byte {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return caPem
+}
+
+func loadCertificate() error {
+	if config.TlsCertFile != "" || config.TlsKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+		if err != nil {
+			return fmt.Errorf("could not load TLS_CERT_FILE and TLS_KEY_FILE: %w", err)
+		}
+		loadedCertificate = certificate
+		caPem = nil
+		return nil
+	}
+
+	caCertificate, caKey, caDer, err := generateCa()
+	if err != nil {
+		return fmt.Errorf("could not generate the CA: %w", err)
+	}
+	certificate, err := issueCertificate(caCertificate, caKey, caDer, config.TlsHosts)
+	if err != nil {
+		return fmt.Errorf("could not issue the certificate: %w", err)
+	}
+	loadedCertificate = certificate
+	caPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer})
+	log.Infof("Generated a CA and a certificate for %s", strings.Join(config.TlsHosts, ", "))
+	return nil
+}
+
+// ServerConfig is the TLS config of the HTTPS port, which verifies the client certificates when TLS_CLIENT_CA_FILE is set.
+func ServerConfig() (*tls.Config, error) {
+	certificate := Certificate()
+	if config.TlsClientCaFile == "" {
+		return listenerConfig(certificate, nil, false)
+	}
+	clientCaPem, err := os.ReadFile(config.TlsClientCaFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read TLS_CLIENT_CA_FILE: %w", err)
+	}
+	return listenerConfig(certificate, clientCaPem, config.TlsClientCertOptional)
+}
+
+// ListenerConfig is the TLS config of a workspace listener, which requires client certificates issued by clientCaPem when given.
+// The certificate is loaded first if HTTPS is not enabled.
+func ListenerConfig(clientCaPem string) (*tls.Config, error) {
+	mu.Lock()
+	if len(loadedCertificate.Certificate) == 0 {
+		if err := loadCertificate(); err != nil {
+			mu.Unlock()
+			return nil, err
+		}
+	}
+	certificate := loadedCertificate
+	mu.Unlock()
+
+	return listenerConfig(certificate, []byte(clientCaPem), false)
+}
+
+func listenerConfig(certificate tls.Certificate, clientCaPem []byte, clientCertOptional bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(clientCaPem) == 0 {
+		return tlsConfig, nil
+	}
+
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(clientCaPem) {
+		return nil, fmt.Errorf("the client CA has no PEM certificate")
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if clientCertOptional {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+func generateCa() (*x509.Certificate, *ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"MokSarab"}, CommonName: "MokSarab Local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	return certificate, key, der, err
+}
+
+func issueCertificate(ca *x509.Certificate, caKey *ecdsa.PrivateKey, caDer []byte, hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{Organization: []string{"MokSarab"}, CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der, caDer}, PrivateKey: key}, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -1,6 +1,13 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
 
 var WorkspaceEnabled = os.Getenv("WORKSPACE_ENABLED") == "true"
 
@@ -11,3 +18,66 @@ var Port = func() string {
 	}
 	return "8080"
 }()
+
+// PostgresDsn selects the PostgreSQL storage backend instead of SQLite when set
+var PostgresDsn = os.Getenv("POSTGRES_DSN")
+
+// AdminApiKey is the bootstrap admin API key, the /api endpoints require an API key only when it is set
+var AdminApiKey = os.Getenv("ADMIN_API_KEY")
+
+// MemoryStorage keeps everything in memory instead of a database
+var MemoryStorage = os.Getenv("STORAGE_MODE") == "memory"
+
+// SnapshotPath is where the memory storage is persisted to and reloaded from, nothing is persisted when empty
+var SnapshotPath = os.Getenv("SNAPSHOT_PATH")
+
+// SnapshotInterval is how often the memory storage is persisted, besides on shutdown
+var SnapshotInterval = func() time.Duration {
+	interval := os.Getenv("SNAPSHOT_INTERVAL")
+	if interval == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		log.Fatalf("SNAPSHOT_INTERVAL must be a duration like 30s or 5m: %v", err)
+	}
+	return duration
+}()
+
+// TlsPort is the HTTPS port, served alongside Port with the same routes, HTTPS is disabled when empty
+var TlsPort = os.Getenv("TLS_PORT")
+
+// TlsCertFile and TlsKeyFile are the PEM certificate and key served over HTTPS, a local CA and a certificate issued by it are generated when empty
+var TlsCertFile = os.Getenv("TLS_CERT_FILE")
+var TlsKeyFile = os.Getenv("TLS_KEY_FILE")
+
+// TlsHosts are the hostnames and IPs of the generated certificate
+var TlsHosts = func() []string {
+	hosts := os.Getenv("TLS_HOSTS")
+	if hosts == "" {
+		return []string{"localhost", "127.0.0.1", "::1"}
+	}
+	return strings.Split(hosts, ",")
+}()
+
+// TlsClientCaFile is the PEM of the CAs the client certificates must be issued by, the HTTPS port requires mTLS when set
+var TlsClientCaFile = os.Getenv("TLS_CLIENT_CA_FILE")
+
+// TlsClientCertOptional only verifies the client certificates that are given, instead of requiring one on every HTTPS request
+var TlsClientCertOptional = os.Getenv("TLS_CLIENT_AUTH") == "optional"
+
+// GrpcPort is the port of the gRPC mocks, gRPC is disabled when empty
+var GrpcPort = os.Getenv("GRPC_PORT")
+
+// JournalSize is how many of the latest requests, gRPC calls, and WebSocket frames are kept in the journal of each workspace
+var JournalSize = func() int {
+	size := os.Getenv("JOURNAL_SIZE")
+	if size == "" {
+		return 1000
+	}
+	journalSize, err := strconv.Atoi(size)
+	if err != nil || journalSize < 0 {
+		log.Fatalf("JOURNAL_SIZE must be a positive number: %v", size)
+	}
+	return journalSize
+}()
@@ -2,20 +2,113 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"moksarab/config"
 	"moksarab/models"
 	"strings"
 
 	"github.com/gofiber/fiber/v2/log"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var Db *sql.DB
 
 func InitilizeDatabase() {
 
-	if config.DbPath == "" {
+	if config.MemoryStorage {
+		initilizeMemoryStorage()
+		return
+	}
+
+	dialect := getDialect()
+	db := openDatabase(dialect)
+
+	log.Debug("Initilizing database schema")
+	if err := applyMigrations(db, dialect); err != nil {
+		log.Fatalf("Could not migrate schema: %v", err)
+	}
+
+	if !config.WorkspaceEnabled {
+		_, insertError := db.Exec(dialect.rebind("INSERT INTO workspace (id, name, slug, type, description) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"),
+			4269,
+			"default",
+			"default",
+			models.MockWorkspace,
+			"Default workspace since workspace feature is disabled!",
+		)
+		if insertError != nil {
+			log.Fatalf("Could not create default workspace while since workspace feature is disabled: %v", insertError)
+		}
+	}
+
+	Db = db
+	Store = &sqlStorage{db: db, dialect: dialect}
+}
+
+func initilizeMemoryStorage() {
+
+	log.Debugf("Using in-memory storage (STORAGE_MODE=memory, SNAPSHOT_PATH=%s)", config.SnapshotPath)
+	store, err := openMemoryStorage(config.SnapshotPath, config.SnapshotInterval)
+	if err != nil {
+		log.Fatalf("Could not open memory storage: %v", err)
+	}
+
+	if !config.WorkspaceEnabled {
+		store.insertWorkspaceIfMissing(models.Workspace{
+			Id:          4269,
+			Name:        "default",
+			Slug:        "default",
+			Type:        models.MockWorkspace,
+			Description: "Default workspace since workspace feature is disabled!",
+		})
+	}
+
+	Db = nil
+	Store = store
+}
+
+// PrintPendingMigrations prints the migrations that InitilizeDatabase would apply, without applying them.
+func PrintPendingMigrations() {
+
+	if config.MemoryStorage {
+		fmt.Println("The memory storage has no schema, so there are no migrations")
+		return
+	}
+
+	dialect := getDialect()
+	db := openDatabase(dialect)
+	defer db.Close()
+
+	currentVersion, err := getSchemaVersion(db, dialect)
+	if err != nil {
+		log.Fatalf("Could not read schema version: %v", err)
+	}
+
+	pending := getPendingMigrations(currentVersion, dialect)
+	fmt.Printf("Current %s schema version: %d, latest known version: %d\n", dialect.name, currentVersion, latestSchemaVersion(dialect))
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations")
+	}
+	for _, migration := range pending {
+		fmt.Printf("  %03d %s\n", migration.Version, migration.Description)
+	}
+}
+
+func getDialect() *dialect {
+	if config.PostgresDsn != "" {
+		return postgresDialect
+	}
+	return sqliteDialect
+}
+
+func openDatabase(dialect *dialect) *sql.DB {
+
+	dataSourceName := config.DbPath
+	if dialect == postgresDialect {
+		dataSourceName = config.PostgresDsn
+		log.Debug("Opening postgres database (POSTGRES_DSN is set)")
+	} else if config.DbPath == "" {
 		config.DbPath = ":memory:"
+		dataSourceName = config.DbPath
 		log.Debug("Opening sqlite in-memory database (default, SQLITE_DB_PATH not set)")
 	} else if strings.Contains(config.DbPath, ":memory:") {
 		log.Debugf("Opening sqlite in-memory database (SQLITE_DB_PATH=%s)", config.DbPath)
@@ -23,33 +116,85 @@ func InitilizeDatabase() {
 		log.Debugf("Opening sqlite database at path: %s", config.DbPath)
 	}
 
-	db, err := sql.Open("sqlite3", config.DbPath)
+	db, err := sql.Open(dialect.driverName, dataSourceName)
 	if err != nil {
-		log.Fatalf("Could not open sqlite database: %v", err)
+		log.Fatalf("Could not open %s database: %v", dialect.name, err)
+	}
+	if dialect == sqliteDialect && strings.Contains(config.DbPath, ":memory:") {
+		// every connection to an in-memory database gets its own empty database
+		db.SetMaxOpenConns(1)
 	}
+	return db
+}
+
+func applyMigrations(db *sql.DB, dialect *dialect) error {
+
+	if _, err := db.Exec(models.CreateSchemaVersionTableQuery); err != nil {
+		return err
+	}
+	currentVersion, err := getSchemaVersion(db, dialect)
+	if err != nil {
+		return err
+	}
+	if currentVersion > latestSchemaVersion(dialect) {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d, refusing to start", currentVersion, latestSchemaVersion(dialect))
+	}
+
+	for _, migration := range getPendingMigrations(currentVersion, dialect) {
+		log.Infof("Applying migration %03d: %s", migration.Version, migration.Description)
+		if err := applyMigration(db, dialect, migration); err != nil {
+			return fmt.Errorf("migration %03d failed: %w", migration.Version, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, dialect *dialect, migration models.Migration) error {
 
-	log.Debug("Initilizing database schema")
 	transaction, err := db.Begin()
 	if err != nil {
-		log.Fatalf("Could not Begin a database transaction during initilization: %v", err)
+		return err
+	}
+	defer transaction.Rollback()
+
+	if migration.Apply != nil {
+		err = migration.Apply(transaction, dialect.rebind)
+	} else {
+		_, err = transaction.Exec(migration.Query)
+	}
+	if err != nil {
+		return err
 	}
-	_, err = transaction.Exec(models.CreateQueries)
+
+	_, err = transaction.Exec(dialect.rebind("INSERT INTO schema_version (version, description) VALUES (?, ?)"), migration.Version, migration.Description)
 	if err != nil {
-		log.Fatalf("Could not create schema: %v", err)
+		return err
 	}
+	return transaction.Commit()
+}
 
-	if !config.WorkspaceEnabled {
-		_, insertError := transaction.Exec("INSERT INTO workspace (id, name, description) VALUES (?, ?, ?)",
-			4269,
-			"default",
-			"Default workspace since workspace feature is disabled!",
-		)
-		if insertError != nil {
-			log.Fatalf("Could not create default workspace while since workspace feature is disabled: %v", insertError)
-		}
+func getSchemaVersion(db *sql.DB, dialect *dialect) (int, error) {
+
+	var tables int
+	if err := db.QueryRow(dialect.schemaVersionExistsQuery).Scan(&tables); err != nil || tables == 0 {
+		return 0, err
 	}
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
 
-	transaction.Commit()
+func getPendingMigrations(currentVersion int, dialect *dialect) []models.Migration {
 
-	Db = db
+	var pending []models.Migration
+	for _, migration := range dialect.migrations {
+		if migration.Version > currentVersion {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+func latestSchemaVersion(dialect *dialect) int {
+	return dialect.migrations[len(dialect.migrations)-1].Version
 }
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"moksarab/models"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect holds what differs between the SQL backends, queries are written with `?` placeholders and rebound when needed.
+type dialect struct {
+	name                     string
+	driverName               string
+	migrations               []models.Migration
+	schemaVersionExistsQuery string
+	numberedPlaceholders     bool
+	translateDriverError     func(err error) error
+}
+
+var sqliteDialect = &dialect{
+	name:                     "sqlite",
+	driverName:               "sqlite3",
+	migrations:               models.Migrations,
+	schemaVersionExistsQuery: "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'",
+	translateDriverError: func(err error) error {
+		var sqliteError sqlite3.Error
+		if errors.As(err, &sqliteError) {
+			switch sqliteError.ExtendedCode {
+			case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+				return fmt.Errorf("%w: %v", ErrConflict, err)
+			case sqlite3.ErrConstraintNotNull:
+				return fmt.Errorf("%w: %v", ErrNotNull, err)
+			}
+		}
+		return err
+	},
+}
+
+var postgresDialect = &dialect{
+	name:                     "postgres",
+	driverName:               "pgx",
+	migrations:               models.PostgresMigrations,
+	schemaVersionExistsQuery: "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_version'",
+	numberedPlaceholders:     true,
+	translateDriverError: func(err error) error {
+		var postgresError *pgconn.PgError
+		if errors.As(err, &postgresError) {
+			switch postgresError.Code {
+			case "23505":
+				return fmt.Errorf("%w: %v", ErrConflict, err)
+			case "23502":
+				return fmt.Errorf("%w: %v", ErrNotNull, err)
+			}
+		}
+		return err
+	},
+}
+
+// rebind replaces the `?` placeholders with `$1`, `$2`, ... for the dialects that need it,
+// leaving the `?` of the string literals and quoted identifiers as they are.
+func (d *dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+	var rebound strings.Builder
+	placeholder := 0
+	var quote rune
+	for _, char := range query {
+		switch {
+		case quote != 0:
+			// a doubled quote escapes itself, it closes then reopens the literal
+			if char == quote {
+				quote = 0
+			}
+			rebound.WriteRune(char)
+		case char == '\'' || char == '"':
+			quote = char
+			rebound.WriteRune(char)
+		case char == '?':
+			placeholder++
+			rebound.WriteString("$" + strconv.Itoa(placeholder))
+		default:
+			rebound.WriteRune(char)
+		}
+	}
+	return rebound.String()
+}
+
+func (d *dialect) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return d.translateDriverError(err)
+}
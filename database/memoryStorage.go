@@ -0,0 +1,1269 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"moksarab/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// memoryStorage keeps everything in plain Go maps, and optionally persists them to a snapshot file
+// periodically and on Close, which is reloaded on start.
+type memoryStorage struct {
+	mu               sync.RWMutex
+	workspaces       map[int64]models.Workspace
+	routes           map[int64]models.Route
+	routeResponses   map[int64]models.RouteResponse
+	apiKeys          map[int64]models.ApiKey
+	hosts            map[string]int64
+	oidcProviders    map[int64]models.OidcProvider
+	graphqlMocks     map[int64]models.GraphqlMock
+	graphqlSchemas   map[int64]models.GraphqlSchema
+	websocketMocks   map[int64]models.WebsocketMock
+	grpcMocks        map[int64]models.GrpcMock
+	grpcSchemas      map[int64]models.GrpcSchema
+	openapiDocuments map[int64]models.OpenapiDocument
+	soapMocks        map[int64]models.SoapMock
+	callbacks        map[int64]models.Callback
+	resources        map[int64]models.Resource
+	resourceItems    map[int64][]models.ResourceItem
+	lastIds          memoryLastIds
+	changed          bool
+
+	snapshotPath string
+	stopSnapshot chan struct{}
+	snapshotDone sync.WaitGroup
+}
+
+type memoryLastIds struct {
+	Workspace     int64 `json:"workspace"`
+	Route         int64 `json:"route"`
+	RouteResponse int64 `json:"route_response"`
+	ApiKey        int64 `json:"api_key"`
+	GraphqlMock   int64 `json:"graphql_mock"`
+	WebsocketMock int64 `json:"websocket_mock"`
+	GrpcMock      int64 `json:"grpc_mock"`
+	SoapMock      int64 `json:"soap_mock"`
+	Callback      int64 `json:"callback"`
+	Resource      int64 `json:"resource"`
+}
+
+// memoryApiKey keeps the key hash in the snapshot, which models.ApiKey never marshals.
+type memoryApiKey struct {
+	models.ApiKey
+	KeyHash string `json:"key_hash"`
+}
+
+// memoryWorkspace keeps the access token hash in the snapshot, which models.Workspace never marshals.
+type memoryWorkspace struct {
+	models.Workspace
+	AccessTokenHash sql.NullString `json:"access_token_hash"`
+}
+
+// memoryOidcProvider keeps the signing key in the snapshot, which models.OidcProvider never marshals.
+type memoryOidcProvider struct {
+	models.OidcProvider
+	SigningKey string `json:"signing_key"`
+}
+
+// memorySnapshot is the content of the snapshot file.
+type memorySnapshot struct {
+	Workspaces       []memoryWorkspace        `json:"workspaces"`
+	Routes           []models.Route           `json:"routes"`
+	RouteResponses   []models.RouteResponse   `json:"route_responses"`
+	ApiKeys          []memoryApiKey           `json:"api_keys"`
+	Hosts            []models.WorkspaceHost   `json:"hosts"`
+	OidcProviders    []memoryOidcProvider     `json:"oidc_providers"`
+	GraphqlMocks     []models.GraphqlMock     `json:"graphql_mocks"`
+	GraphqlSchemas   []models.GraphqlSchema   `json:"graphql_schemas"`
+	WebsocketMocks   []models.WebsocketMock   `json:"websocket_mocks"`
+	GrpcMocks        []models.GrpcMock        `json:"grpc_mocks"`
+	GrpcSchemas      []models.GrpcSchema      `json:"grpc_schemas"`
+	OpenapiDocuments []models.OpenapiDocument `json:"openapi_documents"`
+	SoapMocks        []models.SoapMock        `json:"soap_mocks"`
+	Callbacks        []models.Callback        `json:"callbacks"`
+	Resources        []models.Resource        `json:"resources"`
+	ResourceItems    []models.ResourceItem    `json:"resource_items"`
+	LastIds          memoryLastIds            `json:"last_ids"`
+}
+
+func openMemoryStorage(snapshotPath string, snapshotInterval time.Duration) (*memoryStorage, error) {
+
+	s := &memoryStorage{
+		workspaces:       make(map[int64]models.Workspace),
+		routes:           make(map[int64]models.Route),
+		routeResponses:   make(map[int64]models.RouteResponse),
+		apiKeys:          make(map[int64]models.ApiKey),
+		hosts:            make(map[string]int64),
+		oidcProviders:    make(map[int64]models.OidcProvider),
+		graphqlMocks:     make(map[int64]models.GraphqlMock),
+		graphqlSchemas:   make(map[int64]models.GraphqlSchema),
+		websocketMocks:   make(map[int64]models.WebsocketMock),
+		grpcMocks:        make(map[int64]models.GrpcMock),
+		grpcSchemas:      make(map[int64]models.GrpcSchema),
+		openapiDocuments: make(map[int64]models.OpenapiDocument),
+		soapMocks:        make(map[int64]models.SoapMock),
+		callbacks:        make(map[int64]models.Callback),
+		resources:        make(map[int64]models.Resource),
+		resourceItems:    make(map[int64][]models.ResourceItem),
+		snapshotPath:     snapshotPath,
+		stopSnapshot:     make(chan struct{}),
+	}
+	if snapshotPath == "" {
+		return s, nil
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if snapshotInterval > 0 {
+		s.snapshotDone.Add(1)
+		go func() {
+			defer s.snapshotDone.Done()
+			ticker := time.NewTicker(snapshotInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := s.writeSnapshot(); err != nil {
+						log.Errorf("Could not write memory storage snapshot: %v", err)
+					}
+				case <-s.stopSnapshot:
+					return
+				}
+			}
+		}()
+	}
+	return s, nil
+}
+
+func (s *memoryStorage) loadSnapshot() error {
+
+	content, err := os.ReadFile(s.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Debugf("No memory storage snapshot at %s, starting empty", s.snapshotPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot %s: %w", s.snapshotPath, err)
+	}
+	for _, workspace := range snapshot.Workspaces {
+		workspace.Workspace.AccessTokenHash = workspace.AccessTokenHash
+		s.workspaces[workspace.Id] = workspace.Workspace
+	}
+	for _, route := range snapshot.Routes {
+		s.routes[route.Id] = route
+	}
+	for _, routeResponse := range snapshot.RouteResponses {
+		s.routeResponses[routeResponse.Id] = routeResponse
+	}
+	for _, apiKey := range snapshot.ApiKeys {
+		apiKey.ApiKey.KeyHash = apiKey.KeyHash
+		s.apiKeys[apiKey.Id] = apiKey.ApiKey
+	}
+	for _, host := range snapshot.Hosts {
+		s.hosts[host.Host] = host.Workspace
+	}
+	for _, provider := range snapshot.OidcProviders {
+		provider.OidcProvider.SigningKey = provider.SigningKey
+		s.oidcProviders[provider.Workspace] = provider.OidcProvider
+	}
+	for _, mock := range snapshot.GraphqlMocks {
+		s.graphqlMocks[mock.Id] = mock
+	}
+	for _, schema := range snapshot.GraphqlSchemas {
+		s.graphqlSchemas[schema.Workspace] = schema
+	}
+	for _, mock := range snapshot.WebsocketMocks {
+		s.websocketMocks[mock.Id] = mock
+	}
+	for _, mock := range snapshot.GrpcMocks {
+		s.grpcMocks[mock.Id] = mock
+	}
+	for _, schema := range snapshot.GrpcSchemas {
+		s.grpcSchemas[schema.Workspace] = schema
+	}
+	for _, document := range snapshot.OpenapiDocuments {
+		// the documents saved before the validation modes are lenient
+		if document.Validation == "" {
+			document.Validation = models.LenientValidation
+		}
+		s.openapiDocuments[document.Workspace] = document
+	}
+	for _, mock := range snapshot.SoapMocks {
+		s.soapMocks[mock.Id] = mock
+	}
+	for _, callback := range snapshot.Callbacks {
+		s.callbacks[callback.Id] = callback
+	}
+	for _, resource := range snapshot.Resources {
+		s.resources[resource.Id] = resource
+	}
+	for _, item := range snapshot.ResourceItems {
+		s.resourceItems[item.Resource] = append(s.resourceItems[item.Resource], item)
+	}
+	s.lastIds = snapshot.LastIds
+	log.Debugf("Loaded memory storage snapshot from %s", s.snapshotPath)
+	return nil
+}
+
+// writeSnapshot writes the snapshot to a temporary file first, so a crash while writing never leaves a partial snapshot behind.
+func (s *memoryStorage) writeSnapshot() error {
+
+	s.mu.Lock()
+	if !s.changed {
+		s.mu.Unlock()
+		return nil
+	}
+	snapshot := memorySnapshot{
+		Routes:           sortedById(s.routes, func(r models.Route) int64 { return r.Id }),
+		RouteResponses:   sortedById(s.routeResponses, func(rr models.RouteResponse) int64 { return rr.Id }),
+		GraphqlMocks:     sortedById(s.graphqlMocks, func(m models.GraphqlMock) int64 { return m.Id }),
+		GraphqlSchemas:   sortedById(s.graphqlSchemas, func(gs models.GraphqlSchema) int64 { return gs.Workspace }),
+		WebsocketMocks:   sortedById(s.websocketMocks, func(m models.WebsocketMock) int64 { return m.Id }),
+		GrpcMocks:        sortedById(s.grpcMocks, func(m models.GrpcMock) int64 { return m.Id }),
+		GrpcSchemas:      sortedById(s.grpcSchemas, func(gs models.GrpcSchema) int64 { return gs.Workspace }),
+		OpenapiDocuments: sortedById(s.openapiDocuments, func(d models.OpenapiDocument) int64 { return d.Workspace }),
+		SoapMocks:        sortedById(s.soapMocks, func(m models.SoapMock) int64 { return m.Id }),
+		Callbacks:        sortedById(s.callbacks, func(cb models.Callback) int64 { return cb.Id }),
+		Resources:        sortedById(s.resources, func(r models.Resource) int64 { return r.Id }),
+		LastIds:          s.lastIds,
+	}
+	for _, resource := range snapshot.Resources {
+		snapshot.ResourceItems = append(snapshot.ResourceItems, s.resourceItems[resource.Id]...)
+	}
+	for _, workspace := range sortedById(s.workspaces, func(w models.Workspace) int64 { return w.Id }) {
+		snapshot.Workspaces = append(snapshot.Workspaces, memoryWorkspace{Workspace: workspace, AccessTokenHash: workspace.AccessTokenHash})
+	}
+	for _, apiKey := range sortedById(s.apiKeys, func(k models.ApiKey) int64 { return k.Id }) {
+		snapshot.ApiKeys = append(snapshot.ApiKeys, memoryApiKey{ApiKey: apiKey, KeyHash: apiKey.KeyHash})
+	}
+	for _, host := range slices.Sorted(maps.Keys(s.hosts)) {
+		snapshot.Hosts = append(snapshot.Hosts, models.WorkspaceHost{Host: host, Workspace: s.hosts[host]})
+	}
+	for _, provider := range sortedById(s.oidcProviders, func(p models.OidcProvider) int64 { return p.Workspace }) {
+		snapshot.OidcProviders = append(snapshot.OidcProviders, memoryOidcProvider{OidcProvider: provider, SigningKey: provider.SigningKey})
+	}
+	s.changed = false
+	s.mu.Unlock()
+
+	content, err := json.Marshal(snapshot)
+	if err == nil {
+		temporaryPath := filepath.Join(filepath.Dir(s.snapshotPath), "."+filepath.Base(s.snapshotPath)+".tmp")
+		if err = os.WriteFile(temporaryPath, content, 0o644); err == nil {
+			err = os.Rename(temporaryPath, s.snapshotPath)
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.changed = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func sortedById[T any](byId map[int64]T, id func(T) int64) []T {
+	values := slices.Collect(maps.Values(byId))
+	slices.SortFunc(values, func(a, b T) int { return cmp.Compare(id(a), id(b)) })
+	return values
+}
+
+// insertWorkspaceIfMissing inserts a workspace with a fixed id, as the default workspace is.
+func (s *memoryStorage) insertWorkspaceIfMissing(workspace models.Workspace) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[workspace.Id]; found {
+		return
+	}
+	s.workspaces[workspace.Id] = workspace
+	s.lastIds.Workspace = max(s.lastIds.Workspace, workspace.Id)
+	s.changed = true
+}
+
+func (s *memoryStorage) CreateWorkspace(ctx context.Context, workspace models.Workspace) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.workspaces {
+		if existing.Name == workspace.Name || existing.Slug == workspace.Slug {
+			return 0, fmt.Errorf("%w: workspace.name or workspace.slug", ErrConflict)
+		}
+	}
+	s.lastIds.Workspace++
+	workspace.Id = s.lastIds.Workspace
+	workspace.Port = nil
+	s.workspaces[workspace.Id] = workspace
+	s.changed = true
+	return workspace.Id, nil
+}
+
+func (s *memoryStorage) GetWorkspaces(ctx context.Context, pageNumber int, pageSize int) ([]models.Workspace, int, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspaces := sortedById(s.workspaces, func(w models.Workspace) int64 { return w.Id })
+	start := min(pageNumber*pageSize, len(workspaces))
+	end := min(start+pageSize, len(workspaces))
+	if start == end {
+		return nil, len(workspaces), nil
+	}
+	return workspaces[start:end], len(workspaces), nil
+}
+
+func (s *memoryStorage) GetWorkspace(ctx context.Context, id int64) (*models.Workspace, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, found := s.workspaces[id]
+	if !found {
+		return nil, nil
+	}
+	return &workspace, nil
+}
+
+func (s *memoryStorage) GetWorkspaceBySlug(ctx context.Context, slug string) (*models.Workspace, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, workspace := range s.workspaces {
+		if workspace.Slug == slug {
+			return &workspace, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStorage) UpdateWorkspaceSlug(ctx context.Context, id int64, slug string) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace, found := s.workspaces[id]
+	if !found {
+		return false, nil
+	}
+	for _, existing := range s.workspaces {
+		if existing.Id != id && existing.Slug == slug {
+			return false, fmt.Errorf("%w: workspace.slug", ErrConflict)
+		}
+	}
+	workspace.Slug = slug
+	s.workspaces[id] = workspace
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) SetWorkspaceAccessTokenHash(ctx context.Context, id int64, accessTokenHash sql.NullString) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace, found := s.workspaces[id]
+	if !found {
+		return false, nil
+	}
+	workspace.AccessTokenHash = accessTokenHash
+	s.workspaces[id] = workspace
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) SetWorkspacePort(ctx context.Context, settings models.Workspace) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace, found := s.workspaces[settings.Id]
+	if !found {
+		return false, nil
+	}
+	for _, existing := range s.workspaces {
+		if settings.Port != nil && existing.Id != settings.Id && existing.Port != nil && *existing.Port == *settings.Port {
+			return false, fmt.Errorf("%w: workspace.port", ErrConflict)
+		}
+	}
+	workspace.Port = settings.Port
+	workspace.PortTls = settings.PortTls
+	workspace.PortClientCa = settings.PortClientCa
+	s.workspaces[workspace.Id] = workspace
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) GetWorkspacesWithPort(ctx context.Context) ([]models.Workspace, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var workspaces []models.Workspace
+	for _, workspace := range sortedById(s.workspaces, func(w models.Workspace) int64 { return w.Id }) {
+		if workspace.Port != nil {
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	return workspaces, nil
+}
+
+func (s *memoryStorage) GetOidcProvider(ctx context.Context, workspaceId int64) (*models.OidcProvider, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	provider, found := s.oidcProviders[workspaceId]
+	if !found {
+		return nil, nil
+	}
+	return &provider, nil
+}
+
+func (s *memoryStorage) SaveOidcProvider(ctx context.Context, provider models.OidcProvider) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[provider.Workspace]; !found {
+		return fmt.Errorf("workspace %d does not exist", provider.Workspace)
+	}
+	s.oidcProviders[provider.Workspace] = provider
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) CreateGraphqlMock(ctx context.Context, mock models.GraphqlMock) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[mock.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", mock.Workspace)
+	}
+	variables, err := mock.Variables.Value()
+	if err != nil {
+		return 0, err
+	}
+	for _, existing := range s.graphqlMocks {
+		existingVariables, _ := existing.Variables.Value()
+		if existing.Workspace == mock.Workspace && existing.Path == mock.Path && existing.OperationType == mock.OperationType &&
+			existing.OperationName == mock.OperationName && existingVariables == variables {
+			return 0, fmt.Errorf("%w: graphql_mock.workspace, graphql_mock.path, graphql_mock.operation_type, graphql_mock.operation_name, graphql_mock.variables", ErrConflict)
+		}
+	}
+	s.lastIds.GraphqlMock++
+	mock.Id = s.lastIds.GraphqlMock
+	s.graphqlMocks[mock.Id] = mock
+	s.changed = true
+	return mock.Id, nil
+}
+
+func (s *memoryStorage) GetGraphqlMocks(ctx context.Context, workspaceId int64) ([]models.GraphqlMock, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mocks := []models.GraphqlMock{}
+	for _, mock := range sortedById(s.graphqlMocks, func(m models.GraphqlMock) int64 { return m.Id }) {
+		if mock.Workspace == workspaceId {
+			mocks = append(mocks, mock)
+		}
+	}
+	return mocks, nil
+}
+
+func (s *memoryStorage) DeleteGraphqlMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mock, found := s.graphqlMocks[id]; !found || mock.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.graphqlMocks, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) GetGraphqlSchema(ctx context.Context, workspaceId int64) (*models.GraphqlSchema, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, found := s.graphqlSchemas[workspaceId]
+	if !found {
+		return nil, nil
+	}
+	return &schema, nil
+}
+
+func (s *memoryStorage) SaveGraphqlSchema(ctx context.Context, schema models.GraphqlSchema) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[schema.Workspace]; !found {
+		return fmt.Errorf("workspace %d does not exist", schema.Workspace)
+	}
+	s.graphqlSchemas[schema.Workspace] = schema
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) DeleteGraphqlSchema(ctx context.Context, workspaceId int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.graphqlSchemas[workspaceId]; !found {
+		return false, nil
+	}
+	delete(s.graphqlSchemas, workspaceId)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateWebsocketMock(ctx context.Context, mock models.WebsocketMock) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[mock.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", mock.Workspace)
+	}
+	for _, existing := range s.websocketMocks {
+		if existing.Workspace == mock.Workspace && existing.Path == mock.Path {
+			return 0, fmt.Errorf("%w: websocket_mock.workspace, websocket_mock.path", ErrConflict)
+		}
+	}
+	s.lastIds.WebsocketMock++
+	mock.Id = s.lastIds.WebsocketMock
+	s.websocketMocks[mock.Id] = mock
+	s.changed = true
+	return mock.Id, nil
+}
+
+func (s *memoryStorage) GetWebsocketMocks(ctx context.Context, workspaceId int64) ([]models.WebsocketMock, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mocks := []models.WebsocketMock{}
+	for _, mock := range sortedById(s.websocketMocks, func(m models.WebsocketMock) int64 { return m.Id }) {
+		if mock.Workspace == workspaceId {
+			mocks = append(mocks, mock)
+		}
+	}
+	return mocks, nil
+}
+
+func (s *memoryStorage) DeleteWebsocketMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mock, found := s.websocketMocks[id]; !found || mock.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.websocketMocks, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateGrpcMock(ctx context.Context, mock models.GrpcMock) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[mock.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", mock.Workspace)
+	}
+	match, err := mock.Match.Value()
+	if err != nil {
+		return 0, err
+	}
+	for _, existing := range s.grpcMocks {
+		existingMatch, _ := existing.Match.Value()
+		if existing.Workspace == mock.Workspace && existing.Service == mock.Service && existing.Method == mock.Method && existingMatch == match {
+			return 0, fmt.Errorf("%w: grpc_mock.workspace, grpc_mock.service, grpc_mock.method, grpc_mock.match_fields", ErrConflict)
+		}
+	}
+	s.lastIds.GrpcMock++
+	mock.Id = s.lastIds.GrpcMock
+	s.grpcMocks[mock.Id] = mock
+	s.changed = true
+	return mock.Id, nil
+}
+
+func (s *memoryStorage) GetGrpcMocks(ctx context.Context, workspaceId int64) ([]models.GrpcMock, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mocks := []models.GrpcMock{}
+	for _, mock := range sortedById(s.grpcMocks, func(m models.GrpcMock) int64 { return m.Id }) {
+		if mock.Workspace == workspaceId {
+			mocks = append(mocks, mock)
+		}
+	}
+	return mocks, nil
+}
+
+func (s *memoryStorage) DeleteGrpcMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mock, found := s.grpcMocks[id]; !found || mock.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.grpcMocks, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) GetGrpcSchema(ctx context.Context, workspaceId int64) (*models.GrpcSchema, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, found := s.grpcSchemas[workspaceId]
+	if !found {
+		return nil, nil
+	}
+	return &schema, nil
+}
+
+func (s *memoryStorage) SaveGrpcSchema(ctx context.Context, schema models.GrpcSchema) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[schema.Workspace]; !found {
+		return fmt.Errorf("workspace %d does not exist", schema.Workspace)
+	}
+	s.grpcSchemas[schema.Workspace] = schema
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) DeleteGrpcSchema(ctx context.Context, workspaceId int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.grpcSchemas[workspaceId]; !found {
+		return false, nil
+	}
+	delete(s.grpcSchemas, workspaceId)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) GetOpenapiDocument(ctx context.Context, workspaceId int64) (*models.OpenapiDocument, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	document, found := s.openapiDocuments[workspaceId]
+	if !found {
+		return nil, nil
+	}
+	return &document, nil
+}
+
+func (s *memoryStorage) SaveOpenapiDocument(ctx context.Context, document models.OpenapiDocument) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[document.Workspace]; !found {
+		return fmt.Errorf("workspace %d does not exist", document.Workspace)
+	}
+	s.openapiDocuments[document.Workspace] = document
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) DeleteOpenapiDocument(ctx context.Context, workspaceId int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.openapiDocuments[workspaceId]; !found {
+		return false, nil
+	}
+	delete(s.openapiDocuments, workspaceId)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateSoapMock(ctx context.Context, mock models.SoapMock) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[mock.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", mock.Workspace)
+	}
+	xpaths, err := mock.XPaths.Value()
+	if err != nil {
+		return 0, err
+	}
+	for _, existing := range s.soapMocks {
+		existingXPaths, _ := existing.XPaths.Value()
+		if existing.Workspace == mock.Workspace && existing.Path == mock.Path && existing.Action == mock.Action && existingXPaths == xpaths {
+			return 0, fmt.Errorf("%w: soap_mock.workspace, soap_mock.path, soap_mock.action, soap_mock.xpaths", ErrConflict)
+		}
+	}
+	s.lastIds.SoapMock++
+	mock.Id = s.lastIds.SoapMock
+	s.soapMocks[mock.Id] = mock
+	s.changed = true
+	return mock.Id, nil
+}
+
+func (s *memoryStorage) ReplaceSoapMocks(ctx context.Context, workspaceId int64, mocks []models.SoapMock) ([]int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[workspaceId]; !found {
+		return nil, fmt.Errorf("workspace %d does not exist", workspaceId)
+	}
+	replaced := make(map[[2]string]bool)
+	for _, mock := range mocks {
+		replaced[[2]string{mock.Path, mock.Action}] = true
+	}
+	// the kept mocks, and the new ones, must not clash like the UNIQUE constraint of soap_mock
+	seen := make(map[[3]string]bool)
+	for _, existing := range s.soapMocks {
+		if existing.Workspace == workspaceId && !(existing.Imported && replaced[[2]string{existing.Path, existing.Action}]) {
+			xpaths, _ := existing.XPaths.Value()
+			seen[[3]string{existing.Path, existing.Action, fmt.Sprint(xpaths)}] = true
+		}
+	}
+	for _, mock := range mocks {
+		xpaths, err := mock.XPaths.Value()
+		if err != nil {
+			return nil, err
+		}
+		key := [3]string{mock.Path, mock.Action, fmt.Sprint(xpaths)}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: soap_mock.workspace, soap_mock.path, soap_mock.action, soap_mock.xpaths", ErrConflict)
+		}
+		seen[key] = true
+	}
+	for id, existing := range s.soapMocks {
+		if existing.Workspace == workspaceId && existing.Imported && replaced[[2]string{existing.Path, existing.Action}] {
+			delete(s.soapMocks, id)
+		}
+	}
+	ids := make([]int64, len(mocks))
+	for i, mock := range mocks {
+		s.lastIds.SoapMock++
+		mock.Id, mock.Workspace, mock.Imported = s.lastIds.SoapMock, workspaceId, true
+		s.soapMocks[mock.Id] = mock
+		ids[i] = mock.Id
+	}
+	s.changed = true
+	return ids, nil
+}
+
+func (s *memoryStorage) GetSoapMocks(ctx context.Context, workspaceId int64) ([]models.SoapMock, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mocks := []models.SoapMock{}
+	for _, mock := range sortedById(s.soapMocks, func(m models.SoapMock) int64 { return m.Id }) {
+		if mock.Workspace == workspaceId {
+			mocks = append(mocks, mock)
+		}
+	}
+	return mocks, nil
+}
+
+func (s *memoryStorage) DeleteSoapMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mock, found := s.soapMocks[id]; !found || mock.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.soapMocks, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateCallback(ctx context.Context, callback models.Callback) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[callback.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", callback.Workspace)
+	}
+	s.lastIds.Callback++
+	callback.Id = s.lastIds.Callback
+	s.callbacks[callback.Id] = callback
+	s.changed = true
+	return callback.Id, nil
+}
+
+func (s *memoryStorage) GetCallbacks(ctx context.Context, workspaceId int64) ([]models.Callback, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	callbacks := []models.Callback{}
+	for _, callback := range sortedById(s.callbacks, func(cb models.Callback) int64 { return cb.Id }) {
+		if callback.Workspace == workspaceId {
+			callbacks = append(callbacks, callback)
+		}
+	}
+	return callbacks, nil
+}
+
+func (s *memoryStorage) DeleteCallback(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if callback, found := s.callbacks[id]; !found || callback.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.callbacks, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateResource(ctx context.Context, resource models.Resource) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.workspaces[resource.Workspace]; !found {
+		return 0, fmt.Errorf("workspace %d does not exist", resource.Workspace)
+	}
+	for _, existing := range s.resources {
+		if existing.Workspace == resource.Workspace && existing.Path == resource.Path {
+			return 0, fmt.Errorf("%w: resource.workspace, resource.path", ErrConflict)
+		}
+	}
+	s.lastIds.Resource++
+	resource.Id = s.lastIds.Resource
+	s.resources[resource.Id] = resource
+	s.changed = true
+	return resource.Id, nil
+}
+
+func (s *memoryStorage) GetResources(ctx context.Context, workspaceId int64) ([]models.Resource, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resources := []models.Resource{}
+	for _, resource := range sortedById(s.resources, func(r models.Resource) int64 { return r.Id }) {
+		if resource.Workspace == workspaceId {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+func (s *memoryStorage) DeleteResource(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if resource, found := s.resources[id]; !found || resource.Workspace != workspaceId {
+		return false, nil
+	}
+	delete(s.resources, id)
+	delete(s.resourceItems, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) GetResourceItems(ctx context.Context, resourceId int64) ([]models.ResourceItem, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.ResourceItem{}, s.resourceItems[resourceId]...), nil
+}
+
+func (s *memoryStorage) CreateResourceItem(ctx context.Context, item models.ResourceItem) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.resourceItems[item.Resource], func(existing models.ResourceItem) bool { return existing.ItemId == item.ItemId }) {
+		return fmt.Errorf("%w: resource_item.resource, resource_item.item_id", ErrConflict)
+	}
+	s.resourceItems[item.Resource] = append(s.resourceItems[item.Resource], item)
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) UpdateResourceItem(ctx context.Context, item models.ResourceItem) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.resourceItems[item.Resource]
+	i := slices.IndexFunc(items, func(existing models.ResourceItem) bool { return existing.ItemId == item.ItemId })
+	if i < 0 {
+		return false, nil
+	}
+	items[i] = item
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) DeleteResourceItem(ctx context.Context, resourceId int64, itemId string) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.resourceItems[resourceId]
+	i := slices.IndexFunc(items, func(existing models.ResourceItem) bool { return existing.ItemId == itemId })
+	if i < 0 {
+		return false, nil
+	}
+	s.resourceItems[resourceId] = slices.Delete(items, i, i+1)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) ResetResourceItems(ctx context.Context, resourceId int64, items []models.ResourceItem) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resourceItems[resourceId] = slices.Clone(items)
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) AddWorkspaceHost(ctx context.Context, host models.WorkspaceHost) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.hosts[host.Host]; found {
+		return fmt.Errorf("%w: workspace_host.host", ErrConflict)
+	}
+	s.hosts[host.Host] = host.Workspace
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) GetWorkspaceHosts(ctx context.Context, workspaceId int64) ([]models.WorkspaceHost, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hosts := []models.WorkspaceHost{}
+	for _, host := range slices.Sorted(maps.Keys(s.hosts)) {
+		if s.hosts[host] == workspaceId {
+			hosts = append(hosts, models.WorkspaceHost{Host: host, Workspace: workspaceId})
+		}
+	}
+	return hosts, nil
+}
+
+func (s *memoryStorage) GetWorkspaceByHost(ctx context.Context, host string) (*models.Workspace, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspaceId, found := s.hosts[host]
+	if !found {
+		return nil, nil
+	}
+	workspace, found := s.workspaces[workspaceId]
+	if !found {
+		return nil, nil
+	}
+	return &workspace, nil
+}
+
+func (s *memoryStorage) DeleteWorkspaceHost(ctx context.Context, host models.WorkspaceHost) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if workspaceId, found := s.hosts[host.Host]; !found || workspaceId != host.Workspace {
+		return false, nil
+	}
+	delete(s.hosts, host.Host)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) CreateMock(ctx context.Context, workspaceId int, segments []models.Route, response models.RouteResponse) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// find the already existing part of the chain first, so nothing is inserted when the mock already exists
+	var existingChain []models.Route
+	parentPath := sql.NullInt64{Valid: false}
+	for _, segment := range segments {
+		existing, found := s.findRoute(segment, parentPath, workspaceId)
+		if !found {
+			break
+		}
+		existingChain = append(existingChain, existing)
+		parentPath = sql.NullInt64{Int64: existing.Id, Valid: true}
+	}
+	if len(existingChain) == len(segments) {
+		matchers, err := response.Matchers.Value()
+		if err != nil {
+			return err
+		}
+		route := existingChain[len(existingChain)-1].Id
+		for _, existing := range s.routeResponses {
+			existingMatchers, _ := existing.Matchers.Value()
+			if existing.Path == route && existing.Method == response.Method && existing.PathParams == nil && existingMatchers == matchers {
+				return fmt.Errorf("%w: this response already exist", ErrConflict)
+			}
+		}
+	}
+
+	for i, segment := range segments {
+		isLastPart := (i + 1) == len(segments)
+		if i < len(existingChain) {
+			if isLastPart {
+				route := existingChain[i]
+				route.HasResponses = true
+				s.routes[route.Id] = route
+			}
+			continue
+		}
+		s.lastIds.Route++
+		segment.Id = s.lastIds.Route
+		segment.ParentPath = parentPath
+		segment.Workspace = int64(workspaceId)
+		segment.HasResponses = isLastPart
+		s.routes[segment.Id] = segment
+		parentPath = sql.NullInt64{Int64: segment.Id, Valid: true}
+	}
+
+	s.lastIds.RouteResponse++
+	response.Id = s.lastIds.RouteResponse
+	response.Path = parentPath.Int64
+	response.PathParams = nil
+	s.routeResponses[response.Id] = response
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) findRoute(segment models.Route, parentPath sql.NullInt64, workspaceId int) (models.Route, bool) {
+	for _, route := range s.routes {
+		if route.Path == segment.Path && route.Workspace == int64(workspaceId) && route.ParentPath == parentPath && route.ParamConstraint == segment.ParamConstraint {
+			return route, true
+		}
+	}
+	return models.Route{}, false
+}
+
+func (s *memoryStorage) GetMocks(ctx context.Context, workspaceId int) ([]models.Mock, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mocks []models.Mock
+	for _, routeResponse := range sortedById(s.routeResponses, func(rr models.RouteResponse) int64 { return rr.Id }) {
+		if route, found := s.routes[routeResponse.Path]; !found || route.Workspace != int64(workspaceId) {
+			continue
+		}
+		var fullPath strings.Builder
+		var paramNames []string
+		for _, route := range s.getChain(routeResponse.Path) {
+			fullPath.WriteString(route.Path)
+			if route.ParamName.Valid {
+				paramNames = append(paramNames, route.ParamName.String)
+			}
+		}
+		mocks = append(mocks, models.Mock{
+			ResponseId:   routeResponse.Id,
+			FullPath:     fullPath.String(),
+			ParamNames:   strings.Join(paramNames, ","),
+			PathParams:   routeResponse.PathParams,
+			Matchers:     routeResponse.Matchers,
+			Method:       routeResponse.Method,
+			ResponseBody: routeResponse.Response,
+			Stream:       routeResponse.Stream,
+			Templated:    routeResponse.Templated,
+			Schema:       routeResponse.Schema,
+			Seed:         routeResponse.Seed,
+			Status:       routeResponse.Status,
+			DirectPathId: routeResponse.Path,
+		})
+	}
+	return mocks, nil
+}
+
+func (s *memoryStorage) getChain(routeId int64) []models.Route {
+	var chain []models.Route
+	for id := (sql.NullInt64{Int64: routeId, Valid: true}); id.Valid; {
+		route, found := s.routes[id.Int64]
+		if !found {
+			break
+		}
+		chain = append(chain, route)
+		id = route.ParentPath
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+func (s *memoryStorage) CreateRouteResponse(ctx context.Context, response models.RouteResponse) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.routes[response.Path]; !found {
+		return fmt.Errorf("route %d does not exist", response.Path)
+	}
+	if response.PathParams != nil {
+		pathParams, _ := response.PathParams.Value()
+		matchers, _ := response.Matchers.Value()
+		for _, existing := range s.routeResponses {
+			existingPathParams, _ := existing.PathParams.Value()
+			existingMatchers, _ := existing.Matchers.Value()
+			if existing.Path == response.Path && existing.Method == response.Method && existingPathParams == pathParams && existingMatchers == matchers {
+				return fmt.Errorf("%w: route_response.path_params, route_response.path, route_response.method, route_response.matchers", ErrConflict)
+			}
+		}
+	}
+
+	s.lastIds.RouteResponse++
+	response.Id = s.lastIds.RouteResponse
+	s.routeResponses[response.Id] = response
+	s.changed = true
+	return nil
+}
+
+func (s *memoryStorage) GetRoutes(ctx context.Context, workspaceId int) (map[int64]models.Route, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routesById := make(map[int64]models.Route)
+	for id, route := range s.routes {
+		if route.Workspace == int64(workspaceId) {
+			routesById[id] = route
+		}
+	}
+	return routesById, nil
+}
+
+func (s *memoryStorage) GetRouteResponses(ctx context.Context, workspaceId int, method string) ([]models.RouteResponse, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var responses []models.RouteResponse
+	for _, routeResponse := range s.routeResponses {
+		if route, found := s.routes[routeResponse.Path]; found && route.Workspace == int64(workspaceId) && routeResponse.Method == method {
+			responses = append(responses, routeResponse)
+		}
+	}
+	slices.SortFunc(responses, func(a, b models.RouteResponse) int {
+		if (a.PathParams == nil) != (b.PathParams == nil) {
+			if a.PathParams == nil {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return responses, nil
+}
+
+func (s *memoryStorage) CreateApiKey(ctx context.Context, apiKey models.ApiKey) (int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiKeys {
+		if existing.Name == apiKey.Name || existing.KeyHash == apiKey.KeyHash {
+			return 0, fmt.Errorf("%w: api_key.name", ErrConflict)
+		}
+	}
+	s.lastIds.ApiKey++
+	apiKey.Id = s.lastIds.ApiKey
+	s.apiKeys[apiKey.Id] = apiKey
+	s.changed = true
+	return apiKey.Id, nil
+}
+
+func (s *memoryStorage) GetApiKeys(ctx context.Context) ([]models.ApiKey, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedById(s.apiKeys, func(k models.ApiKey) int64 { return k.Id }), nil
+}
+
+func (s *memoryStorage) GetApiKeyByHash(ctx context.Context, keyHash string) (*models.ApiKey, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, apiKey := range s.apiKeys {
+		if apiKey.KeyHash == keyHash {
+			return &apiKey, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStorage) DeleteApiKey(ctx context.Context, id int64) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.apiKeys[id]; !found {
+		return false, nil
+	}
+	delete(s.apiKeys, id)
+	s.changed = true
+	return true, nil
+}
+
+func (s *memoryStorage) Close() error {
+
+	close(s.stopSnapshot)
+	s.snapshotDone.Wait()
+	if s.snapshotPath == "" {
+		return nil
+	}
+	return s.writeSnapshot()
+}
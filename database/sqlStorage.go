@@ -0,0 +1,983 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"moksarab/models"
+)
+
+// sqlStorage is the Storage shared by the SQL backends, the differences between them are kept in their dialect.
+type sqlStorage struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+func (s *sqlStorage) CreateWorkspace(ctx context.Context, workspace models.Workspace) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("INSERT INTO workspace (name, slug, type, description) VALUES (?, ?, ?, ?) RETURNING id"),
+		workspace.Name,
+		workspace.Slug,
+		workspace.Type,
+		workspace.Description,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetWorkspaces(ctx context.Context, pageNumber int, pageSize int) ([]models.Workspace, int, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind("SELECT id, name, slug, type, description, port, port_tls FROM workspace ORDER BY id LIMIT ? OFFSET ?"),
+		pageSize,
+		(pageSize * pageNumber),
+	)
+	if err != nil {
+		return nil, 0, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	var workspaces []models.Workspace
+	for rows.Next() {
+		var workspace models.Workspace
+		if err := rows.Scan(&workspace.Id, &workspace.Name, &workspace.Slug, &workspace.Type, &workspace.Description, &workspace.Port, &workspace.PortTls); err != nil {
+			return nil, 0, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	var totalElements int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspace").Scan(&totalElements); err != nil {
+		return nil, 0, s.dialect.translateError(err)
+	}
+	return workspaces, totalElements, nil
+}
+
+func (s *sqlStorage) GetWorkspace(ctx context.Context, id int64) (*models.Workspace, error) {
+	return s.getWorkspaceWhere(ctx, "id = ?", id)
+}
+
+func (s *sqlStorage) GetWorkspaceBySlug(ctx context.Context, slug string) (*models.Workspace, error) {
+	return s.getWorkspaceWhere(ctx, "slug = ?", slug)
+}
+
+func (s *sqlStorage) getWorkspaceWhere(ctx context.Context, condition string, arg any) (*models.Workspace, error) {
+
+	var workspace models.Workspace
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT id, name, slug, type, description, port, port_tls, port_client_ca, access_token_hash FROM workspace WHERE "+condition), arg).
+		Scan(&workspace.Id, &workspace.Name, &workspace.Slug, &workspace.Type, &workspace.Description, &workspace.Port, &workspace.PortTls, &workspace.PortClientCa, &workspace.AccessTokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &workspace, nil
+}
+
+func (s *sqlStorage) UpdateWorkspaceSlug(ctx context.Context, id int64, slug string) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("UPDATE workspace SET slug = ? WHERE id = ?"), slug, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *sqlStorage) SetWorkspaceAccessTokenHash(ctx context.Context, id int64, accessTokenHash sql.NullString) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("UPDATE workspace SET access_token_hash = ? WHERE id = ?"), accessTokenHash, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *sqlStorage) SetWorkspacePort(ctx context.Context, workspace models.Workspace) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("UPDATE workspace SET port = ?, port_tls = ?, port_client_ca = ? WHERE id = ?"),
+		workspace.Port,
+		workspace.PortTls,
+		workspace.PortClientCa,
+		workspace.Id,
+	)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *sqlStorage) GetWorkspacesWithPort(ctx context.Context) ([]models.Workspace, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, slug, type, description, port, port_tls, port_client_ca FROM workspace WHERE port IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	var workspaces []models.Workspace
+	for rows.Next() {
+		var workspace models.Workspace
+		if err := rows.Scan(&workspace.Id, &workspace.Name, &workspace.Slug, &workspace.Type, &workspace.Description, &workspace.Port, &workspace.PortTls, &workspace.PortClientCa); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, rows.Err()
+}
+
+func (s *sqlStorage) GetOidcProvider(ctx context.Context, workspaceId int64) (*models.OidcProvider, error) {
+
+	var provider models.OidcProvider
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT workspace, settings, signing_key FROM oidc_provider WHERE workspace = ?"), workspaceId).
+		Scan(&provider.Workspace, &provider.Settings, &provider.SigningKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &provider, nil
+}
+
+func (s *sqlStorage) SaveOidcProvider(ctx context.Context, provider models.OidcProvider) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO oidc_provider (workspace, settings, signing_key) VALUES (?, ?, ?)
+		ON CONFLICT (workspace) DO UPDATE SET settings = excluded.settings, signing_key = excluded.signing_key`),
+		provider.Workspace,
+		provider.Settings,
+		provider.SigningKey,
+	)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) CreateGraphqlMock(ctx context.Context, mock models.GraphqlMock) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		INSERT INTO graphql_mock (workspace, path, operation_type, operation_name, variables, status, data, errors)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		mock.Workspace,
+		mock.Path,
+		mock.OperationType,
+		mock.OperationName,
+		mock.Variables,
+		mock.Status,
+		mock.Data,
+		mock.Errors,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetGraphqlMocks(ctx context.Context, workspaceId int64) ([]models.GraphqlMock, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT id, workspace, path, operation_type, operation_name, variables, status, data, errors
+		FROM graphql_mock WHERE workspace = ? ORDER BY id`), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	mocks := []models.GraphqlMock{}
+	for rows.Next() {
+		var mock models.GraphqlMock
+		if err := rows.Scan(&mock.Id, &mock.Workspace, &mock.Path, &mock.OperationType, &mock.OperationName, &mock.Variables, &mock.Status, &mock.Data, &mock.Errors); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, rows.Err()
+}
+
+func (s *sqlStorage) DeleteGraphqlMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM graphql_mock WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) GetGraphqlSchema(ctx context.Context, workspaceId int64) (*models.GraphqlSchema, error) {
+
+	var schema models.GraphqlSchema
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT workspace, path, sdl FROM graphql_schema WHERE workspace = ?"), workspaceId).
+		Scan(&schema.Workspace, &schema.Path, &schema.Sdl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &schema, nil
+}
+
+func (s *sqlStorage) SaveGraphqlSchema(ctx context.Context, schema models.GraphqlSchema) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO graphql_schema (workspace, path, sdl) VALUES (?, ?, ?)
+		ON CONFLICT (workspace) DO UPDATE SET path = excluded.path, sdl = excluded.sdl`),
+		schema.Workspace,
+		schema.Path,
+		schema.Sdl,
+	)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) DeleteGraphqlSchema(ctx context.Context, workspaceId int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM graphql_schema WHERE workspace = ?"), workspaceId)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateWebsocketMock(ctx context.Context, mock models.WebsocketMock) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("INSERT INTO websocket_mock (workspace, path, script) VALUES (?, ?, ?) RETURNING id"),
+		mock.Workspace,
+		mock.Path,
+		mock.Script,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetWebsocketMocks(ctx context.Context, workspaceId int64) ([]models.WebsocketMock, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind("SELECT id, workspace, path, script FROM websocket_mock WHERE workspace = ? ORDER BY id"), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	mocks := []models.WebsocketMock{}
+	for rows.Next() {
+		var mock models.WebsocketMock
+		if err := rows.Scan(&mock.Id, &mock.Workspace, &mock.Path, &mock.Script); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, rows.Err()
+}
+
+func (s *sqlStorage) DeleteWebsocketMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM websocket_mock WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateGrpcMock(ctx context.Context, mock models.GrpcMock) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		INSERT INTO grpc_mock (workspace, service, method, match_fields, response, code, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		mock.Workspace,
+		mock.Service,
+		mock.Method,
+		mock.Match,
+		mock.Response,
+		mock.Code,
+		mock.Message,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetGrpcMocks(ctx context.Context, workspaceId int64) ([]models.GrpcMock, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT id, workspace, service, method, match_fields, response, code, message
+		FROM grpc_mock WHERE workspace = ? ORDER BY id`), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	mocks := []models.GrpcMock{}
+	for rows.Next() {
+		var mock models.GrpcMock
+		if err := rows.Scan(&mock.Id, &mock.Workspace, &mock.Service, &mock.Method, &mock.Match, &mock.Response, &mock.Code, &mock.Message); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, rows.Err()
+}
+
+func (s *sqlStorage) DeleteGrpcMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM grpc_mock WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) GetGrpcSchema(ctx context.Context, workspaceId int64) (*models.GrpcSchema, error) {
+
+	var schema models.GrpcSchema
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT workspace, descriptor_set FROM grpc_schema WHERE workspace = ?"), workspaceId).
+		Scan(&schema.Workspace, &schema.DescriptorSet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &schema, nil
+}
+
+func (s *sqlStorage) SaveGrpcSchema(ctx context.Context, schema models.GrpcSchema) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO grpc_schema (workspace, descriptor_set) VALUES (?, ?)
+		ON CONFLICT (workspace) DO UPDATE SET descriptor_set = excluded.descriptor_set`),
+		schema.Workspace,
+		schema.DescriptorSet,
+	)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) DeleteGrpcSchema(ctx context.Context, workspaceId int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM grpc_schema WHERE workspace = ?"), workspaceId)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) GetOpenapiDocument(ctx context.Context, workspaceId int64) (*models.OpenapiDocument, error) {
+
+	var document models.OpenapiDocument
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT workspace, document, validation FROM openapi_document WHERE workspace = ?"), workspaceId).
+		Scan(&document.Workspace, &document.Document, &document.Validation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &document, nil
+}
+
+func (s *sqlStorage) SaveOpenapiDocument(ctx context.Context, document models.OpenapiDocument) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO openapi_document (workspace, document, validation) VALUES (?, ?, ?)
+		ON CONFLICT (workspace) DO UPDATE SET document = excluded.document, validation = excluded.validation`),
+		document.Workspace,
+		document.Document,
+		document.Validation,
+	)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) DeleteOpenapiDocument(ctx context.Context, workspaceId int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM openapi_document WHERE workspace = ?"), workspaceId)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateSoapMock(ctx context.Context, mock models.SoapMock) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		INSERT INTO soap_mock (workspace, path, action, xpaths, namespaces, status, body, fault, imported)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		mock.Workspace,
+		mock.Path,
+		mock.Action,
+		mock.XPaths,
+		mock.Namespaces,
+		mock.Status,
+		mock.Body,
+		mock.Fault,
+		mock.Imported,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) ReplaceSoapMocks(ctx context.Context, workspaceId int64, mocks []models.SoapMock) ([]int64, error) {
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer transaction.Rollback()
+
+	for _, mock := range mocks {
+		_, err := transaction.ExecContext(ctx, s.dialect.rebind("DELETE FROM soap_mock WHERE workspace = ? AND path = ? AND action = ? AND imported = ?"),
+			workspaceId, mock.Path, mock.Action, true)
+		if err != nil {
+			return nil, s.dialect.translateError(err)
+		}
+	}
+	ids := make([]int64, len(mocks))
+	for i, mock := range mocks {
+		err := transaction.QueryRowContext(ctx, s.dialect.rebind(`
+			INSERT INTO soap_mock (workspace, path, action, xpaths, namespaces, status, body, fault, imported)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+			workspaceId,
+			mock.Path,
+			mock.Action,
+			mock.XPaths,
+			mock.Namespaces,
+			mock.Status,
+			mock.Body,
+			mock.Fault,
+			true,
+		).Scan(&ids[i])
+		if err != nil {
+			return nil, s.dialect.translateError(err)
+		}
+	}
+	return ids, transaction.Commit()
+}
+
+func (s *sqlStorage) GetSoapMocks(ctx context.Context, workspaceId int64) ([]models.SoapMock, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT id, workspace, path, action, xpaths, namespaces, status, body, fault, imported
+		FROM soap_mock WHERE workspace = ? ORDER BY id`), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	mocks := []models.SoapMock{}
+	for rows.Next() {
+		var mock models.SoapMock
+		if err := rows.Scan(&mock.Id, &mock.Workspace, &mock.Path, &mock.Action, &mock.XPaths, &mock.Namespaces, &mock.Status, &mock.Body, &mock.Fault, &mock.Imported); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, rows.Err()
+}
+
+func (s *sqlStorage) DeleteSoapMock(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM soap_mock WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateCallback(ctx context.Context, callback models.Callback) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		INSERT INTO callback (workspace, response_id, method, url, headers, body, delay_ms, max_attempts, retry_delay_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		callback.Workspace,
+		callback.ResponseId,
+		callback.Method,
+		callback.Url,
+		callback.Headers,
+		callback.Body,
+		callback.DelayMs,
+		callback.MaxAttempts,
+		callback.RetryDelayMs,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetCallbacks(ctx context.Context, workspaceId int64) ([]models.Callback, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT id, workspace, response_id, method, url, headers, body, delay_ms, max_attempts, retry_delay_ms
+		FROM callback WHERE workspace = ? ORDER BY id`), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	callbacks := []models.Callback{}
+	for rows.Next() {
+		var callback models.Callback
+		if err := rows.Scan(&callback.Id, &callback.Workspace, &callback.ResponseId, &callback.Method, &callback.Url, &callback.Headers,
+			&callback.Body, &callback.DelayMs, &callback.MaxAttempts, &callback.RetryDelayMs); err != nil {
+			return nil, err
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks, rows.Err()
+}
+
+func (s *sqlStorage) DeleteCallback(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM callback WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateResource(ctx context.Context, resource models.Resource) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		INSERT INTO resource (workspace, path, id_field, state, seed)
+		VALUES (?, ?, ?, ?, ?) RETURNING id`),
+		resource.Workspace,
+		resource.Path,
+		resource.IdField,
+		resource.State,
+		resource.Seed,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetResources(ctx context.Context, workspaceId int64) ([]models.Resource, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT id, workspace, path, id_field, state, seed
+		FROM resource WHERE workspace = ? ORDER BY id`), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	resources := []models.Resource{}
+	for rows.Next() {
+		var resource models.Resource
+		if err := rows.Scan(&resource.Id, &resource.Workspace, &resource.Path, &resource.IdField, &resource.State, &resource.Seed); err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, rows.Err()
+}
+
+func (s *sqlStorage) DeleteResource(ctx context.Context, workspaceId int64, id int64) (bool, error) {
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer transaction.Rollback()
+
+	_, err = transaction.ExecContext(ctx, s.dialect.rebind(`
+		DELETE FROM resource_item WHERE resource IN (SELECT id FROM resource WHERE workspace = ? AND id = ?)`), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	result, err := transaction.ExecContext(ctx, s.dialect.rebind("DELETE FROM resource WHERE workspace = ? AND id = ?"), workspaceId, id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, transaction.Commit()
+}
+
+func (s *sqlStorage) GetResourceItems(ctx context.Context, resourceId int64) ([]models.ResourceItem, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT resource, item_id, data FROM resource_item WHERE resource = ? ORDER BY id`), resourceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	items := []models.ResourceItem{}
+	for rows.Next() {
+		var item models.ResourceItem
+		if err := rows.Scan(&item.Resource, &item.ItemId, &item.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlStorage) CreateResourceItem(ctx context.Context, item models.ResourceItem) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind("INSERT INTO resource_item (resource, item_id, data) VALUES (?, ?, ?)"),
+		item.Resource, item.ItemId, item.Data)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) UpdateResourceItem(ctx context.Context, item models.ResourceItem) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("UPDATE resource_item SET data = ? WHERE resource = ? AND item_id = ?"),
+		item.Data, item.Resource, item.ItemId)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *sqlStorage) DeleteResourceItem(ctx context.Context, resourceId int64, itemId string) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM resource_item WHERE resource = ? AND item_id = ?"), resourceId, itemId)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) ResetResourceItems(ctx context.Context, resourceId int64, items []models.ResourceItem) error {
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	if _, err := transaction.ExecContext(ctx, s.dialect.rebind("DELETE FROM resource_item WHERE resource = ?"), resourceId); err != nil {
+		return s.dialect.translateError(err)
+	}
+	for _, item := range items {
+		_, err := transaction.ExecContext(ctx, s.dialect.rebind("INSERT INTO resource_item (resource, item_id, data) VALUES (?, ?, ?)"),
+			resourceId, item.ItemId, item.Data)
+		if err != nil {
+			return s.dialect.translateError(err)
+		}
+	}
+	return transaction.Commit()
+}
+
+func (s *sqlStorage) AddWorkspaceHost(ctx context.Context, host models.WorkspaceHost) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind("INSERT INTO workspace_host (host, workspace) VALUES (?, ?)"), host.Host, host.Workspace)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetWorkspaceHosts(ctx context.Context, workspaceId int64) ([]models.WorkspaceHost, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind("SELECT host, workspace FROM workspace_host WHERE workspace = ? ORDER BY host"), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	hosts := []models.WorkspaceHost{}
+	for rows.Next() {
+		var host models.WorkspaceHost
+		if err := rows.Scan(&host.Host, &host.Workspace); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, rows.Err()
+}
+
+func (s *sqlStorage) GetWorkspaceByHost(ctx context.Context, host string) (*models.Workspace, error) {
+	return s.getWorkspaceWhere(ctx, "id = (SELECT workspace FROM workspace_host WHERE host = ?)", host)
+}
+
+func (s *sqlStorage) DeleteWorkspaceHost(ctx context.Context, host models.WorkspaceHost) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM workspace_host WHERE host = ? AND workspace = ?"), host.Host, host.Workspace)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) CreateMock(ctx context.Context, workspaceId int, segments []models.Route, response models.RouteResponse) error {
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	var lastInseretedId sql.NullInt64
+	for i, segment := range segments {
+		lastInseretedId, err = s.insertSegmentReturningIdOrGetExistingRouteId(ctx, transaction, segment, lastInseretedId, workspaceId, (i+1) == len(segments))
+		if err != nil {
+			return s.dialect.translateError(err)
+		}
+	}
+
+	// the UNIQUE constraint can't tell the responses apart, their path_params are NULL
+	var exists bool
+	err = transaction.QueryRowContext(ctx, s.dialect.rebind("SELECT EXISTS (SELECT 1 FROM route_response WHERE path = ? AND method = ? AND path_params IS NULL AND matchers = ?)"),
+		lastInseretedId.Int64,
+		response.Method,
+		response.Matchers,
+	).Scan(&exists)
+	if err != nil {
+		return s.dialect.translateError(err)
+	}
+	if exists {
+		return fmt.Errorf("%w: this response already exist", ErrConflict)
+	}
+
+	_, err = transaction.ExecContext(ctx, s.dialect.rebind("INSERT INTO route_response (status, path, method, response, matchers, stream, templated, schema, seed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		response.Status,
+		lastInseretedId.Int64,
+		response.Method,
+		response.Response,
+		response.Matchers,
+		response.Stream,
+		response.Templated,
+		response.Schema,
+		response.Seed,
+	)
+	if err != nil {
+		return s.dialect.translateError(err)
+	}
+	return transaction.Commit()
+}
+
+func (s *sqlStorage) insertSegmentReturningIdOrGetExistingRouteId(ctx context.Context, transaction *sql.Tx, segment models.Route, lastInsertedId sql.NullInt64, workspaceId int, isLastPart bool) (sql.NullInt64, error) {
+
+	var id sql.NullInt64
+	var alreadyHasResponse bool
+	err := transaction.QueryRowContext(ctx, s.dialect.rebind("SELECT id, has_responses FROM route WHERE path = ? and workspace = ? and parent_path IS NOT DISTINCT FROM ? and param_constraint IS NOT DISTINCT FROM ?"),
+		segment.Path,
+		workspaceId,
+		lastInsertedId,
+		segment.ParamConstraint,
+	).Scan(&id, &alreadyHasResponse)
+	if err == nil {
+		if isLastPart && !alreadyHasResponse {
+			_, err = transaction.ExecContext(ctx, s.dialect.rebind("UPDATE route set has_responses = ? where id = ?"), true, id)
+		}
+		return id, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+
+	err = transaction.QueryRowContext(ctx, s.dialect.rebind("INSERT INTO route (path, parent_path, workspace, has_responses, is_param, param_name, param_constraint) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+		segment.Path,
+		lastInsertedId,
+		workspaceId,
+		isLastPart,
+		segment.IsParam,
+		segment.ParamName,
+		segment.ParamConstraint,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *sqlStorage) GetMocks(ctx context.Context, workspaceId int) ([]models.Mock, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		WITH RECURSIVE route_path(id, path, parent_path, full_path, param_names, origin_id) AS (
+			-- Base case: routes having responses, filtered by workspace
+			SELECT
+				r.id,
+				r.path,
+				r.parent_path,
+				r.path AS full_path,
+				COALESCE(r.param_name, '') AS param_names,
+				r.id AS origin_id
+			FROM route r
+			WHERE r.id IN (SELECT path FROM route_response)
+			  AND r.workspace = ?   -- 👈
+
+			UNION ALL
+
+			-- Recursive step: climb up parent_path, staying within the same workspace
+			SELECT
+				p.id,
+				p.path,
+				p.parent_path,
+				p.path || rp.full_path,
+				COALESCE(p.param_name || ',', '') || rp.param_names,
+				rp.origin_id
+			FROM route p
+			JOIN route_path rp ON rp.parent_path = p.id
+			WHERE p.workspace = ?   -- 👈
+		)
+
+		-- Final result with pagination
+		SELECT
+			rr.id AS response_id,
+			rp.full_path AS full_path,
+			LTRIM(RTRIM(rp.param_names, ','), ',') as param_names,
+			rr.path_params,
+			rr.matchers,
+			rr.method,
+			rr.response AS response_body,
+			rr.stream,
+			rr.templated,
+			rr.schema,
+			rr.seed,
+			rr.status,
+			rr.path AS direct_path_id
+		FROM route_response rr
+		JOIN (
+			SELECT origin_id, full_path, param_names
+			FROM route_path
+			WHERE parent_path IS NULL
+		) rp ON rr.path = rp.origin_id
+		ORDER BY rr.id;
+		`),
+		workspaceId,
+		workspaceId,
+	)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	var mocks []models.Mock
+	for rows.Next() {
+		var mock models.Mock
+		err := rows.Scan(&mock.ResponseId, &mock.FullPath, &mock.ParamNames, &mock.PathParams, &mock.Matchers, &mock.Method, &mock.ResponseBody, &mock.Stream, &mock.Templated, &mock.Schema, &mock.Seed, &mock.Status, &mock.DirectPathId)
+		if err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, rows.Err()
+}
+
+func (s *sqlStorage) CreateRouteResponse(ctx context.Context, response models.RouteResponse) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind("INSERT INTO route_response (path, path_params, method, status, response, matchers, stream, templated, schema, seed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		response.Path,
+		response.PathParams,
+		response.Method,
+		response.Status,
+		response.Response,
+		response.Matchers,
+		response.Stream,
+		response.Templated,
+		response.Schema,
+		response.Seed,
+	)
+	return s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetRoutes(ctx context.Context, workspaceId int) (map[int64]models.Route, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind("SELECT id, path, parent_path, is_param, param_name, param_constraint, has_responses, workspace FROM route WHERE workspace = ?"), workspaceId)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	routesById := make(map[int64]models.Route)
+	for rows.Next() {
+		var route models.Route
+		if err := rows.Scan(&route.Id, &route.Path, &route.ParentPath, &route.IsParam, &route.ParamName, &route.ParamConstraint, &route.HasResponses, &route.Workspace); err != nil {
+			return nil, err
+		}
+		routesById[route.Id] = route
+	}
+	return routesById, rows.Err()
+}
+
+func (s *sqlStorage) GetRouteResponses(ctx context.Context, workspaceId int, method string) ([]models.RouteResponse, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+			SELECT rr.id, rr.path, rr.path_params, rr.method, rr.status, rr.response, rr.matchers, rr.stream, rr.templated, rr.schema, rr.seed
+			FROM route_response rr
+				JOIN route r ON r.id = rr.path
+			WHERE rr.method = ?
+				AND r.workspace = ?
+			ORDER BY rr.path_params IS NULL, rr.id
+			`),
+		method,
+		workspaceId,
+	)
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	var responses []models.RouteResponse
+	for rows.Next() {
+		var response models.RouteResponse
+		if err := rows.Scan(&response.Id, &response.Path, &response.PathParams, &response.Method, &response.Status, &response.Response, &response.Matchers, &response.Stream, &response.Templated, &response.Schema, &response.Seed); err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, rows.Err()
+}
+
+func (s *sqlStorage) CreateApiKey(ctx context.Context, apiKey models.ApiKey) (int64, error) {
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("INSERT INTO api_key (name, key_hash, role, workspaces) VALUES (?, ?, ?, ?) RETURNING id"),
+		apiKey.Name,
+		apiKey.KeyHash,
+		apiKey.Role,
+		apiKey.Workspaces,
+	).Scan(&id)
+	return id, s.dialect.translateError(err)
+}
+
+func (s *sqlStorage) GetApiKeys(ctx context.Context) ([]models.ApiKey, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, key_hash, role, workspaces FROM api_key ORDER BY id")
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	defer rows.Close()
+
+	var apiKeys []models.ApiKey
+	for rows.Next() {
+		var apiKey models.ApiKey
+		if err := rows.Scan(&apiKey.Id, &apiKey.Name, &apiKey.KeyHash, &apiKey.Role, &apiKey.Workspaces); err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, rows.Err()
+}
+
+func (s *sqlStorage) GetApiKeyByHash(ctx context.Context, keyHash string) (*models.ApiKey, error) {
+
+	var apiKey models.ApiKey
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT id, name, key_hash, role, workspaces FROM api_key WHERE key_hash = ?"), keyHash).
+		Scan(&apiKey.Id, &apiKey.Name, &apiKey.KeyHash, &apiKey.Role, &apiKey.Workspaces)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dialect.translateError(err)
+	}
+	return &apiKey, nil
+}
+
+func (s *sqlStorage) DeleteApiKey(ctx context.Context, id int64) (bool, error) {
+
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM api_key WHERE id = ?"), id)
+	if err != nil {
+		return false, s.dialect.translateError(err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"moksarab/models"
+)
+
+// ErrConflict and ErrNotNull are returned, wrapped, by every Storage when a UNIQUE or NOT NULL constraint fails.
+var (
+	ErrConflict = errors.New("UNIQUE constraint failed")
+	ErrNotNull  = errors.New("NOT NULL constraint failed")
+)
+
+// ResourceItemStore keeps the items of the resources, the ones in the database with the Storage, and the other ones in MemoryResourceItems.
+type ResourceItemStore interface {
+	// GetResourceItems returns the items of a resource in the order they were created.
+	GetResourceItems(ctx context.Context, resourceId int64) ([]models.ResourceItem, error)
+	// CreateResourceItem returns ErrConflict when the resource already has an item with the id.
+	CreateResourceItem(ctx context.Context, item models.ResourceItem) error
+	// UpdateResourceItem replaces the data of the item, it returns false when the resource has no item with the id.
+	UpdateResourceItem(ctx context.Context, item models.ResourceItem) (bool, error)
+	// DeleteResourceItem returns false when the resource has no item with the id.
+	DeleteResourceItem(ctx context.Context, resourceId int64, itemId string) (bool, error)
+	// ResetResourceItems replaces all the items of a resource.
+	ResetResourceItems(ctx context.Context, resourceId int64, items []models.ResourceItem) error
+}
+
+// Storage is the set of operations the handlers need, implemented by each storage backend.
+type Storage interface {
+	CreateWorkspace(ctx context.Context, workspace models.Workspace) (int64, error)
+	GetWorkspaces(ctx context.Context, pageNumber int, pageSize int) ([]models.Workspace, int, error)
+	// GetWorkspace returns nil when there is no workspace with the id.
+	GetWorkspace(ctx context.Context, id int64) (*models.Workspace, error)
+	// GetWorkspaceBySlug returns nil when there is no workspace with the slug.
+	GetWorkspaceBySlug(ctx context.Context, slug string) (*models.Workspace, error)
+	// UpdateWorkspaceSlug returns false when there is no workspace with the id.
+	UpdateWorkspaceSlug(ctx context.Context, id int64, slug string) (bool, error)
+	// SetWorkspaceAccessTokenHash returns false when there is no workspace with the id.
+	SetWorkspaceAccessTokenHash(ctx context.Context, id int64, accessTokenHash sql.NullString) (bool, error)
+
+	// SetWorkspacePort sets the port, port_tls, and port_client_ca of the workspace, a nil port removes its listener.
+	// It returns false when there is no workspace with the id.
+	SetWorkspacePort(ctx context.Context, workspace models.Workspace) (bool, error)
+	// GetWorkspacesWithPort returns the workspaces having their own listener port.
+	GetWorkspacesWithPort(ctx context.Context) ([]models.Workspace, error)
+
+	// GetOidcProvider returns nil when the workspace has no provider yet.
+	GetOidcProvider(ctx context.Context, workspaceId int64) (*models.OidcProvider, error)
+	// SaveOidcProvider creates the provider of the workspace, or replaces it.
+	SaveOidcProvider(ctx context.Context, provider models.OidcProvider) error
+
+	CreateGraphqlMock(ctx context.Context, mock models.GraphqlMock) (int64, error)
+	// GetGraphqlMocks returns the GraphQL mocks of a workspace in the order they were created.
+	GetGraphqlMocks(ctx context.Context, workspaceId int64) ([]models.GraphqlMock, error)
+	// DeleteGraphqlMock returns false when the workspace has no GraphQL mock with the id.
+	DeleteGraphqlMock(ctx context.Context, workspaceId int64, id int64) (bool, error)
+	// GetGraphqlSchema returns nil when the workspace has no schema.
+	GetGraphqlSchema(ctx context.Context, workspaceId int64) (*models.GraphqlSchema, error)
+	// SaveGraphqlSchema creates the schema of the workspace, or replaces it.
+	SaveGraphqlSchema(ctx context.Context, schema models.GraphqlSchema) error
+	// DeleteGraphqlSchema returns false when the workspace has no schema.
+	DeleteGraphqlSchema(ctx context.Context, workspaceId int64) (bool, error)
+
+	CreateWebsocketMock(ctx context.Context, mock models.WebsocketMock) (int64, error)
+	GetWebsocketMocks(ctx context.Context, workspaceId int64) ([]models.WebsocketMock, error)
+	// DeleteWebsocketMock returns false when the workspace has no WebSocket mock with the id.
+	DeleteWebsocketMock(ctx context.Context, workspaceId int64, id int64) (bool, error)
+
+	CreateGrpcMock(ctx context.Context, mock models.GrpcMock) (int64, error)
+	GetGrpcMocks(ctx context.Context, workspaceId int64) ([]models.GrpcMock, error)
+	// DeleteGrpcMock returns false when the workspace has no gRPC mock with the id.
+	DeleteGrpcMock(ctx context.Context, workspaceId int64, id int64) (bool, error)
+	// GetGrpcSchema returns nil when the workspace has no gRPC schema.
+	GetGrpcSchema(ctx context.Context, workspaceId int64) (*models.GrpcSchema, error)
+	// SaveGrpcSchema creates the gRPC schema of the workspace, or replaces it.
+	SaveGrpcSchema(ctx context.Context, schema models.GrpcSchema) error
+	// DeleteGrpcSchema returns false when the workspace has no gRPC schema.
+	DeleteGrpcSchema(ctx context.Context, workspaceId int64) (bool, error)
+
+	// GetOpenapiDocument returns nil when the workspace has no OpenAPI document.
+	GetOpenapiDocument(ctx context.Context, workspaceId int64) (*models.OpenapiDocument, error)
+	// SaveOpenapiDocument creates the OpenAPI document of the workspace, or replaces it.
+	SaveOpenapiDocument(ctx context.Context, document models.OpenapiDocument) error
+	// DeleteOpenapiDocument returns false when the workspace has no OpenAPI document.
+	DeleteOpenapiDocument(ctx context.Context, workspaceId int64) (bool, error)
+
+	CreateSoapMock(ctx context.Context, mock models.SoapMock) (int64, error)
+	// ReplaceSoapMocks creates the mocks of the workspace in one go as imported, in place of its imported mocks at the same path and action,
+	// and returns their ids in order. The mocks created otherwise are kept.
+	ReplaceSoapMocks(ctx context.Context, workspaceId int64, mocks []models.SoapMock) ([]int64, error)
+	GetSoapMocks(ctx context.Context, workspaceId int64) ([]models.SoapMock, error)
+	// DeleteSoapMock returns false when the workspace has no SOAP mock with the id.
+	DeleteSoapMock(ctx context.Context, workspaceId int64, id int64) (bool, error)
+
+	CreateCallback(ctx context.Context, callback models.Callback) (int64, error)
+	// GetCallbacks returns the callbacks of a workspace in the order they were created.
+	GetCallbacks(ctx context.Context, workspaceId int64) ([]models.Callback, error)
+	// DeleteCallback returns false when the workspace has no callback with the id.
+	DeleteCallback(ctx context.Context, workspaceId int64, id int64) (bool, error)
+
+	CreateResource(ctx context.Context, resource models.Resource) (int64, error)
+	// GetResources returns the resources of a workspace in the order they were created.
+	GetResources(ctx context.Context, workspaceId int64) ([]models.Resource, error)
+	// DeleteResource deletes the resource with its items, it returns false when the workspace has no resource with the id.
+	DeleteResource(ctx context.Context, workspaceId int64, id int64) (bool, error)
+	ResourceItemStore
+
+	AddWorkspaceHost(ctx context.Context, host models.WorkspaceHost) error
+	GetWorkspaceHosts(ctx context.Context, workspaceId int64) ([]models.WorkspaceHost, error)
+	// GetWorkspaceByHost returns nil when the host is not mapped to any workspace.
+	GetWorkspaceByHost(ctx context.Context, host string) (*models.Workspace, error)
+	// DeleteWorkspaceHost returns false when the host is not mapped to the workspace.
+	DeleteWorkspaceHost(ctx context.Context, host models.WorkspaceHost) (bool, error)
+
+	// CreateMock creates the route segments that do not exist yet, and the response of the last one.
+	CreateMock(ctx context.Context, workspaceId int, segments []models.Route, response models.RouteResponse) error
+	GetMocks(ctx context.Context, workspaceId int) ([]models.Mock, error)
+	CreateRouteResponse(ctx context.Context, response models.RouteResponse) error
+
+	GetRoutes(ctx context.Context, workspaceId int) (map[int64]models.Route, error)
+	// GetRouteResponses returns the responses of a method in a workspace, the ones with path params first.
+	GetRouteResponses(ctx context.Context, workspaceId int, method string) ([]models.RouteResponse, error)
+
+	CreateApiKey(ctx context.Context, apiKey models.ApiKey) (int64, error)
+	GetApiKeys(ctx context.Context) ([]models.ApiKey, error)
+	// GetApiKeyByHash returns nil when no key has the hash.
+	GetApiKeyByHash(ctx context.Context, keyHash string) (*models.ApiKey, error)
+	// DeleteApiKey returns false when there was no key to delete.
+	DeleteApiKey(ctx context.Context, id int64) (bool, error)
+
+	Close() error
+}
+
+var Store Storage
+
+// MemoryResourceItems keeps the items of the resources whose state is memory, whichever the Storage, and never persists them.
+var MemoryResourceItems ResourceItemStore = &memoryStorage{resourceItems: make(map[int64][]models.ResourceItem)}
@@ -11,6 +11,7 @@ import (
 	"moksarab/models"
 	"moksarab/routes"
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -42,7 +43,7 @@ func beforeEach() *fiber.App {
 
 func afterEach(t *testing.T, app *fiber.App) {
 	_ = app.Shutdown()
-	_ = database.Db.Close()
+	_ = database.Store.Close()
 
 	select {
 	case err := <-errCh:
@@ -54,6 +55,10 @@ func afterEach(t *testing.T, app *fiber.App) {
 }
 
 func sendRequest(client *http.Client, url, method string, body interface{}) (*http.Response, error) {
+	return sendRequestWithApiKey(client, url, method, body, "")
+}
+
+func sendRequestWithApiKey(client *http.Client, url, method string, body interface{}, apiKey string) (*http.Response, error) {
 
 	var bodyBuf bytes.Buffer
 	if body != nil {
@@ -67,10 +72,36 @@ func sendRequest(client *http.Client, url, method string, body interface{}) (*ht
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
 	return client.Do(req)
 
 }
 
+// expectStatus sends the request, fails the test unless it is answered with the status, and returns the response body.
+func expectStatus(t *testing.T, client *http.Client, url, method string, body interface{}, status int) []byte {
+	t.Helper()
+	return expectStatusWithApiKey(t, client, url, method, body, "", status)
+}
+
+func expectStatusWithApiKey(t *testing.T, client *http.Client, url, method string, body interface{}, apiKey string, status int) []byte {
+	t.Helper()
+	res, err := sendRequestWithApiKey(client, url, method, body, apiKey)
+	if err != nil {
+		t.Fatalf("error sending %s %s: %v", method, url, err)
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error reading %s %s: %v", method, url, err)
+	}
+	if res.StatusCode != status {
+		t.Fatalf("expected %s %s to be %d, but found %d: %s", method, url, status, res.StatusCode, raw)
+	}
+	return raw
+}
+
 func createWorkspace(client *http.Client, name, description string) (*http.Response, error) {
 	workspace := models.Workspace{
 		Name:        name,
@@ -135,6 +166,194 @@ func TestWorkspace(t *testing.T) {
 	afterEach(t, app)
 }
 
+func TestWorkspaceSlugs(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	createWorkspaceRes, err := createWorkspace(client, "Checkout Team", "addressed by its slug")
+	if err != nil {
+		t.Fatalf("Creating workspace failed: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{Path: "/carts/:cartId", Method: "GET", Status: 200}
+	createMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/checkout-team/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("Error creating mock by workspace slug: %v", err)
+	}
+	createMockRes.Body.Close()
+	if createMockRes.StatusCode != http.StatusCreated {
+		t.Fatalf("expected creating mock by workspace slug to be 201, but found %d", createMockRes.StatusCode)
+	}
+
+	expectSarabStatus := func(url string, status int) {
+		t.Helper()
+		res, err := sendRequest(client, url, "GET", nil)
+		if err != nil {
+			t.Fatalf("error calling sarab [%s]: %v", url, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected [%s] response to be %d, but found %d", url, status, res.StatusCode)
+		}
+	}
+	expectSarabStatus(BASE_URL+"/sarab/checkout-team/carts/7", http.StatusOK)
+
+	invalidSlugRes, err := sendRequest(client, BASE_URL+"/api/workspaces/checkout-team", "PATCH", routes.UpdateWorkspaceRequest{Slug: "42"})
+	if err != nil {
+		t.Fatalf("Error updating workspace slug: %v", err)
+	}
+	invalidSlugRes.Body.Close()
+	if invalidSlugRes.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an only digits slug to be rejected with 400, but found %d", invalidSlugRes.StatusCode)
+	}
+
+	updateRes, err := sendRequest(client, BASE_URL+"/api/workspaces/checkout-team", "PATCH", routes.UpdateWorkspaceRequest{Slug: "checkout"})
+	if err != nil {
+		t.Fatalf("Error updating workspace slug: %v", err)
+	}
+	defer updateRes.Body.Close()
+	if updateRes.StatusCode != http.StatusOK {
+		t.Fatalf("expected updating workspace slug to be 200, but found %d", updateRes.StatusCode)
+	}
+	var updated models.Workspace
+	if err := json.NewDecoder(updateRes.Body).Decode(&updated); err != nil {
+		t.Fatalf("Failed to decode updated workspace: %v", err)
+	}
+	if updated.Slug != "checkout" {
+		t.Fatalf("expected workspace slug to be checkout, found %s", updated.Slug)
+	}
+
+	expectSarabStatus(BASE_URL+"/sarab/checkout/carts/7", http.StatusOK)
+	expectSarabStatus(BASE_URL+"/sarab/"+strconv.FormatInt(updated.Id, 10)+"/carts/7", http.StatusOK)
+	expectSarabStatus(BASE_URL+"/sarab/checkout-team/carts/7", http.StatusNotFound)
+
+	afterEach(t, app)
+}
+
+func TestWorkspaceHosts(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	createWorkspaceRes, err := createWorkspace(client, "payments", "served at payments.mock.local")
+	if err != nil {
+		t.Fatalf("Creating workspace failed: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{Path: "/charges/:chargeId", Method: "GET", Status: 200}
+	createMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/payments/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	createMockRes.Body.Close()
+
+	expectHostStatus := func(host, path string, status int) {
+		t.Helper()
+		req, err := http.NewRequest("GET", BASE_URL+path, nil)
+		if err != nil {
+			t.Fatalf("error creating request: %v", err)
+		}
+		req.Host = host
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("error calling [%s%s]: %v", host, path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected [%s%s] response to be %d, but found %d", host, path, status, res.StatusCode)
+		}
+	}
+
+	hostsUrl := BASE_URL + "/api/workspaces/payments/hosts"
+	expectStatus(t, client, hostsUrl, "POST", routes.AddWorkspaceHostRequest{Host: "payments.mock.local:8081"}, http.StatusBadRequest)
+	expectStatus(t, client, hostsUrl, "POST", routes.AddWorkspaceHostRequest{Host: "Payments.Mock.Local"}, http.StatusCreated)
+	expectStatus(t, client, hostsUrl, "POST", routes.AddWorkspaceHostRequest{Host: "payments.mock.local"}, http.StatusConflict)
+
+	listHostsRes, err := sendRequest(client, hostsUrl, "GET", nil)
+	if err != nil {
+		t.Fatalf("Error listing hosts: %v", err)
+	}
+	defer listHostsRes.Body.Close()
+	var hosts []models.WorkspaceHost
+	if err := json.NewDecoder(listHostsRes.Body).Decode(&hosts); err != nil {
+		t.Fatalf("Failed to decode hosts: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Host != "payments.mock.local" {
+		t.Fatalf("expected the only host to be payments.mock.local, found %+v", hosts)
+	}
+
+	expectHostStatus("payments.mock.local:"+PORT, "/charges/ch_1", http.StatusOK)
+	expectHostStatus("payments.mock.local", "/refunds", http.StatusNotFound)
+	expectHostStatus("localhost:"+PORT, "/charges/ch_1", http.StatusNotFound)
+	expectHostStatus("localhost:"+PORT, "/sarab/payments/charges/ch_1", http.StatusOK)
+
+	expectStatus(t, client, hostsUrl+"/payments.mock.local", "DELETE", nil, http.StatusNoContent)
+	expectStatus(t, client, hostsUrl+"/payments.mock.local", "DELETE", nil, http.StatusNotFound)
+	expectHostStatus("payments.mock.local:"+PORT, "/charges/ch_1", http.StatusNotFound)
+
+	afterEach(t, app)
+}
+
+func TestWorkspacePorts(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	createWorkspaceRes, err := createWorkspace(client, "ledger", "served at its own port")
+	if err != nil {
+		t.Fatalf("Creating workspace failed: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{Path: "/entries", Method: "GET", Status: 200}
+	createMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/ledger/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	createMockRes.Body.Close()
+
+	expectClosed := func(port string) {
+		t.Helper()
+		if res, err := sendRequest(client, "http://localhost:"+port+"/entries", "GET", nil); err == nil {
+			res.Body.Close()
+			t.Fatalf("expected port %s to be closed, but it responded %d", port, res.StatusCode)
+		}
+	}
+
+	portUrl := BASE_URL + "/api/workspaces/ledger/port"
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 70000}, http.StatusBadRequest)
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 8081}, http.StatusConflict)
+	config.TlsPort, config.GrpcPort = "9443", "9090"
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9443}, http.StatusBadRequest)
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9090}, http.StatusBadRequest)
+	config.TlsPort, config.GrpcPort = "", ""
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9101}, http.StatusOK)
+	expectStatus(t, client, "http://localhost:9101/entries", "GET", nil, http.StatusOK)
+	expectStatus(t, client, "http://localhost:9101/sarab/ledger/entries", "GET", nil, http.StatusNotFound)
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "audit"}, http.StatusCreated)
+	if raw := expectStatus(t, client, BASE_URL+"/api/workspaces/audit/port", "PUT", routes.SetWorkspacePortRequest{Port: 9101}, http.StatusConflict); !strings.Contains(string(raw), "workspace [ledger]") {
+		t.Fatalf("expected the port to be refused as used by ledger, but found %s", raw)
+	}
+
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9102}, http.StatusOK)
+	expectStatus(t, client, "http://localhost:9102/entries", "GET", nil, http.StatusOK)
+	expectClosed("9101")
+
+	expectStatus(t, client, portUrl, "DELETE", nil, http.StatusNoContent)
+	expectClosed("9102")
+
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9103}, http.StatusOK)
+	afterEach(t, app)
+	expectClosed("9103")
+}
+
 func TestCreatingMock(t *testing.T) {
 
 	app := beforeEach()
@@ -204,8 +423,8 @@ func TestCreatingMock(t *testing.T) {
 	if routeResponse.Path != routesList[1].Id {
 		t.Fatalf("expected path id to be %v, but found %v", routesList[1].Id, routeResponse.Path)
 	}
-	if routeResponse.PathParams.Valid {
-		t.Fatalf("expected pathParams to be empty, but found %v", routeResponse.PathParams.String)
+	if routeResponse.PathParams != nil {
+		t.Fatalf("expected pathParams to be empty, but found %v", routeResponse.PathParams)
 	}
 	if routeResponse.Method != "GET" {
 		t.Fatalf("expected method to be GET, but found %s", routeResponse.Method)
@@ -267,7 +486,20 @@ func TestCreatingMock(t *testing.T) {
 	mockResponse := models.RouteResponse{
 		Method:     "GET",
 		Status:     400,
-		PathParams: sql.NullString{String: "resourceId: 42", Valid: true},
+		PathParams: models.PathParams{"resourceId": "42"},
+	}
+
+	invalidMockResponse := models.RouteResponse{
+		Method:     "GET",
+		Status:     404,
+		PathParams: models.PathParams{"unknownId": "42"},
+	}
+	resOfInvalidMockResponse, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks/"+fmt.Sprintf("%d", responses[0].DirectPathId), "POST", invalidMockResponse)
+	if err != nil {
+		t.Fatalf("error creating a mocked response with unknown param: %v", err)
+	}
+	if resOfInvalidMockResponse.StatusCode != 400 {
+		t.Fatalf("expected creating mocked response with unknown param status to be 400, but found %d", resOfInvalidMockResponse.StatusCode)
 	}
 
 	resOfCreateMockResponse, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks/"+fmt.Sprintf("%d", responses[0].DirectPathId), "POST", mockResponse)
@@ -281,6 +513,23 @@ func TestCreatingMock(t *testing.T) {
 
 	// database.Db.Exec("VACUUM INTO 'test.db'")
 
+	getMocksWithVariantRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "GET", nil)
+	if err != nil {
+		t.Fatalf("error fetching mocks: %v", err)
+	}
+	defer getMocksWithVariantRes.Body.Close()
+
+	var responsesWithVariant []routes.GetMocksResponse
+	if err := json.NewDecoder(getMocksWithVariantRes.Body).Decode(&responsesWithVariant); err != nil {
+		t.Fatalf("error decoding get mocks response: %v", err)
+	}
+	if len(responsesWithVariant) != 2 {
+		t.Fatalf("expected to get 2 mock responses, but found %d", len(responsesWithVariant))
+	}
+	if responsesWithVariant[1].PathParams["resourceId"] != "42" {
+		t.Fatalf("expected the second mock response to have resourceId path param 42, but found %v", responsesWithVariant[1].PathParams)
+	}
+
 	sarabRes, err := sendRequest(client, BASE_URL+"/sarab/"+workspaceId+"/resources/1", "GET", nil)
 	if err != nil {
 		t.Fatalf("error testing sarab response")
@@ -327,3 +576,186 @@ func assertRoute(route models.Route, path string, isParam, hasResponses bool, wo
 		t.Fatalf("expected paramName to be %v, but found %v", paramName, route.ParamName)
 	}
 }
+
+func TestWildcardMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	createWorkSpaceRes, err := createWorkspace(client, "wildcards", "wildcard and catch-all routes")
+	if err != nil {
+		t.Fatalf("Error creating workspace 'wildcards': %v", err)
+	}
+	defer createWorkSpaceRes.Body.Close()
+
+	location, err := createWorkSpaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+
+	mocks := []routes.CreateNewMockRequest{
+		{Path: "/static/**", Method: "GET", Status: 200},
+		{Path: "/static/*/logo", Method: "GET", Status: 201},
+		{Path: "/static/:version/logo", Method: "GET", Status: 202},
+		{Path: "/static/v1/logo", Method: "GET", Status: 203},
+	}
+	for _, mock := range mocks {
+		res, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", mock)
+		if err != nil {
+			t.Fatalf("Error creating mock [%s]: %v", mock.Path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 201 {
+			t.Fatalf("expected creating mock [%s] status to be 201, but found %d", mock.Path, res.StatusCode)
+		}
+	}
+
+	invalidMock := routes.CreateNewMockRequest{Path: "/static/**/logo", Method: "GET", Status: 200}
+	invalidRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", invalidMock)
+	if err != nil {
+		t.Fatalf("Error creating mock [%s]: %v", invalidMock.Path, err)
+	}
+	invalidRes.Body.Close()
+	if invalidRes.StatusCode != 400 {
+		t.Fatalf("expected catch-all in the middle of the path to be rejected with 400, but found %d", invalidRes.StatusCode)
+	}
+
+	expectations := map[string]int{
+		"/static/v1/logo":      203,
+		"/static/v2/logo":      202,
+		"/static/css/main.css": 200,
+		"/static":              200,
+	}
+	for path, status := range expectations {
+		sarabRes, err := sendRequest(client, BASE_URL+"/sarab/"+workspaceId+path, "GET", nil)
+		if err != nil {
+			t.Fatalf("error calling sarab [%s]: %v", path, err)
+		}
+		sarabRes.Body.Close()
+		if sarabRes.StatusCode != status {
+			t.Fatalf("expected [%s] response to be %d, but found %d", path, status, sarabRes.StatusCode)
+		}
+	}
+
+	afterEach(t, app)
+}
+
+func TestConstrainedParamMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	createWorkSpaceRes, err := createWorkspace(client, "orders", "orders with constrained ids")
+	if err != nil {
+		t.Fatalf("Error creating workspace 'orders': %v", err)
+	}
+	defer createWorkSpaceRes.Body.Close()
+
+	location, err := createWorkSpaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+
+	mocks := []routes.CreateNewMockRequest{
+		{Path: `/orders/:id(\d+)`, Method: "GET", Status: 200},
+		{Path: "/orders/:id<uuid>", Method: "GET", Status: 201},
+		{Path: "/orders/:id", Method: "GET", Status: 202},
+	}
+	for _, mock := range mocks {
+		res, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", mock)
+		if err != nil {
+			t.Fatalf("Error creating mock [%s]: %v", mock.Path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 201 {
+			t.Fatalf("expected creating mock [%s] status to be 201, but found %d", mock.Path, res.StatusCode)
+		}
+	}
+
+	for _, invalidPath := range []string{"/orders/:id<unknown>", `/orders/:id([0-9)`, `/orders/:id(\d+)|(x)`} {
+		invalidMock := routes.CreateNewMockRequest{Path: invalidPath, Method: "GET", Status: 200}
+		invalidRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", invalidMock)
+		if err != nil {
+			t.Fatalf("Error creating mock [%s]: %v", invalidPath, err)
+		}
+		invalidRes.Body.Close()
+		if invalidRes.StatusCode != 400 {
+			t.Fatalf("expected mock [%s] to be rejected with 400, but found %d", invalidPath, invalidRes.StatusCode)
+		}
+	}
+
+	expectations := map[string]int{
+		"/orders/42": 200,
+		"/orders/0b6f9c3e-5d0a-4c52-9a53-2f1f0b7c6d11": 201,
+		"/orders/latest": 202,
+	}
+	for path, status := range expectations {
+		sarabRes, err := sendRequest(client, BASE_URL+"/sarab/"+workspaceId+path, "GET", nil)
+		if err != nil {
+			t.Fatalf("error calling sarab [%s]: %v", path, err)
+		}
+		sarabRes.Body.Close()
+		if sarabRes.StatusCode != status {
+			t.Fatalf("expected [%s] response to be %d, but found %d", path, status, sarabRes.StatusCode)
+		}
+	}
+
+	afterEach(t, app)
+}
+
+func TestMockMethodsOnSamePath(t *testing.T) {
+
+	for _, memoryStorage := range []bool{false, true} {
+		config.MemoryStorage = memoryStorage
+		app := beforeEach()
+
+		client := &http.Client{}
+		createWorkSpaceRes, err := createWorkspace(client, "methods", "several methods on the same path")
+		if err != nil {
+			t.Fatalf("Error creating workspace 'methods': %v", err)
+		}
+		createWorkSpaceRes.Body.Close()
+
+		mocks := []struct {
+			mock   routes.CreateNewMockRequest
+			status int
+		}{
+			{routes.CreateNewMockRequest{Path: "/users", Method: "GET", Status: 200}, 201},
+			{routes.CreateNewMockRequest{Path: "/users", Method: "POST", Status: 201}, 201},
+			{routes.CreateNewMockRequest{Path: "/a/b", Method: "GET", Status: 200}, 201},
+			{routes.CreateNewMockRequest{Path: "/a/b", Method: "POST", Status: 201}, 201},
+			{routes.CreateNewMockRequest{Path: "/a/b", Method: "POST", Status: 202}, 409},
+		}
+		for _, expected := range mocks {
+			res, err := sendRequest(client, BASE_URL+"/api/workspaces/methods/mocks", "POST", expected.mock)
+			if err != nil {
+				t.Fatalf("Error creating mock [%s %s]: %v", expected.mock.Method, expected.mock.Path, err)
+			}
+			res.Body.Close()
+			if res.StatusCode != expected.status {
+				t.Fatalf("expected creating mock [%s %s] with the memory storage %t to be %d, but found %d",
+					expected.mock.Method, expected.mock.Path, memoryStorage, expected.status, res.StatusCode)
+			}
+		}
+
+		for _, path := range []string{"/users", "/a/b"} {
+			for method, status := range map[string]int{"GET": 200, "POST": 201} {
+				sarabRes, err := sendRequest(client, BASE_URL+"/sarab/methods"+path, method, nil)
+				if err != nil {
+					t.Fatalf("error calling sarab [%s %s]: %v", method, path, err)
+				}
+				sarabRes.Body.Close()
+				if sarabRes.StatusCode != status {
+					t.Fatalf("expected [%s %s] response to be %d, but found %d", method, path, status, sarabRes.StatusCode)
+				}
+			}
+		}
+
+		afterEach(t, app)
+	}
+	config.MemoryStorage = false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"moksarab/config"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApiKeyAuthentication(t *testing.T) {
+
+	const adminKey = "bootstrap-admin-key"
+	config.AdminApiKey = adminKey
+	defer func() { config.AdminApiKey = "" }()
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	workspace := models.Workspace{Name: "secured", Description: "needs API keys"}
+	expectStatusWithApiKey(t, client, BASE_URL+"/api/workspaces", "POST", workspace, "", http.StatusUnauthorized)
+	expectStatusWithApiKey(t, client, BASE_URL+"/api/workspaces", "POST", workspace, "not-a-key", http.StatusUnauthorized)
+	createWorkspaceRes, err := sendRequestWithApiKey(client, BASE_URL+"/api/workspaces", "POST", workspace, adminKey)
+	if err != nil {
+		t.Fatalf("Error creating workspace: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	location, err := createWorkspaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+	var workspaceIdNumber int64
+	fmt.Sscan(workspaceId, &workspaceIdNumber)
+
+	createKey := func(apiKey models.ApiKey) routes.CreateApiKeyResponse {
+		t.Helper()
+		var created routes.CreateApiKeyResponse
+		if err := json.Unmarshal(expectStatusWithApiKey(t, client, BASE_URL+"/api/keys", "POST", apiKey, adminKey, http.StatusCreated), &created); err != nil {
+			t.Fatalf("error decoding created API key: %v", err)
+		}
+		return created
+	}
+	editor := createKey(models.ApiKey{Name: "editor", Role: models.RoleEditor, Workspaces: models.WorkspaceIds{workspaceIdNumber}})
+	otherEditor := createKey(models.ApiKey{Name: "other-editor", Role: models.RoleEditor, Workspaces: models.WorkspaceIds{workspaceIdNumber + 1}})
+	viewer := createKey(models.ApiKey{Name: "viewer", Role: models.RoleViewer, Workspaces: models.WorkspaceIds{workspaceIdNumber}})
+	unscopedEditor := createKey(models.ApiKey{Name: "unscoped-editor", Role: models.RoleEditor})
+
+	mocksUrl := BASE_URL + "/api/workspaces/" + workspaceId + "/mocks"
+	newMock := routes.CreateNewMockRequest{Path: "/accounts", Method: "GET", Status: 200}
+
+	expectStatusWithApiKey(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "by-editor"}, editor.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, mocksUrl, "POST", newMock, otherEditor.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, mocksUrl, "POST", newMock, viewer.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, mocksUrl, "POST", newMock, unscopedEditor.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, mocksUrl, "GET", nil, unscopedEditor.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, mocksUrl, "POST", newMock, editor.Key, http.StatusCreated)
+	expectStatusWithApiKey(t, client, mocksUrl, "GET", nil, viewer.Key, http.StatusOK)
+	expectStatusWithApiKey(t, client, BASE_URL+"/api/keys", "GET", nil, editor.Key, http.StatusForbidden)
+	portUrl := BASE_URL + "/api/workspaces/" + workspaceId + "/port"
+	expectStatusWithApiKey(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9104}, editor.Key, http.StatusForbidden)
+	expectStatusWithApiKey(t, client, portUrl, "DELETE", nil, editor.Key, http.StatusForbidden)
+
+	var listedKeys []map[string]any
+	if err := json.Unmarshal(expectStatusWithApiKey(t, client, BASE_URL+"/api/keys", "GET", nil, adminKey, http.StatusOK), &listedKeys); err != nil {
+		t.Fatalf("error decoding API keys: %v", err)
+	}
+	if len(listedKeys) != 4 {
+		t.Fatalf("expected 4 API keys, but found %d", len(listedKeys))
+	}
+	for _, listedKey := range listedKeys {
+		if _, found := listedKey["key"]; found {
+			t.Fatalf("expected listed API keys to never include the key, but found %v", listedKey)
+		}
+	}
+
+	expectStatusWithApiKey(t, client, BASE_URL+"/api/keys/"+fmt.Sprint(viewer.Id), "DELETE", nil, adminKey, http.StatusNoContent)
+	expectStatusWithApiKey(t, client, mocksUrl, "GET", nil, viewer.Key, http.StatusUnauthorized)
+
+	// the mock endpoints themselves are not protected by API keys
+	expectStatusWithApiKey(t, client, BASE_URL+"/sarab/"+workspaceId+"/accounts", "GET", nil, "", http.StatusOK)
+
+	afterEach(t, app)
+}
+
+func TestWorkspaceAccessToken(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	createWorkSpaceRes, err := createWorkspace(client, "private", "needs an access token")
+	if err != nil {
+		t.Fatalf("Error creating workspace: %v", err)
+	}
+	defer createWorkSpaceRes.Body.Close()
+
+	location, err := createWorkSpaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+
+	newMock := routes.CreateNewMockRequest{Path: "/balance", Method: "GET", Status: 200}
+	createNewMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", newMock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	createNewMockRes.Body.Close()
+
+	callSarab := func(token string, inQuery bool) int {
+		t.Helper()
+		url := BASE_URL + "/sarab/" + workspaceId + "/balance"
+		if inQuery {
+			url += "?sarab_token=" + token
+		}
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("error creating sarab request: %v", err)
+		}
+		if token != "" && !inQuery {
+			req.Header.Set("X-Sarab-Token", token)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("error calling sarab: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := callSarab("", false); status != http.StatusOK {
+		t.Fatalf("expected workspace without token to be open, but found %d", status)
+	}
+
+	rotate := func() string {
+		t.Helper()
+		res, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/token", "POST", nil)
+		if err != nil {
+			t.Fatalf("error rotating access token: %v", err)
+		}
+		defer res.Body.Close()
+		var rotated routes.RotateWorkspaceAccessTokenResponse
+		if err := json.NewDecoder(res.Body).Decode(&rotated); err != nil {
+			t.Fatalf("error decoding rotated access token: %v", err)
+		}
+		return rotated.AccessToken
+	}
+
+	firstToken := rotate()
+	if status := callSarab("", false); status != http.StatusUnauthorized {
+		t.Fatalf("expected request without token to be 401, but found %d", status)
+	}
+	if status := callSarab(firstToken, false); status != http.StatusOK {
+		t.Fatalf("expected request with token header to be 200, but found %d", status)
+	}
+	if status := callSarab(firstToken, true); status != http.StatusOK {
+		t.Fatalf("expected request with token query param to be 200, but found %d", status)
+	}
+
+	secondToken := rotate()
+	if status := callSarab(firstToken, false); status != http.StatusUnauthorized {
+		t.Fatalf("expected request with rotated out token to be 401, but found %d", status)
+	}
+	if status := callSarab(secondToken, false); status != http.StatusOK {
+		t.Fatalf("expected request with the new token to be 200, but found %d", status)
+	}
+
+	deleteRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/token", "DELETE", nil)
+	if err != nil {
+		t.Fatalf("error deleting access token: %v", err)
+	}
+	deleteRes.Body.Close()
+	if status := callSarab("", false); status != http.StatusOK {
+		t.Fatalf("expected workspace to be open again after deleting its token, but found %d", status)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallbacks(t *testing.T) {
+
+	app := beforeEach()
+
+	// the target fails the first delivery, so the callback is retried
+	type delivery struct {
+		path    string
+		header  string
+		body    string
+		arrived time.Time
+	}
+	deliveries := make(chan delivery, 10)
+	var attempts atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.URL.Path, r.Header.Get("X-Amount"), string(body), time.Now()}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	client := &http.Client{}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "payments"}, http.StatusCreated)
+	expectStatus(t, client, BASE_URL+"/api/workspaces/payments/mocks", "POST", routes.CreateNewMockRequest{
+		Path: "/charges/:id", Method: "POST", Status: 202,
+	}, http.StatusCreated)
+	var mocks []models.Mock
+	if err := json.Unmarshal(expectStatus(t, client, BASE_URL+"/api/workspaces/payments/mocks", "GET", nil, http.StatusOK), &mocks); err != nil {
+		t.Fatalf("error decoding the mocks: %v", err)
+	}
+
+	callbacksUrl := BASE_URL + "/api/workspaces/payments/callbacks"
+	expectStatus(t, client, callbacksUrl, "POST", routes.CreateCallbackRequest{ResponseId: mocks[0].ResponseId, Url: "ftp://example.com"}, http.StatusBadRequest)
+	expectStatus(t, client, callbacksUrl, "POST", routes.CreateCallbackRequest{ResponseId: mocks[0].ResponseId, Url: target.URL, Body: "{{.Json"}, http.StatusBadRequest)
+	expectStatus(t, client, callbacksUrl, "POST", routes.CreateCallbackRequest{ResponseId: mocks[0].ResponseId, Url: target.URL, MaxAttempts: 11}, http.StatusBadRequest)
+	expectStatus(t, client, callbacksUrl, "POST", routes.CreateCallbackRequest{ResponseId: mocks[0].ResponseId + 100, Url: target.URL}, http.StatusBadRequest)
+	expectStatus(t, client, callbacksUrl, "POST", routes.CreateCallbackRequest{
+		ResponseId:   mocks[0].ResponseId,
+		Url:          target.URL + "/webhooks/{{.PathParams.id}}",
+		Headers:      models.StringMap{"X-Amount": "{{.Json.amount}}", "Content-Type": "application/json"},
+		Body:         `{"charge":"{{.PathParams.id}}","status":"succeeded","reference":{{json .Json.reference}}}`,
+		DelayMs:      200,
+		RetryDelayMs: 50,
+	}, http.StatusCreated)
+
+	start := time.Now()
+	expectStatus(t, client, BASE_URL+"/sarab/payments/charges/ch_1", "POST", map[string]any{"amount": 42, "reference": "order-7"}, http.StatusAccepted)
+	var received []delivery
+	for len(received) < 2 {
+		select {
+		case d := <-deliveries:
+			received = append(received, d)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the callback and its retry, but found %+v", received)
+		}
+	}
+	if received[0].arrived.Sub(start) < 200*time.Millisecond {
+		t.Fatalf("expected the callback after its delay, but it arrived after %v", received[0].arrived.Sub(start))
+	}
+	if received[1].path != "/webhooks/ch_1" || received[1].header != "42" ||
+		received[1].body != `{"charge":"ch_1","status":"succeeded","reference":"order-7"}` {
+		t.Fatalf("unexpected callback %+v", received[1])
+	}
+
+	// the retry is recorded right after it is answered
+	var entries []models.JournalEntry
+	for deadline := time.Now().Add(2 * time.Second); len(entries) < 2 && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		entries = nil
+		if err := json.Unmarshal(expectStatus(t, client, BASE_URL+"/api/workspaces/payments/journal?protocol=callback", "GET", nil, http.StatusOK), &entries); err != nil {
+			t.Fatalf("error decoding the journal: %v", err)
+		}
+	}
+	if len(entries) != 2 || entries[0].Attempt != 1 || entries[0].Status != 503 || entries[0].Error == "" ||
+		entries[1].Attempt != 2 || entries[1].Status != 204 || entries[1].Error != "" || entries[1].Path != target.URL+"/webhooks/ch_1" {
+		t.Fatalf("expected both delivery attempts in the journal, but found %+v", entries)
+	}
+
+	var callbacks []models.Callback
+	if err := json.Unmarshal(expectStatus(t, client, callbacksUrl, "GET", nil, http.StatusOK), &callbacks); err != nil {
+		t.Fatalf("error decoding the callbacks: %v", err)
+	}
+	if len(callbacks) != 1 || callbacks[0].Method != "POST" || callbacks[0].MaxAttempts != 3 {
+		t.Fatalf("expected the callback with its defaults, but found %+v", callbacks)
+	}
+	expectStatus(t, client, callbacksUrl+"/"+strconv.FormatInt(callbacks[0].Id, 10), "DELETE", nil, http.StatusNoContent)
+	expectStatus(t, client, callbacksUrl+"/"+strconv.FormatInt(callbacks[0].Id, 10), "DELETE", nil, http.StatusNotFound)
+
+	afterEach(t, app)
+}
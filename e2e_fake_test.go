@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFakeDataResponses(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	seed := int64(42)
+	template := func(body string) *string { return &body }
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "fakes"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/fakes/mocks"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/typo", Method: "GET", Status: 200, Templated: true, ResponseBody: template(`{{fake "person.nmae"}}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/shape", Method: "GET", Status: 200, Templated: true, ResponseBody: template(`{{generate 2 "{\"name\":"}}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/many", Method: "GET", Status: 200, Templated: true, ResponseBody: template(`{{generate 1000000 "{}"}}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/static", Method: "GET", Status: 200, Seed: &seed, ResponseBody: template(`{}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/empty", Method: "GET", Status: 200, Templated: true,
+	}, http.StatusBadRequest)
+
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/customers", Method: "GET", Status: 200, Templated: true, Seed: &seed,
+		ResponseBody: template("{\"company\":{{fake \"company.name\" | json}},\"customers\":" +
+			"{{generate 3 `{\"id\":\"id.uuid\",\"name\":\"gulf.name\",\"iban\":\"sa.iban\",\"nationalId\":\"sa.nationalId\",\"tier\":\"gold\",\"active\":true}`}}}"),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/random", Method: "GET", Status: 200, Templated: true, ResponseBody: template(`{{fake "id.uuid"}}`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/dates", Method: "GET", Status: 200, Templated: true, Seed: &seed, ResponseBody: template(`{{fake "date.past"}}`),
+	}, http.StatusCreated)
+
+	// the seed gives the same data on every call
+	first := string(expectStatus(t, client, BASE_URL+"/sarab/fakes/customers", "GET", nil, http.StatusOK))
+	if second := string(expectStatus(t, client, BASE_URL+"/sarab/fakes/customers", "GET", nil, http.StatusOK)); second != first {
+		t.Fatalf("expected the same data for the same seed, but found %s and %s", first, second)
+	}
+	var generated struct {
+		Company   string `json:"company"`
+		Customers []struct {
+			Id         string `json:"id"`
+			Name       string `json:"name"`
+			Iban       string `json:"iban"`
+			NationalId string `json:"nationalId"`
+			Tier       string `json:"tier"`
+			Active     bool   `json:"active"`
+		} `json:"customers"`
+	}
+	if err := json.Unmarshal([]byte(first), &generated); err != nil {
+		t.Fatalf("expected the generated body to be JSON, but found %s: %v", first, err)
+	}
+	if generated.Company == "" || len(generated.Customers) != 3 {
+		t.Fatalf("expected a company and 3 customers, but found %s", first)
+	}
+	nationalId := regexp.MustCompile(`^1\d{9}$`)
+	for _, customer := range generated.Customers {
+		if len(customer.Id) != 36 || customer.Name == "" || customer.Tier != "gold" || !customer.Active ||
+			!nationalId.MatchString(customer.NationalId) || !validIban(customer.Iban, "SA", 24) {
+			t.Fatalf("unexpected customer in %s", first)
+		}
+	}
+	if !strings.Contains(first, `"customers":[{"id":"`) || strings.Index(first, `"iban"`) > strings.Index(first, `"tier"`) {
+		t.Fatalf("expected the fields in the order of the shape, but found %s", first)
+	}
+
+	// the seeded dates count from a fixed day, not from the current one
+	if date := string(expectStatus(t, client, BASE_URL+"/sarab/fakes/dates", "GET", nil, http.StatusOK)); !strings.HasPrefix(date, "2024-") {
+		t.Fatalf("expected a seeded date in the year before 2025-01-01, but found %s", date)
+	}
+
+	if bytes.Equal(expectStatus(t, client, BASE_URL+"/sarab/fakes/random", "GET", nil, http.StatusOK), expectStatus(t, client, BASE_URL+"/sarab/fakes/random", "GET", nil, http.StatusOK)) {
+		t.Fatalf("expected fresh data on every call without a seed")
+	}
+
+	var mocks []models.Mock
+	if err := json.Unmarshal(expectStatus(t, client, mocksUrl, "GET", nil, http.StatusOK), &mocks); err != nil {
+		t.Fatalf("error decoding the mocks: %v", err)
+	}
+	if len(mocks) != 3 || !mocks[0].Templated || mocks[0].Seed == nil || *mocks[0].Seed != seed || !mocks[1].Templated || mocks[1].Seed != nil {
+		t.Fatalf("expected the templated mocks with their seed, but found %+v", mocks)
+	}
+
+	afterEach(t, app)
+}
+
+// validIban checks the length and the ISO 13616 check digits of the IBAN.
+func validIban(iban string, country string, length int) bool {
+	if len(iban) != length || !strings.HasPrefix(iban, country) {
+		return false
+	}
+	var digits strings.Builder
+	for _, char := range iban[4:] + iban[:4] {
+		if char >= 'A' && char <= 'Z' {
+			digits.WriteString(big.NewInt(int64(char-'A') + 10).String())
+		} else {
+			digits.WriteRune(char)
+		}
+	}
+	number, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(number, big.NewInt(97)).Int64() == 1
+}
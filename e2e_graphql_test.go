@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testGraphqlSdl = `
+	type Query {
+		user(id: ID!): User
+		search(term: String!): [SearchResult!]!
+	}
+	type Mutation {
+		rename(id: ID!, name: String!): User!
+	}
+	interface Node { id: ID! }
+	type User implements Node {
+		id: ID!
+		name: String!
+		age: Int
+		role: Role!
+		friends: [User!]!
+	}
+	type Post implements Node {
+		id: ID!
+		title: String!
+	}
+	union SearchResult = User | Post
+	enum Role { ADMIN MEMBER }
+`
+
+func TestGraphqlMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	graphql := func(query, operationName string, variables map[string]any, status int) map[string]any {
+		t.Helper()
+		res, err := sendRequest(client, BASE_URL+"/sarab/api/graphql", "POST", map[string]any{
+			"query": query, "operationName": operationName, "variables": variables,
+		})
+		if err != nil {
+			t.Fatalf("error sending GraphQL request: %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected GraphQL status %d, but found %d", status, res.StatusCode)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding GraphQL response: %v", err)
+		}
+		return body
+	}
+	expectBody := func(body map[string]any, expected string) {
+		t.Helper()
+		var expectedBody map[string]any
+		if err := json.Unmarshal([]byte(expected), &expectedBody); err != nil {
+			t.Fatalf("invalid expected body: %v", err)
+		}
+		if !reflect.DeepEqual(body, expectedBody) {
+			actual, _ := json.Marshal(body)
+			t.Fatalf("expected GraphQL response %s, but found %s", expected, actual)
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "api"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/api/graphql/mocks"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGraphqlMockRequest{OperationType: "fetch"}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", map[string]any{"errors": map[string]string{"message": "not a list"}}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGraphqlMockRequest{
+		OperationName: "GetUser",
+		Data:          models.JsonValue(`{"user":{"id":"1","name":"Alice"}}`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGraphqlMockRequest{
+		OperationName: "GetUser",
+		Variables:     models.JsonObject{"id": "404"},
+		Data:          models.JsonValue(`{"user":null}`),
+		Errors:        models.JsonValue(`[{"message":"user not found"}]`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGraphqlMockRequest{
+		OperationName: "GetUser",
+		Variables:     models.JsonObject{"id": "404"},
+	}, http.StatusConflict)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGraphqlMockRequest{
+		OperationType: "mutation",
+		Status:        500,
+		Errors:        models.JsonValue(`[{"message":"read only"}]`),
+	}, http.StatusCreated)
+
+	userQuery := `query GetUser($id: ID!) { user(id: $id) { id name } }`
+	expectBody(graphql(userQuery, "", map[string]any{"id": "1"}, 200), `{"data":{"user":{"id":"1","name":"Alice"}}}`)
+	expectBody(graphql(userQuery, "", map[string]any{"id": "404"}, 200), `{"data":{"user":null},"errors":[{"message":"user not found"}]}`)
+	expectBody(graphql(`mutation Rename { rename(id: "1", name: "Bob") { id } }`, "", nil, 500), `{"data":null,"errors":[{"message":"read only"}]}`)
+	graphql(`query { user(id: "1") { id }`, "", nil, http.StatusBadRequest)
+	graphql(`query A { user(id: "1") { id } } query B { user(id: "2") { id } }`, "", nil, http.StatusBadRequest)
+	// without a schema, an operation no mock matches is left to the path mocks
+	expectStatus(t, client, BASE_URL+"/sarab/api/graphql", "POST", map[string]any{"query": `query Other { user(id: "1") { id } }`}, http.StatusNotFound)
+
+	schemaUrl := BASE_URL + "/api/workspaces/api/graphql/schema"
+	expectStatus(t, client, schemaUrl, "GET", nil, http.StatusNotFound)
+	expectStatus(t, client, schemaUrl, "PUT", routes.SetGraphqlSchemaRequest{Sdl: "type Query { user: Missing }"}, http.StatusBadRequest)
+	expectStatus(t, client, schemaUrl, "PUT", routes.SetGraphqlSchemaRequest{Sdl: testGraphqlSdl}, http.StatusOK)
+	expectStatus(t, client, schemaUrl, "GET", nil, http.StatusOK)
+
+	// the fields the mock leaves out are generated from the schema
+	expectBody(graphql(`query GetUser($id: ID!) { user(id: $id) { id name role friends { name } } }`, "", map[string]any{"id": "1"}, 200),
+		`{"data":{"user":{"id":"1","name":"Alice","role":"ADMIN","friends":[{"name":"name"}]}}}`)
+	expectBody(graphql(`query Search { search(term: "a") { __typename ... on Post { title } ...UserFields } } fragment UserFields on User { id age }`, "Search", nil, 200),
+		`{"data":{"search":[{"__typename":"User","id":"1","age":1}]}}`)
+	body := graphql(`query { user(id: "1") { email } }`, "", nil, http.StatusBadRequest)
+	if errs, _ := body["errors"].([]any); len(errs) == 0 {
+		t.Fatalf("expected validation errors, but found %v", body)
+	}
+
+	getMocksRes, err := sendRequest(client, mocksUrl, "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting GraphQL mocks: %v", err)
+	}
+	var mocks []models.GraphqlMock
+	if err := json.NewDecoder(getMocksRes.Body).Decode(&mocks); err != nil {
+		t.Fatalf("error decoding GraphQL mocks: %v", err)
+	}
+	getMocksRes.Body.Close()
+	if len(mocks) != 3 || mocks[0].Path != "/graphql" || mocks[0].Status != 200 {
+		t.Fatalf("unexpected GraphQL mocks: %+v", mocks)
+	}
+	expectStatus(t, client, fmt.Sprintf("%s/%d", mocksUrl, mocks[2].Id), "DELETE", nil, http.StatusNoContent)
+	expectBody(graphql(`mutation { rename(id: "1", name: "Bob") { id name } }`, "", nil, 200), `{"data":{"rename":{"id":"1","name":"name"}}}`)
+
+	afterEach(t, app)
+}
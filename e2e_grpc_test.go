@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"moksarab/config"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const GRPC_PORT = "9090"
+
+const testOrdersProto = `
+	syntax = "proto3";
+	package shop;
+
+	import "google/protobuf/timestamp.proto";
+	import "common/money.proto";
+
+	service Orders {
+		rpc GetOrder(GetOrderRequest) returns (Order);
+		rpc WatchOrders(GetOrderRequest) returns (stream Order);
+	}
+	message GetOrderRequest {
+		string id = 1;
+		bool include_items = 2;
+	}
+	message Order {
+		string id = 1;
+		common.Money total = 2;
+		google.protobuf.Timestamp created_at = 3;
+		repeated string items = 4;
+	}
+`
+
+const testMoneyProto = `
+	syntax = "proto3";
+	package common;
+
+	message Money {
+		string currency = 1;
+		int64 units = 2;
+	}
+`
+
+func TestGrpcMocks(t *testing.T) {
+
+	config.GrpcPort = GRPC_PORT
+	defer func() { config.GrpcPort = "" }()
+
+	app := beforeEach()
+	if err := listenGrpc(app); err != nil {
+		t.Fatalf("error serving gRPC: %v", err)
+	}
+
+	client := &http.Client{}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "shop"}, http.StatusCreated)
+	schemaUrl := BASE_URL + "/api/workspaces/shop/grpc/schema"
+	mocksUrl := BASE_URL + "/api/workspaces/shop/grpc/mocks"
+	expectStatus(t, client, schemaUrl, "PUT", routes.SetGrpcSchemaRequest{Files: map[string]string{"shop/orders.proto": testOrdersProto}}, http.StatusBadRequest)
+	expectStatus(t, client, schemaUrl, "PUT", routes.SetGrpcSchemaRequest{DescriptorSet: []byte("not a descriptor set")}, http.StatusBadRequest)
+	raw := expectStatus(t, client, schemaUrl, "PUT", routes.SetGrpcSchemaRequest{Files: map[string]string{
+		"shop/orders.proto":  testOrdersProto,
+		"common/money.proto": testMoneyProto,
+	}}, http.StatusOK)
+	var schema routes.GrpcSchemaResponse
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("error decoding the gRPC schema: %v", err)
+	}
+	if len(schema.Methods) != 2 || schema.Methods[0] != "shop.Orders/GetOrder" {
+		t.Fatalf("unexpected gRPC schema methods %v", schema.Methods)
+	}
+
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{Service: "shop.Orders", Method: "WatchOrders"}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{Service: "shop.Carts", Method: "GetCart"}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{
+		Service: "shop.Orders", Method: "GetOrder", Match: models.JsonObject{"order_id": "42"},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{
+		Service: "shop.Orders", Method: "GetOrder", Response: models.JsonValue(`{"total":"ten"}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", map[string]any{"service": "shop.Orders", "method": "GetOrder", "code": 42}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{
+		Service: "shop.Orders", Method: "GetOrder",
+		Response: models.JsonValue(`{"id":"any","total":{"currency":"EUR","units":"10"}}`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateGrpcMockRequest{
+		Service: "shop.Orders", Method: "GetOrder", Match: models.JsonObject{"id": "42", "include_items": true},
+		Response: models.JsonValue(`{"id":"42","createdAt":"2024-01-01T00:00:00Z","items":["book"]}`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", map[string]any{
+		"service": "shop.Orders", "method": "GetOrder", "match": map[string]any{"id": "404"},
+		"code": "NOT_FOUND", "message": "order not found",
+	}, http.StatusCreated)
+	expectStatus(t, client, BASE_URL+"/api/workspaces/shop/journal", "DELETE", nil, http.StatusNoContent)
+
+	// the client messages are built from the descriptors of the schema
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(schema.DescriptorSet, &set); err != nil {
+		t.Fatalf("error decoding the descriptor set: %v", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		t.Fatalf("error loading the descriptor set: %v", err)
+	}
+	findMessage := func(name string) protoreflect.MessageDescriptor {
+		t.Helper()
+		descriptor, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			t.Fatalf("error finding %s: %v", name, err)
+		}
+		return descriptor.(protoreflect.MessageDescriptor)
+	}
+	requestType, orderType := findMessage("shop.GetOrderRequest"), findMessage("shop.Order")
+
+	conn, err := grpc.NewClient("localhost:"+GRPC_PORT, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("error connecting to the gRPC port: %v", err)
+	}
+	defer conn.Close()
+	getOrder := func(workspace string, method string, id string, includeItems bool) (*dynamicpb.Message, error) {
+		t.Helper()
+		request := dynamicpb.NewMessage(requestType)
+		request.Set(requestType.Fields().ByName("id"), protoreflect.ValueOfString(id))
+		request.Set(requestType.Fields().ByName("include_items"), protoreflect.ValueOfBool(includeItems))
+		order := dynamicpb.NewMessage(orderType)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-sarab-workspace", workspace)
+		return order, conn.Invoke(ctx, "/shop.Orders/"+method, request, order)
+	}
+	expectCode := func(err error, code codes.Code) {
+		t.Helper()
+		if status.Code(err) != code {
+			t.Fatalf("expected the call to end with %s, but found %v", code, err)
+		}
+	}
+
+	order, err := getOrder("shop", "GetOrder", "42", true)
+	expectCode(err, codes.OK)
+	if items := order.Get(orderType.Fields().ByName("items")).List(); items.Len() != 1 || items.Get(0).String() != "book" {
+		t.Fatalf("expected the order 42 with its items, but found %v", order)
+	}
+	if seconds := order.Get(orderType.Fields().ByName("created_at")).Message().Get(findMessage("google.protobuf.Timestamp").Fields().ByName("seconds")).Int(); seconds != 1704067200 {
+		t.Fatalf("expected the order 42 created on 2024-01-01, but found %d", seconds)
+	}
+	// without include_items, the mock of the order 42 doesn't match
+	order, err = getOrder("shop", "GetOrder", "42", false)
+	expectCode(err, codes.OK)
+	total := order.Get(orderType.Fields().ByName("total")).Message()
+	if order.Get(orderType.Fields().ByName("id")).String() != "any" || total.Get(total.Descriptor().Fields().ByName("units")).Int() != 10 {
+		t.Fatalf("expected the generic order, but found %v", order)
+	}
+	_, err = getOrder("shop", "GetOrder", "404", false)
+	expectCode(err, codes.NotFound)
+	if status.Convert(err).Message() != "order not found" {
+		t.Fatalf("expected the mocked status message, but found %v", err)
+	}
+	_, err = getOrder("shop", "GetInvoice", "1", false)
+	expectCode(err, codes.Unimplemented)
+	_, err = getOrder("missing", "GetOrder", "1", false)
+	expectCode(err, codes.NotFound)
+
+	var entries []models.JournalEntry
+	if err := json.Unmarshal(expectStatus(t, client, BASE_URL+"/api/workspaces/shop/journal?protocol=grpc", "GET", nil, http.StatusOK), &entries); err != nil {
+		t.Fatalf("error decoding the journal: %v", err)
+	}
+	if len(entries) != 4 || entries[0].Path != "/shop.Orders/GetOrder" || entries[0].Message != `{"id":"42","include_items":true}` ||
+		entries[2].Status != int(codes.NotFound) || entries[3].Status != int(codes.Unimplemented) {
+		t.Fatalf("expected the gRPC calls of the workspace in the journal, but found %+v", entries)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// signTestJwt signs the claims with HS256.
+func signTestJwt(secret string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJwtMatchers(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	expectBearerStatus := func(url, token string, status int) {
+		t.Helper()
+		// sendRequest sends the token as an API key, so it is set here instead
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("error sending GET %s: %v", url, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected GET %s to be %d, but found %d", url, status, res.StatusCode)
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "api"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/api/mocks"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/orders", Method: "GET", Status: 200,
+		Matchers: models.Matchers{{Type: models.JwtMatcher, Secret: "s3cret", Scope: "orders:read"}},
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/orders", Method: "GET", Status: 200,
+		Matchers: models.Matchers{{Type: models.JwtMatcher, Secret: "s3cret", JwksUrl: "http://localhost/jwks"}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/orders", Method: "GET", Status: 200,
+		Matchers: models.Matchers{{Type: models.JwtMatcher, JwksUrl: "file:///etc/jwks"}},
+	}, http.StatusBadRequest)
+
+	res, err := sendRequest(client, mocksUrl, "GET", nil)
+	if err != nil {
+		t.Fatalf("Error getting mocks: %v", err)
+	}
+	var mocks []routes.GetMocksResponse
+	if err := json.NewDecoder(res.Body).Decode(&mocks); err != nil {
+		t.Fatalf("Failed to decode mocks: %v", err)
+	}
+	res.Body.Close()
+	mockUrl := fmt.Sprintf("%s/%d", mocksUrl, mocks[0].DirectPathId)
+	bySubject := models.RouteResponse{Method: "GET", Status: 202, Matchers: models.Matchers{{Type: models.JwtMatcher, Secret: "s3cret", Subject: "svc-billing", Audience: "orders-api"}}}
+	expectStatus(t, client, mockUrl, "POST", bySubject, http.StatusCreated)
+
+	ordersUrl := BASE_URL + "/sarab/api/orders"
+	exp := time.Now().Add(time.Hour).Unix()
+	expectStatus(t, client, ordersUrl, "GET", nil, http.StatusUnauthorized)
+	expectBearerStatus(ordersUrl, "not-a-jwt", http.StatusUnauthorized)
+	expectBearerStatus(ordersUrl, signTestJwt("wrong", map[string]any{"sub": "svc-billing", "exp": exp}), http.StatusUnauthorized)
+	expectBearerStatus(ordersUrl, signTestJwt("s3cret", map[string]any{"sub": "svc-billing", "exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized)
+	expectBearerStatus(ordersUrl, signTestJwt("s3cret", map[string]any{"sub": "svc-billing", "aud": []string{"orders-api"}, "exp": exp}), 202)
+	expectBearerStatus(ordersUrl, signTestJwt("s3cret", map[string]any{"sub": "svc-shipping", "scope": "orders:read orders:write", "exp": exp}), 200)
+	// a valid token matching no response falls through to a not found
+	expectBearerStatus(ordersUrl, signTestJwt("s3cret", map[string]any{"sub": "svc-shipping", "exp": exp}), http.StatusNotFound)
+
+	// an oidc workspace issues the tokens verified with its JWKS
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "idp", Type: models.OidcWorkspace}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/invoices", Method: "GET", Status: 200,
+		Matchers: models.Matchers{{Type: models.JwtMatcher, JwksUrl: BASE_URL + "/sarab/idp/jwks", Subject: "moksarab"}},
+	}, http.StatusCreated)
+	tokenRes, err := client.PostForm(BASE_URL+"/sarab/idp/token", url.Values{
+		"grant_type": {"client_credentials"}, "client_id": {"moksarab"}, "client_secret": {"moksarab-secret"},
+	})
+	if err != nil {
+		t.Fatalf("error getting a token: %v", err)
+	}
+	var tokens map[string]any
+	if err := json.NewDecoder(tokenRes.Body).Decode(&tokens); err != nil {
+		t.Fatalf("error decoding the token: %v", err)
+	}
+	tokenRes.Body.Close()
+	accessToken := tokens["access_token"].(string)
+	invoicesUrl := BASE_URL + "/sarab/api/invoices"
+	expectBearerStatus(invoicesUrl, accessToken, 200)
+	expectBearerStatus(invoicesUrl, signTestJwt("s3cret", map[string]any{"sub": "moksarab"}), http.StatusUnauthorized)
+	expectBearerStatus(invoicesUrl, accessToken[:len(accessToken)-4]+"AAAA", http.StatusUnauthorized)
+
+	// the tokens with an unknown kid don't fetch the JWKS again on every request
+	var fetches atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer jwks.Close()
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/refunds", Method: "GET", Status: 200,
+		Matchers: models.Matchers{{Type: models.JwtMatcher, JwksUrl: jwks.URL}},
+	}, http.StatusCreated)
+	for _, kid := range []string{"k1", "k2", "k3"} {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+		token := base64.RawURLEncoding.EncodeToString(header) + ".e30.c2lnbmF0dXJl"
+		expectBearerStatus(BASE_URL+"/sarab/api/refunds", token, http.StatusUnauthorized)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("expected the JWKS to be fetched once, but it was fetched %d times", fetches.Load())
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"moksarab/config"
+	"moksarab/routes"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorageSnapshot(t *testing.T) {
+
+	config.MemoryStorage = true
+	config.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	defer func() {
+		config.MemoryStorage = false
+		config.SnapshotPath = ""
+	}()
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	createWorkSpaceRes, err := createWorkspace(client, "in-memory", "persisted to a snapshot")
+	if err != nil {
+		t.Fatalf("Error creating workspace: %v", err)
+	}
+	defer createWorkSpaceRes.Body.Close()
+
+	location, err := createWorkSpaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+
+	newMock := routes.CreateNewMockRequest{Path: "/carts/:cartId/items", Method: "GET", Status: 200}
+	for _, expectedStatus := range []int{201, 409} {
+		createNewMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", newMock)
+		if err != nil {
+			t.Fatalf("Error creating mock: %v", err)
+		}
+		createNewMockRes.Body.Close()
+		if createNewMockRes.StatusCode != expectedStatus {
+			t.Fatalf("expected creating mock status to be %d, but found %d", expectedStatus, createNewMockRes.StatusCode)
+		}
+	}
+
+	afterEach(t, app)
+
+	// starting again must reload the mocks from the snapshot written on close
+	app = beforeEach()
+
+	sarabRes, err := sendRequest(client, BASE_URL+"/sarab/"+workspaceId+"/carts/1/items", "GET", nil)
+	if err != nil {
+		t.Fatalf("error calling sarab: %v", err)
+	}
+	sarabRes.Body.Close()
+	if sarabRes.StatusCode != newMock.Status {
+		t.Fatalf("expected reloaded mock response to be %d, but found %d", newMock.Status, sarabRes.StatusCode)
+	}
+
+	createDuplicateWorkspaceRes, err := createWorkspace(client, "in-memory", "already in the snapshot")
+	if err != nil {
+		t.Fatalf("Error creating workspace: %v", err)
+	}
+	createDuplicateWorkspaceRes.Body.Close()
+	if createDuplicateWorkspaceRes.StatusCode != 409 {
+		t.Fatalf("expected creating a workspace that is in the snapshot to be 409, but found %d", createDuplicateWorkspaceRes.StatusCode)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"moksarab/config"
+	"moksarab/database"
+	"moksarab/models"
+	"path/filepath"
+	"testing"
+)
+
+const legacySchema = `
+	CREATE TABLE workspace (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		description TEXT
+	);
+	CREATE TABLE route (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL,
+		parent_path INTEGER,
+		is_param BOOLEAN DEFAULT 0,
+		param_name TEXT,
+		has_responses BOOLEAN DEFAULT 0,
+		workspace INTEGER NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		FOREIGN KEY (parent_path) REFERENCES route(id),
+		UNIQUE (path, workspace, parent_path)
+	);
+	CREATE TABLE route_response (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path INTEGER NOT NULL,
+		path_params TEXT,
+		method TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		response TEXT,
+		FOREIGN KEY (path) REFERENCES route(id),
+		UNIQUE (path_params, path, method)
+	);
+	INSERT INTO workspace (id, name, description) VALUES (1, 'legacy', 'created before migrations');
+	INSERT INTO route (id, path, parent_path, is_param, param_name, has_responses, workspace) VALUES (1, '/users', NULL, 0, NULL, 0, 1);
+	INSERT INTO route (id, path, parent_path, is_param, param_name, has_responses, workspace) VALUES (2, '/<param>', 1, 1, 'userId', 1, 1);
+	INSERT INTO route_response (path, path_params, method, status) VALUES (2, NULL, 'GET', 200);
+	INSERT INTO route_response (path, path_params, method, status) VALUES (2, 'userId: 42', 'GET', 404);
+`
+
+func TestMigratingLegacyDatabase(t *testing.T) {
+
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	legacyDb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("error opening legacy database: %v", err)
+	}
+	if _, err := legacyDb.Exec(legacySchema); err != nil {
+		t.Fatalf("error creating legacy schema: %v", err)
+	}
+	legacyDb.Close()
+
+	previousDbPath := config.DbPath
+	config.DbPath = dbPath
+	defer func() { config.DbPath = previousDbPath }()
+
+	config.WorkspaceEnabled = true
+	database.InitilizeDatabase()
+	defer database.Db.Close()
+
+	var version int
+	if err := database.Db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		t.Fatalf("error reading schema version: %v", err)
+	}
+	if version != models.Migrations[len(models.Migrations)-1].Version {
+		t.Fatalf("expected schema version to be %d, but found %d", models.Migrations[len(models.Migrations)-1].Version, version)
+	}
+
+	var paramName string
+	var paramConstraint sql.NullString
+	if err := database.Db.QueryRow("SELECT param_name, param_constraint FROM route WHERE id = 2").Scan(&paramName, &paramConstraint); err != nil {
+		t.Fatalf("error reading migrated route: %v", err)
+	}
+	if paramName != "userId" || paramConstraint.Valid {
+		t.Fatalf("expected migrated route to keep param userId without constraint, but found %s %v", paramName, paramConstraint)
+	}
+
+	var rawPathParams string
+	if err := database.Db.QueryRow("SELECT path_params FROM route_response WHERE path_params IS NOT NULL").Scan(&rawPathParams); err != nil {
+		t.Fatalf("error reading migrated path params: %v", err)
+	}
+	if rawPathParams != `{"userId":"42"}` {
+		t.Fatalf(`expected path params to be migrated to {"userId":"42"}, but found %s`, rawPathParams)
+	}
+
+	workspace, err := database.Store.GetWorkspaceBySlug(context.Background(), "legacy")
+	if err != nil || workspace == nil || workspace.Id != 1 {
+		t.Fatalf("expected the legacy workspace to get the slug legacy, but found %v %v", workspace, err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"moksarab/config"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClientCa issues the client certificates of the mTLS tests.
+type testClientCa struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         string
+}
+
+func newTestClientCa(t *testing.T) testClientCa {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating client CA: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return testClientCa{certificate, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func (ca testClientCa) issue(t *testing.T, commonName string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Acme Bank"}},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("error issuing client certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func newMtlsClient(clientCertificates ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		// the server certificate is generated by each test, only the client certificate matters here
+		InsecureSkipVerify: true,
+		Certificates:       clientCertificates,
+	}}}
+}
+
+func TestMtlsWorkspaceListener(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	clientCa := newTestClientCa(t)
+
+	createWorkspaceRes, err := createWorkspace(client, "bank", "requires client certificates")
+	if err != nil {
+		t.Fatalf("Creating workspace failed: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{Path: "/accounts", Method: "GET", Status: 200}
+	createMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/bank/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	createMockRes.Body.Close()
+
+	getMocksRes, err := sendRequest(client, BASE_URL+"/api/workspaces/bank/mocks", "GET", nil)
+	if err != nil {
+		t.Fatalf("Error getting mocks: %v", err)
+	}
+	defer getMocksRes.Body.Close()
+	var mocks []routes.GetMocksResponse
+	if err := json.NewDecoder(getMocksRes.Body).Decode(&mocks); err != nil {
+		t.Fatalf("Failed to decode mocks: %v", err)
+	}
+	mockUrl := fmt.Sprintf("%s/api/workspaces/bank/mocks/%d", BASE_URL, mocks[0].DirectPathId)
+
+	invalidMatcher := models.RouteResponse{Method: "GET", Status: 201, Matchers: models.Matchers{{Type: "header"}}}
+	expectStatus(t, client, mockUrl, "POST", invalidMatcher, http.StatusBadRequest)
+	bySubject := models.RouteResponse{Method: "GET", Status: 201, Matchers: models.Matchers{{Type: models.ClientCertMatcher, Subject: "acme"}}}
+	expectStatus(t, client, mockUrl, "POST", bySubject, http.StatusCreated)
+	bySan := models.RouteResponse{Method: "GET", Status: 202, Matchers: models.Matchers{{Type: models.ClientCertMatcher, San: "payments.globex.test"}}}
+	expectStatus(t, client, mockUrl, "POST", bySan, http.StatusCreated)
+
+	portUrl := BASE_URL + "/api/workspaces/bank/port"
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9201, ClientCa: clientCa.pem}, http.StatusBadRequest)
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9201, Tls: true, ClientCa: clientCa.pem}, http.StatusOK)
+
+	listenerUrl := "https://localhost:9201/accounts"
+	expectStatus(t, newMtlsClient(clientCa.issue(t, "acme")), listenerUrl, "GET", nil, 201)
+	expectStatus(t, newMtlsClient(clientCa.issue(t, "globex", "payments.globex.test")), listenerUrl, "GET", nil, 202)
+	expectStatus(t, newMtlsClient(clientCa.issue(t, "initech")), listenerUrl, "GET", nil, 200)
+	if _, err := sendRequest(newMtlsClient(), listenerUrl, "GET", nil); err == nil {
+		t.Fatal("expected a request without a client certificate to be rejected")
+	}
+	if _, err := sendRequest(newMtlsClient(newTestClientCa(t).issue(t, "acme")), listenerUrl, "GET", nil); err == nil {
+		t.Fatal("expected a client certificate issued by another CA to be rejected")
+	}
+
+	// without mTLS no client certificate is verified, so the matchers never match
+	expectStatus(t, client, portUrl, "PUT", routes.SetWorkspacePortRequest{Port: 9201, Tls: true}, http.StatusOK)
+	expectStatus(t, newMtlsClient(clientCa.issue(t, "acme")), listenerUrl, "GET", nil, 200)
+
+	afterEach(t, app)
+}
+
+func TestOptionalMtlsOnHttpsPort(t *testing.T) {
+
+	clientCa := newTestClientCa(t)
+	clientCaFile := filepath.Join(t.TempDir(), "client-ca.pem")
+	if err := os.WriteFile(clientCaFile, []byte(clientCa.pem), 0o600); err != nil {
+		t.Fatalf("error writing client CA: %v", err)
+	}
+
+	config.TlsPort, config.TlsClientCaFile, config.TlsClientCertOptional = TLS_PORT, clientCaFile, true
+	defer func() { config.TlsPort, config.TlsClientCaFile, config.TlsClientCertOptional = "", "", false }()
+
+	app := beforeEach()
+	if err := listenTLS(app); err != nil {
+		t.Fatalf("error serving HTTPS: %v", err)
+	}
+
+	httpsUrl := "https://localhost:" + TLS_PORT
+	client := newMtlsClient()
+	createWorkspaceRes, err := sendRequest(client, httpsUrl+"/api/workspaces", "POST", map[string]string{"name": "optional"})
+	if err != nil {
+		t.Fatalf("expected the API to be reachable without a client certificate: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{
+		Path:     "/statements",
+		Method:   "GET",
+		Status:   203,
+		Matchers: models.Matchers{{Type: models.ClientCertMatcher, Subject: "CN=acme,O=Acme Bank"}},
+	}
+	createMockRes, err := sendRequest(client, httpsUrl+"/api/workspaces/optional/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	createMockRes.Body.Close()
+
+	for certificateClient, status := range map[*http.Client]int{
+		newMtlsClient(clientCa.issue(t, "acme")): 203,
+		newMtlsClient():                          404,
+	} {
+		res, err := sendRequest(certificateClient, httpsUrl+"/sarab/optional/statements", "GET", nil)
+		if err != nil {
+			t.Fatalf("error calling sarab: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected sarab response to be %d, but found %d", status, res.StatusCode)
+		}
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"moksarab/config"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestOidcWorkspace(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{
+		// the authorization redirect is checked instead of followed
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	decode := func(res *http.Response, status int, value any) {
+		t.Helper()
+		defer res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("expected %s %s to be %d, but found %d", res.Request.Method, res.Request.URL, status, res.StatusCode)
+		}
+		if value != nil {
+			if err := json.NewDecoder(res.Body).Decode(value); err != nil {
+				t.Fatalf("error decoding %s: %v", res.Request.URL, err)
+			}
+		}
+	}
+
+	res, err := sendRequest(client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "bad", Type: "saml"})
+	if err != nil {
+		t.Fatalf("error creating workspace: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "idp", Type: models.OidcWorkspace})
+	if err != nil {
+		t.Fatalf("error creating workspace: %v", err)
+	}
+	decode(res, http.StatusCreated, nil)
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "plain"})
+	if err != nil {
+		t.Fatalf("error creating workspace: %v", err)
+	}
+	decode(res, http.StatusCreated, nil)
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces/plain/oidc", "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting settings: %v", err)
+	}
+	decode(res, http.StatusNotFound, nil)
+
+	settings := models.DefaultOidcSettings()
+	settings.Clients = append(settings.Clients, models.OidcClient{ClientId: "spa", RedirectUris: []string{"http://localhost:3000/callback"}})
+	settings.Users = append(settings.Users, models.OidcUser{Subject: "bob", Claims: map[string]any{"name": "Bob", "roles": []string{"admin"}}})
+	settings.Claims = map[string]any{"tenant": "acme"}
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces/idp/oidc", "PUT", models.OidcSettings{Users: settings.Users})
+	if err != nil {
+		t.Fatalf("error setting settings: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces/idp/oidc", "PUT", models.OidcSettings{
+		Clients:       []models.OidcClient{{ClientId: "any-redirect"}},
+		TokenLifetime: 60,
+	})
+	if err != nil {
+		t.Fatalf("error setting settings: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces/idp/oidc", "PUT", settings)
+	if err != nil {
+		t.Fatalf("error setting settings: %v", err)
+	}
+	decode(res, http.StatusOK, nil)
+
+	issuer := BASE_URL + "/sarab/idp"
+	res, err = client.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatalf("error getting discovery: %v", err)
+	}
+	var discovery map[string]any
+	decode(res, http.StatusOK, &discovery)
+	if discovery["issuer"] != issuer || discovery["token_endpoint"] != issuer+"/token" {
+		t.Fatalf("unexpected discovery document: %v", discovery)
+	}
+	res, err = client.Get(issuer + "/jwks")
+	if err != nil {
+		t.Fatalf("error getting jwks: %v", err)
+	}
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	decode(res, http.StatusOK, &jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0]["kty"] != "RSA" || jwks.Keys[0]["kid"] == "" {
+		t.Fatalf("unexpected jwks: %v", jwks)
+	}
+
+	// authorization code flow of a public client with PKCE
+	verifier := "a-code-verifier-long-enough-for-the-test-0123456789"
+	challenge := sha256.Sum256([]byte(verifier))
+	authorizeQuery := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"http://localhost:3000/callback"},
+		"scope":                 {"openid profile"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"login_hint":            {"bob"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	res, err = client.Get(issuer + "/authorize?" + authorizeQuery.Encode())
+	if err != nil {
+		t.Fatalf("error authorizing: %v", err)
+	}
+	decode(res, http.StatusFound, nil)
+	location, _ := url.Parse(res.Header.Get("Location"))
+	if location.Host != "localhost:3000" || location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+		t.Fatalf("unexpected authorization redirect: %s", location)
+	}
+	authorizeQuery.Set("redirect_uri", "http://evil.test/callback")
+	res, err = client.Get(issuer + "/authorize?" + authorizeQuery.Encode())
+	if err != nil {
+		t.Fatalf("error authorizing: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+
+	codeForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {"http://localhost:3000/callback"},
+		"code_verifier": {"wrong-verifier"},
+	}
+	res, err = client.PostForm(issuer+"/token", codeForm)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+
+	// the failed exchange used the code up
+	authorizeQuery.Set("redirect_uri", "http://localhost:3000/callback")
+	res, err = client.Get(issuer + "/authorize?" + authorizeQuery.Encode())
+	if err != nil {
+		t.Fatalf("error authorizing: %v", err)
+	}
+	decode(res, http.StatusFound, nil)
+	location, _ = url.Parse(res.Header.Get("Location"))
+	codeForm.Set("code", location.Query().Get("code"))
+	codeForm.Set("code_verifier", verifier)
+	res, err = client.PostForm(issuer+"/token", codeForm)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v", err)
+	}
+	var tokens map[string]any
+	decode(res, http.StatusOK, &tokens)
+	idToken := decodeTestJwt(t, tokens["id_token"])
+	if idToken["sub"] != "bob" || idToken["aud"] != "spa" || idToken["nonce"] != "n-0S6" || idToken["iss"] != issuer || idToken["tenant"] != "acme" {
+		t.Fatalf("unexpected id_token claims: %v", idToken)
+	}
+	res, err = client.PostForm(issuer+"/token", codeForm)
+	if err != nil {
+		t.Fatalf("error exchanging code: %v", err)
+	}
+	decode(res, http.StatusBadRequest, nil)
+
+	userinfoReq, _ := http.NewRequest("GET", issuer+"/userinfo", nil)
+	userinfoReq.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	res, err = client.Do(userinfoReq)
+	if err != nil {
+		t.Fatalf("error getting userinfo: %v", err)
+	}
+	var userinfo map[string]any
+	decode(res, http.StatusOK, &userinfo)
+	if userinfo["sub"] != "bob" || userinfo["name"] != "Bob" {
+		t.Fatalf("unexpected userinfo: %v", userinfo)
+	}
+	userinfoReq.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string)+"x")
+	res, err = client.Do(userinfoReq)
+	if err != nil {
+		t.Fatalf("error getting userinfo: %v", err)
+	}
+	decode(res, http.StatusUnauthorized, nil)
+
+	// client credentials of a confidential client with basic authentication
+	tokenReq, _ := http.NewRequest("POST", issuer+"/token", strings.NewReader("grant_type=client_credentials&scope=read"))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth("moksarab", "wrong")
+	res, err = client.Do(tokenReq)
+	if err != nil {
+		t.Fatalf("error getting a token: %v", err)
+	}
+	decode(res, http.StatusUnauthorized, nil)
+	tokenReq, _ = http.NewRequest("POST", issuer+"/token", strings.NewReader("grant_type=client_credentials&scope=read"))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth("moksarab", "moksarab-secret")
+	res, err = client.Do(tokenReq)
+	if err != nil {
+		t.Fatalf("error getting a token: %v", err)
+	}
+	tokens = nil
+	decode(res, http.StatusOK, &tokens)
+	if accessToken := decodeTestJwt(t, tokens["access_token"]); accessToken["sub"] != "moksarab" || accessToken["scope"] != "read" {
+		t.Fatalf("unexpected access_token claims: %v", accessToken)
+	}
+
+	// any other path is served by the mocks of the workspace
+	res, err = client.Get(issuer + "/unknown")
+	if err != nil {
+		t.Fatalf("error calling sarab: %v", err)
+	}
+	decode(res, http.StatusNotFound, nil)
+
+	afterEach(t, app)
+}
+
+func TestOidcSettingsHideSecretsFromViewers(t *testing.T) {
+
+	const adminKey = "bootstrap-admin-key"
+	config.AdminApiKey = adminKey
+	defer func() { config.AdminApiKey = "" }()
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	res, err := sendRequestWithApiKey(client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "idp", Type: models.OidcWorkspace}, adminKey)
+	if err != nil {
+		t.Fatalf("error creating workspace: %v", err)
+	}
+	res.Body.Close()
+	location, err := res.Location()
+	if err != nil {
+		t.Fatalf("error getting workspace location: %v", err)
+	}
+	var workspaceId int64
+	fmt.Sscan(path.Base(location.Path), &workspaceId)
+	createKey := func(role models.Role) string {
+		t.Helper()
+		var created routes.CreateApiKeyResponse
+		apiKey := models.ApiKey{Name: string(role), Role: role, Workspaces: models.WorkspaceIds{workspaceId}}
+		if err := json.Unmarshal(expectStatusWithApiKey(t, client, BASE_URL+"/api/keys", "POST", apiKey, adminKey, http.StatusCreated), &created); err != nil {
+			t.Fatalf("error decoding created API key: %v", err)
+		}
+		return created.Key
+	}
+
+	settingsUrl := fmt.Sprintf("%s/api/workspaces/%d/oidc", BASE_URL, workspaceId)
+	for key, secret := range map[string]string{createKey(models.RoleViewer): "", createKey(models.RoleEditor): "moksarab-secret"} {
+		var settings models.OidcSettings
+		if err := json.Unmarshal(expectStatusWithApiKey(t, client, settingsUrl, "GET", nil, key, http.StatusOK), &settings); err != nil {
+			t.Fatalf("error decoding settings: %v", err)
+		}
+		if len(settings.Clients) != 1 || settings.Clients[0].ClientSecret != secret {
+			t.Fatalf("expected the client secret to be [%s], but found %v", secret, settings.Clients)
+		}
+	}
+
+	afterEach(t, app)
+}
+
+// decodeTestJwt returns the claims of the token without verifying it.
+func decodeTestJwt(t *testing.T, token any) map[string]any {
+	t.Helper()
+	parts := strings.Split(token.(string), ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a JWT, but found %v", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("error decoding the JWT payload: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("error decoding the JWT claims: %v", err)
+	}
+	return claims
+}
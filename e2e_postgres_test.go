@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"moksarab/config"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPostgresStorage runs against the PostgreSQL given by TEST_POSTGRES_DSN, e.g. one started with
+// `docker run -e POSTGRES_PASSWORD=moksarab -p 5432:5432 postgres`
+func TestPostgresStorage(t *testing.T) {
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	config.PostgresDsn = dsn
+	defer func() { config.PostgresDsn = "" }()
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	createWorkSpaceRes, err := createWorkspace(client, fmt.Sprintf("postgres-%d", time.Now().UnixNano()), "stored in postgres")
+	if err != nil {
+		t.Fatalf("Error creating workspace: %v", err)
+	}
+	defer createWorkSpaceRes.Body.Close()
+	if createWorkSpaceRes.StatusCode != 201 {
+		t.Fatalf("expected creating workspace status to be 201, but found %d", createWorkSpaceRes.StatusCode)
+	}
+
+	location, err := createWorkSpaceRes.Location()
+	if err != nil {
+		t.Fatalf("Error getting workspace location: %v", err)
+	}
+	locationParts := strings.Split(location.Path, "/")
+	workspaceId := locationParts[len(locationParts)-1]
+
+	newMock := routes.CreateNewMockRequest{Path: "/users/:userId<int>", Method: "GET", Status: 200}
+	createNewMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", newMock)
+	if err != nil {
+		t.Fatalf("Error creating mock: %v", err)
+	}
+	defer createNewMockRes.Body.Close()
+	if createNewMockRes.StatusCode != 201 {
+		body, _ := io.ReadAll(createNewMockRes.Body)
+		t.Fatalf("expected creating mock status to be 201, but found %d: %s", createNewMockRes.StatusCode, body)
+	}
+
+	postMock := routes.CreateNewMockRequest{Path: newMock.Path, Method: "POST", Status: 201}
+	postMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", postMock)
+	if err != nil {
+		t.Fatalf("Error creating POST mock: %v", err)
+	}
+	defer postMockRes.Body.Close()
+	if postMockRes.StatusCode != 201 {
+		t.Fatalf("expected creating a POST mock on the same path status to be 201, but found %d", postMockRes.StatusCode)
+	}
+
+	duplicateMockRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "POST", newMock)
+	if err != nil {
+		t.Fatalf("Error creating duplicate mock: %v", err)
+	}
+	defer duplicateMockRes.Body.Close()
+	if duplicateMockRes.StatusCode != 409 {
+		t.Fatalf("expected creating duplicate mock status to be 409, but found %d", duplicateMockRes.StatusCode)
+	}
+
+	getMocksRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks", "GET", nil)
+	if err != nil {
+		t.Fatalf("error fetching mocks: %v", err)
+	}
+	defer getMocksRes.Body.Close()
+	var mocks []routes.GetMocksResponse
+	if err := json.NewDecoder(getMocksRes.Body).Decode(&mocks); err != nil {
+		t.Fatalf("error decoding get mocks response: %v", err)
+	}
+	if len(mocks) != 2 || mocks[0].FullPath != "/users/<param>" || mocks[0].ParamNames != "userId" || mocks[1].Method != "POST" {
+		t.Fatalf("expected the GET and POST mocks of '/users/<param>' with param userId, but found %+v", mocks)
+	}
+
+	mockResponse := models.RouteResponse{Method: "GET", Status: 404, PathParams: models.PathParams{"userId": "7"}}
+	mockResponseRes, err := sendRequest(client, BASE_URL+"/api/workspaces/"+workspaceId+"/mocks/"+fmt.Sprint(mocks[0].DirectPathId), "POST", mockResponse)
+	if err != nil {
+		t.Fatalf("error creating a mocked response with specific param value: %v", err)
+	}
+	defer mockResponseRes.Body.Close()
+	if mockResponseRes.StatusCode != 201 {
+		t.Fatalf("expected creating mocked response status to be 201, but found %d", mockResponseRes.StatusCode)
+	}
+
+	expectations := map[string]int{"/users/1": 200, "/users/7": 404, "/users/me": 404}
+	for path, status := range expectations {
+		sarabRes, err := sendRequest(client, BASE_URL+"/sarab/"+workspaceId+path, "GET", nil)
+		if err != nil {
+			t.Fatalf("error calling sarab [%s]: %v", path, err)
+		}
+		sarabRes.Body.Close()
+		if sarabRes.StatusCode != status {
+			t.Fatalf("expected [%s] response to be %d, but found %d", path, status, sarabRes.StatusCode)
+		}
+	}
+
+	afterEach(t, app)
+}
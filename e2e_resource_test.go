@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestResourceMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	expectJson := func(url, method string, body interface{}, status int, decoded any) {
+		t.Helper()
+		if err := json.Unmarshal(expectStatus(t, client, url, method, body, status), decoded); err != nil {
+			t.Fatalf("error decoding %s %s: %v", method, url, err)
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "crud"}, http.StatusCreated)
+	resourcesUrl := BASE_URL + "/api/workspaces/crud/resources"
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/users/:id"}, http.StatusBadRequest)
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/users", State: "redis"}, http.StatusBadRequest)
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/users", Seed: models.JsonValue(`{"id":1}`)}, http.StatusBadRequest)
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/users", Seed: models.JsonValue(`[{"id":1},{"id":1}]`)}, http.StatusBadRequest)
+
+	var created map[string]int64
+	expectJson(resourcesUrl, "POST", routes.CreateResourceRequest{
+		Path: "/users", Seed: models.JsonValue(`[{"id":1,"name":"Ann"},{"id":2,"name":"Bob"},{"name":"Cid"}]`),
+	}, http.StatusCreated, &created)
+	usersId := strconv.FormatInt(created["id"], 10)
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/users"}, http.StatusConflict)
+	expectStatus(t, client, resourcesUrl, "POST", routes.CreateResourceRequest{Path: "/orders", IdField: "ref", State: models.DatabaseResourceState}, http.StatusCreated)
+
+	usersUrl := BASE_URL + "/sarab/crud/users"
+	var page models.PageModel[map[string]any]
+	expectJson(usersUrl+"?page=1&size=2", "GET", nil, http.StatusOK, &page)
+	if len(page.Content) != 1 || page.Content[0]["id"] != float64(3) || page.TotalElements != 3 || page.TotalPages != 2 || !page.Last || page.First {
+		t.Fatalf("expected the second page of the seed, but found %+v", page)
+	}
+	expectStatus(t, client, usersUrl+"?page=-1", "GET", nil, http.StatusBadRequest)
+
+	var user map[string]any
+	expectJson(usersUrl, "POST", map[string]any{"name": "Dee", "email": "dee@example.com"}, http.StatusCreated, &user)
+	if user["id"] != float64(4) {
+		t.Fatalf("expected the next id, but found %+v", user)
+	}
+	expectStatus(t, client, usersUrl, "POST", map[string]any{"id": 1, "name": "Eve"}, http.StatusConflict)
+	expectStatus(t, client, usersUrl, "POST", []string{"not", "an", "object"}, http.StatusBadRequest)
+
+	user = nil
+	expectJson(usersUrl+"/4", "PATCH", map[string]any{"email": nil, "address": map[string]any{"city": "Paris"}}, http.StatusOK, &user)
+	if len(user) != 3 || user["name"] != "Dee" || user["address"].(map[string]any)["city"] != "Paris" {
+		t.Fatalf("expected the patched user, but found %+v", user)
+	}
+	expectJson(usersUrl+"/4", "PUT", map[string]any{"name": "Dora"}, http.StatusOK, &user)
+	user = nil
+	expectJson(usersUrl+"/4", "GET", nil, http.StatusOK, &user)
+	if len(user) != 2 || user["id"] != float64(4) || user["name"] != "Dora" {
+		t.Fatalf("expected the replaced user, but found %+v", user)
+	}
+	expectStatus(t, client, usersUrl+"/4", "PUT", map[string]any{"id": 5, "name": "Dora"}, http.StatusBadRequest)
+	expectStatus(t, client, usersUrl+"/9", "PATCH", map[string]any{"name": "Nobody"}, http.StatusNotFound)
+
+	expectStatus(t, client, usersUrl+"/2", "DELETE", nil, http.StatusNoContent)
+	expectStatus(t, client, usersUrl+"/2", "GET", nil, http.StatusNotFound)
+	expectStatus(t, client, usersUrl+"/2", "DELETE", nil, http.StatusNotFound)
+	res, err := sendRequest(client, usersUrl, "DELETE", nil)
+	if err != nil {
+		t.Fatalf("error sending DELETE %s: %v", usersUrl, err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != "GET, POST" {
+		t.Fatalf("expected the methods of the collection in Allow, but found %d %s", res.StatusCode, res.Header.Get("Allow"))
+	}
+
+	// the reset drops every change since the seed
+	expectStatus(t, client, resourcesUrl+"/"+usersId+"/reset", "POST", nil, http.StatusNoContent)
+	expectJson(usersUrl, "GET", nil, http.StatusOK, &page)
+	if page.TotalElements != 3 || page.Content[1]["name"] != "Bob" {
+		t.Fatalf("expected the seed back, but found %+v", page)
+	}
+
+	// the ids follow the integers, until an id is not one
+	ordersUrl := BASE_URL + "/sarab/crud/orders"
+	var order map[string]any
+	expectJson(ordersUrl, "POST", map[string]any{"total": 5}, http.StatusCreated, &order)
+	if order["ref"] != float64(1) {
+		t.Fatalf("expected the first integer id, but found %+v", order)
+	}
+	expectStatus(t, client, ordersUrl, "POST", map[string]any{"ref": "A-1", "total": 7}, http.StatusCreated)
+	order = nil
+	expectJson(ordersUrl, "POST", map[string]any{"total": 9}, http.StatusCreated, &order)
+	if ref, _ := order["ref"].(string); len(ref) != 36 {
+		t.Fatalf("expected a generated UUID, but found %+v", order)
+	}
+	order = nil
+	expectJson(ordersUrl+"/A-1", "GET", nil, http.StatusOK, &order)
+	if order["total"] != float64(7) {
+		t.Fatalf("expected the order A-1, but found %+v", order)
+	}
+
+	var resources []models.Resource
+	expectJson(resourcesUrl, "GET", nil, http.StatusOK, &resources)
+	if len(resources) != 2 || resources[0].IdField != "id" || resources[0].State != models.MemoryResourceState || resources[1].IdField != "ref" {
+		t.Fatalf("expected the resources with their defaults, but found %+v", resources)
+	}
+	expectStatus(t, client, resourcesUrl+"/"+usersId, "DELETE", nil, http.StatusNoContent)
+	expectStatus(t, client, resourcesUrl+"/"+usersId, "DELETE", nil, http.StatusNotFound)
+	expectStatus(t, client, usersUrl+"/1", "GET", nil, http.StatusNotFound)
+
+	afterEach(t, app)
+}
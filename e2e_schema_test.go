@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const usersOpenapiDocument = `
+openapi: 3.0.3
+info:
+  title: Users
+  version: "1.0"
+paths: {}
+components:
+  schemas:
+    User:
+      type: object
+      required: [id, email, name, role, tags, address]
+      properties:
+        id:
+          type: string
+          format: uuid
+        email:
+          type: string
+          format: email
+        name:
+          type: string
+          maxLength: 40
+        age:
+          type: integer
+          minimum: 18
+          maximum: 99
+        role:
+          type: string
+          enum: [admin, editor, viewer]
+        tags:
+          type: array
+          minItems: 1
+          maxItems: 3
+          uniqueItems: true
+          items:
+            type: string
+            pattern: "^[a-z]{3,8}$"
+        address:
+          $ref: "#/components/schemas/Address"
+        password:
+          type: string
+          writeOnly: true
+    Address:
+      type: object
+      required: [city, zip]
+      properties:
+        city:
+          type: string
+        zip:
+          type: string
+          pattern: "^\\d{5}$"
+`
+
+func TestSchemaResponses(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	document, err := openapi3.NewLoader().LoadFromData([]byte(usersOpenapiDocument))
+	if err != nil {
+		t.Fatalf("error loading the document: %v", err)
+	}
+	expectValid := func(raw []byte, schema *openapi3.Schema) {
+		t.Helper()
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			t.Fatalf("expected a JSON body, but found %s", raw)
+		}
+		if err := schema.VisitJSON(value); err != nil {
+			t.Fatalf("expected %s to be valid against its schema: %v", raw, err)
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "schemas"}, http.StatusCreated)
+	openapiUrl := BASE_URL + "/api/workspaces/schemas/openapi"
+	expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: "openapi: 3.0.3\npaths: {}"}, http.StatusBadRequest)
+	var saved routes.OpenapiDocumentResponse
+	if err := json.Unmarshal(expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: usersOpenapiDocument}, http.StatusOK), &saved); err != nil {
+		t.Fatalf("error decoding the document: %v", err)
+	}
+	if !slices.Equal(saved.Schemas, []string{"Address", "User"}) {
+		t.Fatalf("expected the component schemas, but found %+v", saved.Schemas)
+	}
+
+	mocksUrl := BASE_URL + "/api/workspaces/schemas/mocks"
+	body := "{}"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/missing", Method: "GET", Status: 200, Schema: models.JsonValue(`{"$ref":"#/components/schemas/Group"}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/both", Method: "GET", Status: 200, ResponseBody: &body, Schema: models.JsonValue(`{"type":"object"}`),
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/impossible", Method: "GET", Status: 200, Schema: models.JsonValue(`{"type":"integer","minimum":5,"maximum":4}`),
+	}, http.StatusBadRequest)
+
+	seed := int64(7)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/users/:id", Method: "GET", Status: 200, Seed: &seed, Schema: models.JsonValue(`{"$ref":"#/components/schemas/User"}`),
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/users", Method: "GET", Status: 200,
+		Schema: models.JsonValue(`{"type":"array","minItems":2,"maxItems":5,"items":{"$ref":"#/components/schemas/User"}}`),
+	}, http.StatusCreated)
+	numbers := `{"type":"object","required":["price","count","ratio","day"],"properties":{
+		"price":{"type":"number","minimum":1,"maximum":2,"exclusiveMaximum":true,"multipleOf":0.25},
+		"count":{"type":"integer","minimum":10,"maximum":20,"multipleOf":5},
+		"ratio":{"type":"number","minimum":0,"maximum":1},
+		"day":{"type":"string","format":"date"}}}`
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/numbers", Method: "GET", Status: 200, Schema: models.JsonValue(numbers),
+	}, http.StatusCreated)
+
+	res, err := sendRequest(client, BASE_URL+"/sarab/schemas/users/1", "GET", nil)
+	if err != nil {
+		t.Fatalf("error calling sarab: %v", err)
+	}
+	res.Body.Close()
+	if res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected the generated response to be JSON, but found %s", res.Header.Get("Content-Type"))
+	}
+
+	// the seed gives the same user on every call
+	user := expectStatus(t, client, BASE_URL+"/sarab/schemas/users/1", "GET", nil, http.StatusOK)
+	if again := expectStatus(t, client, BASE_URL+"/sarab/schemas/users/1", "GET", nil, http.StatusOK); string(again) != string(user) {
+		t.Fatalf("expected the same user for the same seed, but found %s and %s", user, again)
+	}
+	expectValid(user, document.Components.Schemas["User"].Value)
+
+	var numbersSchema openapi3.Schema
+	if err := json.Unmarshal([]byte(numbers), &numbersSchema); err != nil {
+		t.Fatalf("error decoding the numbers schema: %v", err)
+	}
+	listSchema := &openapi3.Schema{Type: &openapi3.Types{"array"}, Items: document.Components.Schemas["User"], MinItems: 2}
+	var lists []string
+	for range 5 {
+		list := expectStatus(t, client, BASE_URL+"/sarab/schemas/users", "GET", nil, http.StatusOK)
+		expectValid(list, listSchema)
+		var users []map[string]any
+		_ = json.Unmarshal(list, &users)
+		for _, user := range users {
+			if _, found := user["password"]; found {
+				t.Fatalf("expected no writeOnly property in the responses, but found %s", list)
+			}
+		}
+		lists = append(lists, string(list))
+		expectValid(expectStatus(t, client, BASE_URL+"/sarab/schemas/numbers", "GET", nil, http.StatusOK), &numbersSchema)
+	}
+	if len(slices.Compact(slices.Sorted(slices.Values(lists)))) == 1 {
+		t.Fatalf("expected fresh users on every call without a seed, but found %s", lists[0])
+	}
+
+	var mocks []models.Mock
+	if err := json.Unmarshal(expectStatus(t, client, mocksUrl, "GET", nil, http.StatusOK), &mocks); err != nil {
+		t.Fatalf("error decoding the mocks: %v", err)
+	}
+	if len(mocks) != 3 || string(mocks[0].Schema) != `{"$ref":"#/components/schemas/User"}` || *mocks[0].Seed != seed {
+		t.Fatalf("expected the mocks with their schema, but found %+v", mocks)
+	}
+
+	// a document without the referenced schemas reports the responses it breaks
+	expectBroken := func(raw []byte) {
+		t.Helper()
+		var report routes.OpenapiDocumentResponse
+		if err := json.Unmarshal(raw, &report); err != nil {
+			t.Fatalf("error decoding the broken responses: %v", err)
+		}
+		if len(report.BrokenResponses) != 2 || report.BrokenResponses[0].Path != "/users/<param>" || report.BrokenResponses[1].Path != "/users" ||
+			!strings.Contains(report.BrokenResponses[0].Message, "#/components/schemas/User") {
+			t.Fatalf("expected the responses of the users to be broken, but found %s", raw)
+		}
+	}
+	expectBroken(expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: "openapi: 3.0.3\ninfo: {title: Empty, version: \"1\"}\npaths: {}"}, http.StatusOK))
+	expectStatus(t, client, BASE_URL+"/sarab/schemas/users/1", "GET", nil, http.StatusInternalServerError)
+	expectStatus(t, client, BASE_URL+"/sarab/schemas/numbers", "GET", nil, http.StatusOK)
+
+	// without the document, the references can't be resolved anymore
+	expectBroken(expectStatus(t, client, openapiUrl, "DELETE", nil, http.StatusOK))
+	expectStatus(t, client, openapiUrl, "GET", nil, http.StatusNotFound)
+	expectStatus(t, client, openapiUrl, "DELETE", nil, http.StatusNotFound)
+	expectStatus(t, client, BASE_URL+"/sarab/schemas/users/1", "GET", nil, http.StatusInternalServerError)
+
+	afterEach(t, app)
+}
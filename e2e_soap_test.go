@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testOrdersWsdl = `<?xml version="1.0" encoding="UTF-8"?>
+<wsdl:definitions xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+	xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:tns="urn:shop:orders" targetNamespace="urn:shop:orders">
+	<wsdl:types>
+		<xs:schema targetNamespace="urn:shop:orders" elementFormDefault="qualified">
+			<xs:element name="GetOrder">
+				<xs:complexType><xs:sequence>
+					<xs:element name="id" type="xs:string"/>
+				</xs:sequence></xs:complexType>
+			</xs:element>
+			<xs:element name="GetOrderResponse">
+				<xs:complexType><xs:sequence>
+					<xs:element name="order" type="tns:Order"/>
+				</xs:sequence></xs:complexType>
+			</xs:element>
+			<xs:complexType name="Order">
+				<xs:sequence>
+					<xs:element name="id" type="xs:string"/>
+					<xs:element name="total" type="xs:decimal"/>
+					<xs:element name="status" type="tns:OrderStatus"/>
+				</xs:sequence>
+			</xs:complexType>
+			<xs:simpleType name="OrderStatus">
+				<xs:restriction base="xs:string">
+					<xs:enumeration value="OPEN"/>
+					<xs:enumeration value="SHIPPED"/>
+				</xs:restriction>
+			</xs:simpleType>
+		</xs:schema>
+	</wsdl:types>
+	<wsdl:message name="GetOrderInput"><wsdl:part name="parameters" element="tns:GetOrder"/></wsdl:message>
+	<wsdl:message name="GetOrderOutput"><wsdl:part name="parameters" element="tns:GetOrderResponse"/></wsdl:message>
+	<wsdl:portType name="OrdersPort">
+		<wsdl:operation name="GetOrder">
+			<wsdl:input message="tns:GetOrderInput"/>
+			<wsdl:output message="tns:GetOrderOutput"/>
+		</wsdl:operation>
+	</wsdl:portType>
+	<wsdl:binding name="OrdersBinding" type="tns:OrdersPort">
+		<soap:binding style="document" transport="http://schemas.xmlsoap.org/soap/http"/>
+		<wsdl:operation name="GetOrder">
+			<soap:operation soapAction="urn:shop:orders/GetOrder"/>
+			<wsdl:input><soap:body use="literal"/></wsdl:input>
+			<wsdl:output><soap:body use="literal"/></wsdl:output>
+		</wsdl:operation>
+	</wsdl:binding>
+</wsdl:definitions>`
+
+func TestSoapMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	postEnvelope := func(contentType string, action string, envelope string) (int, string, string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", BASE_URL+"/sarab/shop/orders", strings.NewReader(envelope))
+		req.Header.Set("Content-Type", contentType)
+		if action != "" {
+			req.Header.Set("SOAPAction", `"`+action+`"`)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("error posting the envelope: %v", err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, res.Header.Get("Content-Type"), string(body)
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "shop"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/shop/soap/mocks"
+	wsdlUrl := BASE_URL + "/api/workspaces/shop/soap/wsdl"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{Path: "/orders", Body: "<unclosed>"}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{
+		Path: "/orders", XPaths: models.XPathMatches{{Expression: "//o:id"}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{
+		Path: "/orders", Body: "<ok/>", Fault: models.SoapFault{Reason: "both"},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{
+		Path: "/orders", Fault: models.SoapFault{Code: "Nobody", Reason: "unknown code"},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, wsdlUrl, "POST", routes.ImportWsdlRequest{Path: "/orders", Wsdl: "<definitions/>"}, http.StatusBadRequest)
+
+	var operations []routes.WsdlOperation
+	if err := json.Unmarshal(expectStatus(t, client, wsdlUrl, "POST", routes.ImportWsdlRequest{Path: "/orders", Wsdl: testOrdersWsdl}, http.StatusCreated), &operations); err != nil {
+		t.Fatalf("error decoding the WSDL operations: %v", err)
+	}
+	if len(operations) != 1 || operations[0].Action != "urn:shop:orders/GetOrder" ||
+		!strings.Contains(operations[0].Request, `<GetOrder xmlns="urn:shop:orders"><id>?</id></GetOrder>`) {
+		t.Fatalf("unexpected WSDL operations %+v", operations)
+	}
+
+	// the scaffolded mock answers the sample request with a sample response
+	status, contentType, body := postEnvelope("text/xml; charset=utf-8", operations[0].Action, operations[0].Request)
+	if status != 200 || !strings.HasPrefix(contentType, "text/xml") ||
+		!strings.Contains(body, `<GetOrderResponse xmlns="urn:shop:orders"><order><id>?</id><total>0</total><status>OPEN</status></order></GetOrderResponse>`) {
+		t.Fatalf("expected the sample response, but found %d %s %s", status, contentType, body)
+	}
+
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{
+		Path: "/orders", Action: "urn:shop:orders/GetOrder",
+		Namespaces: models.StringMap{"o": "urn:shop:orders"},
+		XPaths: models.XPathMatches{
+			{Expression: "/soap:Envelope/soap:Body/o:GetOrder"},
+			{Expression: "/soap:Envelope/soap:Body/o:GetOrder/o:id", Equals: "42"},
+		},
+		Body: `<GetOrderResponse xmlns="urn:shop:orders"><order><id>42</id></order></GetOrderResponse>`,
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateSoapMockRequest{
+		Path: "/orders", Namespaces: models.StringMap{"o": "urn:shop:orders"},
+		XPaths: models.XPathMatches{{Expression: "count(//o:id[. = '404'])", Equals: "1"}},
+		Fault:  models.SoapFault{Code: "Client", Reason: "order <404> not found", Detail: `<code xmlns="urn:shop:orders">NOT_FOUND</code>`},
+	}, http.StatusCreated)
+
+	getOrder := func(namespace string, id string) string {
+		return `<env:Envelope xmlns:env="` + namespace + `"><env:Body><GetOrder xmlns="urn:shop:orders"><id>` + id + `</id></GetOrder></env:Body></env:Envelope>`
+	}
+	status, _, body = postEnvelope("text/xml", "urn:shop:orders/GetOrder", getOrder("http://schemas.xmlsoap.org/soap/envelope/", "42"))
+	if status != 200 || !strings.Contains(body, "<id>42</id>") {
+		t.Fatalf("expected the order 42, but found %d %s", status, body)
+	}
+	// SOAP 1.2 gives the action in the content type, and gets its faults in SOAP 1.2
+	status, contentType, body = postEnvelope(`application/soap+xml; charset=utf-8; action="urn:shop:orders/GetOrder"`, "", getOrder("http://www.w3.org/2003/05/soap-envelope", "42"))
+	if status != 200 || !strings.HasPrefix(contentType, "application/soap+xml") || !strings.Contains(body, "<id>42</id>") {
+		t.Fatalf("expected the order 42 over SOAP 1.2, but found %d %s %s", status, contentType, body)
+	}
+	status, contentType, body = postEnvelope("application/soap+xml", "", getOrder("http://www.w3.org/2003/05/soap-envelope", "404"))
+	if status != 500 || !strings.HasPrefix(contentType, "application/soap+xml") ||
+		!strings.Contains(body, "<soap:Value>soap:Sender</soap:Value>") || !strings.Contains(body, "order &lt;404&gt; not found") ||
+		!strings.Contains(body, `<soap:Detail><code xmlns="urn:shop:orders">NOT_FOUND</code></soap:Detail>`) {
+		t.Fatalf("expected the SOAP 1.2 fault, but found %d %s %s", status, contentType, body)
+	}
+	status, _, body = postEnvelope("text/xml", "", getOrder("http://schemas.xmlsoap.org/soap/envelope/", "404"))
+	if status != 500 || !strings.Contains(body, "<faultcode>soap:Client</faultcode>") {
+		t.Fatalf("expected the SOAP 1.1 fault, but found %d %s", status, body)
+	}
+	// the scaffolded mock needs the SOAPAction, so nothing matches without it
+	status, _, body = postEnvelope("text/xml", "", getOrder("http://schemas.xmlsoap.org/soap/envelope/", "7"))
+	if status != 500 || !strings.Contains(body, "no SOAP mock matches") {
+		t.Fatalf("expected a fault when no mock matches, but found %d %s", status, body)
+	}
+	status, _, body = postEnvelope("text/xml", "", "<GetOrder/>")
+	if status != 400 || !strings.Contains(body, "not a SOAP envelope") {
+		t.Fatalf("expected a fault for a request that is not an envelope, but found %d %s", status, body)
+	}
+
+	var mocks []models.SoapMock
+	if err := json.Unmarshal(expectStatus(t, client, mocksUrl, "GET", nil, http.StatusOK), &mocks); err != nil {
+		t.Fatalf("error decoding the SOAP mocks: %v", err)
+	}
+	if len(mocks) != 3 || mocks[0].XPaths[0].Expression != "/soap:Envelope/soap:Body/tns:GetOrder" || mocks[2].Fault.Code != "Client" || mocks[2].Status != 500 {
+		t.Fatalf("expected the SOAP mocks, but found %+v", mocks)
+	}
+	expectStatus(t, client, mocksUrl+"/"+strconv.FormatInt(mocks[2].Id, 10), "DELETE", nil, http.StatusNoContent)
+	expectStatus(t, client, mocksUrl+"/"+strconv.FormatInt(mocks[2].Id, 10), "DELETE", nil, http.StatusNotFound)
+
+	if !mocks[0].Imported || mocks[1].Imported {
+		t.Fatalf("expected only the scaffolded mock to be imported, but found %+v", mocks)
+	}
+
+	// importing the WSDL again replaces the scaffolded mock of its action, and keeps the hand-written one
+	expectStatus(t, client, wsdlUrl, "POST", routes.ImportWsdlRequest{Path: "/orders", Wsdl: testOrdersWsdl}, http.StatusCreated)
+	handWritten := mocks[1]
+	mocks = nil
+	if err := json.Unmarshal(expectStatus(t, client, mocksUrl, "GET", nil, http.StatusOK), &mocks); err != nil {
+		t.Fatalf("error decoding the SOAP mocks: %v", err)
+	}
+	if len(mocks) != 2 || mocks[0].Id != handWritten.Id || mocks[0].Imported ||
+		!mocks[1].Imported || mocks[1].Action != "urn:shop:orders/GetOrder" || len(mocks[1].XPaths) != 1 {
+		t.Fatalf("expected the hand-written and the scaffolded mocks, but found %+v", mocks)
+	}
+	status, _, body = postEnvelope("text/xml", "urn:shop:orders/GetOrder", getOrder("http://schemas.xmlsoap.org/soap/envelope/", "42"))
+	if status != 200 || !strings.Contains(body, "<id>42</id>") {
+		t.Fatalf("expected the order 42 after the import, but found %d %s", status, body)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamingResponses(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "feed"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/feed/mocks"
+	body := "all at once"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/both", Method: "GET", Status: 200, ResponseBody: &body,
+		Stream: models.ResponseStream{Type: models.ChunkedStream, Chunks: []models.StreamChunk{{Data: "a"}}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/ws", Method: "GET", Status: 200,
+		Stream: models.ResponseStream{Type: "websocket", Chunks: []models.StreamChunk{{Data: "a"}}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/empty", Method: "GET", Status: 200,
+		Stream: models.ResponseStream{Type: models.SseStream},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/chunks", Method: "GET", Status: 200,
+		Stream: models.ResponseStream{Type: models.ChunkedStream, Chunks: []models.StreamChunk{{Data: "a", Event: "letter"}}},
+	}, http.StatusBadRequest)
+
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/completions", Method: "POST", Status: 200,
+		Stream: models.ResponseStream{Type: models.SseStream, Chunks: []models.StreamChunk{
+			{Data: `{"token":"Hello"}`, Id: "1"},
+			{Data: `{"token":" world"}`, Id: "2", DelayMs: 200},
+			{Data: "[DONE]\nbye", Event: "done", DelayMs: 50},
+		}},
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateNewMockRequest{
+		Path: "/progress", Method: "GET", Status: 202,
+		Stream: models.ResponseStream{Type: models.ChunkedStream, ContentType: "application/x-ndjson", Chunks: []models.StreamChunk{
+			{Data: "{\"done\":10}\n"},
+			{Data: "{\"done\":100}\n", DelayMs: 100},
+		}},
+	}, http.StatusCreated)
+
+	res, err := sendRequest(client, BASE_URL+"/sarab/feed/completions", "POST", nil)
+	if err != nil {
+		t.Fatalf("error calling the SSE mock: %v", err)
+	}
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected a 200 event stream, but found %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(res.Body)
+	readEvent := func() string {
+		t.Helper()
+		var event strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error reading the event stream: %v", err)
+			}
+			if line == "\n" {
+				return event.String()
+			}
+			event.WriteString(line)
+		}
+	}
+	start := time.Now()
+	if event := readEvent(); event != "id: 1\ndata: {\"token\":\"Hello\"}\n" {
+		t.Fatalf("unexpected first event %q", event)
+	}
+	// the first event is flushed before the next one is due
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("expected the first event right away, but it took %v", elapsed)
+	}
+	if event := readEvent(); event != "id: 2\ndata: {\"token\":\" world\"}\n" {
+		t.Fatalf("unexpected second event %q", event)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the second event after its delay, but it took %v", elapsed)
+	}
+	if event := readEvent(); event != "event: done\ndata: [DONE]\ndata: bye\n" {
+		t.Fatalf("unexpected last event %q", event)
+	}
+	res.Body.Close()
+
+	res, err = sendRequest(client, BASE_URL+"/sarab/feed/progress", "GET", nil)
+	if err != nil {
+		t.Fatalf("error calling the chunked mock: %v", err)
+	}
+	progress, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 202 || res.Header.Get("Content-Type") != "application/x-ndjson" || !slices.Contains(res.TransferEncoding, "chunked") {
+		t.Fatalf("expected a 202 chunked ndjson response, but found %d %s %v", res.StatusCode, res.Header.Get("Content-Type"), res.TransferEncoding)
+	}
+	if string(progress) != "{\"done\":10}\n{\"done\":100}\n" {
+		t.Fatalf("unexpected chunked body %q", progress)
+	}
+
+	res, err = sendRequest(client, mocksUrl, "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting the mocks: %v", err)
+	}
+	var mocks []models.Mock
+	if err := json.NewDecoder(res.Body).Decode(&mocks); err != nil {
+		t.Fatalf("error decoding the mocks: %v", err)
+	}
+	res.Body.Close()
+	if len(mocks) != 2 || mocks[0].Stream.Type != models.SseStream || len(mocks[1].Stream.Chunks) != 2 {
+		t.Fatalf("expected the mocks with their streams, but found %+v", mocks)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"moksarab/certs"
+	"moksarab/config"
+	"moksarab/routes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TLS_PORT = "8443"
+
+func TestHttpsWithGeneratedCa(t *testing.T) {
+
+	config.TlsPort = TLS_PORT
+	defer func() { config.TlsPort = "" }()
+
+	app := beforeEach()
+	if err := listenTLS(app); err != nil {
+		t.Fatalf("error serving HTTPS: %v", err)
+	}
+
+	caRes, err := sendRequest(&http.Client{}, BASE_URL+"/api/tls/ca", "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting the CA: %v", err)
+	}
+	defer caRes.Body.Close()
+	caPem, _ := io.ReadAll(caRes.Body)
+	if caRes.StatusCode != http.StatusOK {
+		t.Fatalf("expected getting the CA to be 200, but found %d", caRes.StatusCode)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPem) {
+		t.Fatalf("expected a PEM certificate, but found %s", caPem)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	httpsUrl := "https://localhost:" + TLS_PORT
+	createWorkspaceRes, err := sendRequest(client, httpsUrl+"/api/workspaces", "POST", map[string]string{"name": "secure"})
+	if err != nil {
+		t.Fatalf("error creating workspace over HTTPS: %v", err)
+	}
+	createWorkspaceRes.Body.Close()
+
+	mock := routes.CreateNewMockRequest{Path: "/payments", Method: "GET", Status: 200}
+	createMockRes, err := sendRequest(client, httpsUrl+"/api/workspaces/secure/mocks", "POST", mock)
+	if err != nil {
+		t.Fatalf("error creating mock over HTTPS: %v", err)
+	}
+	createMockRes.Body.Close()
+	if createMockRes.StatusCode != http.StatusCreated {
+		t.Fatalf("expected creating mock over HTTPS to be 201, but found %d", createMockRes.StatusCode)
+	}
+
+	sarabRes, err := sendRequest(client, httpsUrl+"/sarab/secure/payments", "GET", nil)
+	if err != nil {
+		t.Fatalf("error calling sarab over HTTPS: %v", err)
+	}
+	sarabRes.Body.Close()
+	if sarabRes.StatusCode != http.StatusOK {
+		t.Fatalf("expected sarab over HTTPS to be 200, but found %d", sarabRes.StatusCode)
+	}
+
+	if _, err := sendRequest(&http.Client{}, httpsUrl+"/sarab/secure/payments", "GET", nil); err == nil {
+		t.Fatal("expected a client not trusting the CA to fail")
+	}
+
+	afterEach(t, app)
+}
+
+func TestHttpsWithSuppliedCertificate(t *testing.T) {
+
+	// a certificate generated beforehand stands for the supplied one
+	if err := certs.LoadCertificate(); err != nil {
+		t.Fatalf("error generating certificate: %v", err)
+	}
+	certificate := certs.Certificate()
+	key, err := x509.MarshalECPrivateKey(certificate.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("error marshaling key: %v", err)
+	}
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certs.GeneratedCaPem())
+
+	config.TlsPort, config.TlsCertFile, config.TlsKeyFile = TLS_PORT, certFile, keyFile
+	defer func() { config.TlsPort, config.TlsCertFile, config.TlsKeyFile = "", "", "" }()
+
+	app := beforeEach()
+	if err := listenTLS(app); err != nil {
+		t.Fatalf("error serving HTTPS: %v", err)
+	}
+
+	caRes, err := sendRequest(&http.Client{}, BASE_URL+"/api/tls/ca", "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting the CA: %v", err)
+	}
+	caRes.Body.Close()
+	if caRes.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected no CA with a supplied certificate, but found %d", caRes.StatusCode)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	workspacesRes, err := sendRequest(client, "https://localhost:"+TLS_PORT+"/api/workspaces", "GET", nil)
+	if err != nil {
+		t.Fatalf("error calling the API over HTTPS: %v", err)
+	}
+	workspacesRes.Body.Close()
+	if workspacesRes.StatusCode != http.StatusOK {
+		t.Fatalf("expected listing workspaces over HTTPS to be 200, but found %d", workspacesRes.StatusCode)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"testing"
+)
+
+const ordersOpenapiDocument = `
+openapi: 3.0.3
+info:
+  title: Orders
+  version: "1.0"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /orders:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Order"
+      responses:
+        "201":
+          description: Created
+  /orders/latest:
+    get:
+      responses:
+        "200":
+          description: OK
+  /orders/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+          minimum: 1
+    get:
+      parameters:
+        - name: X-Tenant
+          in: header
+          required: true
+          schema:
+            type: string
+            pattern: "^[a-z]+$"
+        - name: expand
+          in: query
+          schema:
+            type: string
+            enum: [items, customer]
+      responses:
+        "200":
+          description: OK
+components:
+  schemas:
+    Order:
+      type: object
+      required: [customer, items]
+      properties:
+        customer:
+          type: string
+          minLength: 1
+        items:
+          type: array
+          minItems: 1
+          items:
+            type: object
+            required: [sku, quantity]
+            properties:
+              sku:
+                type: string
+              quantity:
+                type: integer
+                minimum: 1
+`
+
+func TestOpenapiRequestValidation(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	getOrder := func(url string, tenant string, status int) []byte {
+		t.Helper()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("error creating GET %s: %v", url, err)
+		}
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("error sending GET %s: %v", url, err)
+		}
+		defer res.Body.Close()
+		raw, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("error reading GET %s: %v", url, err)
+		}
+		if res.StatusCode != status {
+			t.Fatalf("expected GET %s to be %d, but found %d: %s", url, status, res.StatusCode, raw)
+		}
+		return raw
+	}
+	type violationsResponse struct {
+		Message    string                    `json:"message"`
+		Violations []models.RequestViolation `json:"violations"`
+	}
+	expectViolations := func(raw []byte, expected ...models.RequestViolation) {
+		t.Helper()
+		var response violationsResponse
+		if err := json.Unmarshal(raw, &response); err != nil {
+			t.Fatalf("error decoding the violations: %v", err)
+		}
+		if len(response.Violations) != len(expected) {
+			t.Fatalf("expected %d violations, but found %s", len(expected), raw)
+		}
+		for _, want := range expected {
+			found := false
+			for _, violation := range response.Violations {
+				found = found || (violation.In == want.In && violation.Name == want.Name && violation.Message != "")
+			}
+			if !found {
+				t.Fatalf("expected a violation of %s %s, but found %s", want.In, want.Name, raw)
+			}
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "contracts"}, http.StatusCreated)
+	openapiUrl := BASE_URL + "/api/workspaces/contracts/openapi"
+	expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: ordersOpenapiDocument, Validation: "sloppy"}, http.StatusBadRequest)
+	var saved routes.OpenapiDocumentResponse
+	if err := json.Unmarshal(expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: ordersOpenapiDocument, Validation: "strict"}, http.StatusOK), &saved); err != nil {
+		t.Fatalf("error decoding the document: %v", err)
+	}
+	if saved.Validation != models.StrictValidation {
+		t.Fatalf("expected the strict validation, but found %+v", saved.OpenapiDocument.Validation)
+	}
+
+	mocksUrl := BASE_URL + "/api/workspaces/contracts/mocks"
+	body := `{"id":7}`
+	for _, mock := range []routes.CreateNewMockRequest{
+		{Path: "/orders/:id", Method: "GET", Status: 200, ResponseBody: &body},
+		{Path: "/orders/latest", Method: "GET", Status: 200, ResponseBody: &body},
+		{Path: "/orders", Method: "POST", Status: 201, ResponseBody: &body},
+		{Path: "/v1/orders", Method: "POST", Status: 201, ResponseBody: &body},
+		{Path: "/unlisted", Method: "GET", Status: 200, ResponseBody: &body},
+	} {
+		expectStatus(t, client, mocksUrl, "POST", mock, http.StatusCreated)
+	}
+
+	ordersUrl := BASE_URL + "/sarab/contracts/orders"
+	getOrder(ordersUrl+"/7?expand=items", "acme", http.StatusOK)
+	expectViolations(getOrder(ordersUrl+"/0?expand=everything", "", http.StatusBadRequest),
+		models.RequestViolation{In: "path", Name: "id"},
+		models.RequestViolation{In: "query", Name: "expand"},
+		models.RequestViolation{In: "header", Name: "X-Tenant"},
+	)
+	expectViolations(getOrder(ordersUrl+"/seven", "ACME", http.StatusBadRequest),
+		models.RequestViolation{In: "path", Name: "id"},
+		models.RequestViolation{In: "header", Name: "X-Tenant"},
+	)
+	// the literal path wins over the path with a param
+	getOrder(ordersUrl+"/latest", "", http.StatusOK)
+
+	order := map[string]any{"customer": "Ann", "items": []map[string]any{{"sku": "tea", "quantity": 2}}}
+	expectStatus(t, client, ordersUrl, "POST", order, http.StatusCreated)
+	expectViolations(expectStatus(t, client, ordersUrl, "POST", map[string]any{"items": []map[string]any{{"sku": "tea", "quantity": 0}}}, http.StatusBadRequest),
+		models.RequestViolation{In: "body", Name: "/customer"},
+		models.RequestViolation{In: "body", Name: "/items/0/quantity"},
+	)
+	// the paths are also validated under the path of the servers
+	expectStatus(t, client, BASE_URL+"/sarab/contracts/v1/orders", "POST", map[string]any{"customer": "", "items": []any{}}, http.StatusBadRequest)
+	expectStatus(t, client, BASE_URL+"/sarab/contracts/v1/orders", "POST", order, http.StatusCreated)
+	expectStatus(t, client, BASE_URL+"/sarab/contracts/unlisted", "GET", nil, http.StatusOK)
+
+	// in lenient mode the request is served, and the violations are only in the journal
+	expectStatus(t, client, openapiUrl, "PUT", routes.SetOpenapiDocumentRequest{Document: ordersOpenapiDocument, Validation: "lenient"}, http.StatusOK)
+	expectStatus(t, client, BASE_URL+"/api/workspaces/contracts/journal", "DELETE", nil, http.StatusNoContent)
+	getOrder(ordersUrl+"/7", "acme", http.StatusOK)
+	if raw := getOrder(ordersUrl+"/0", "acme", http.StatusOK); !bytes.Equal(raw, []byte(body)) {
+		t.Fatalf("expected the mock response, but found %s", raw)
+	}
+
+	var entries []models.JournalEntry
+	if err := json.Unmarshal(expectStatus(t, client, BASE_URL+"/api/workspaces/contracts/journal?protocol=http", "GET", nil, http.StatusOK), &entries); err != nil {
+		t.Fatalf("error decoding the journal: %v", err)
+	}
+	if len(entries) != 2 || len(entries[0].Violations) != 0 || len(entries[1].Violations) != 1 ||
+		entries[1].Violations[0].In != "path" || entries[1].Violations[0].Name != "id" {
+		t.Fatalf("expected the violations of the second request in the journal, but found %+v", entries)
+	}
+
+	afterEach(t, app)
+}
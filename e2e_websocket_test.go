@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"moksarab/models"
+	"moksarab/routes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+func TestWebsocketMocks(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	dial := func(path string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(BASE_URL, "http", "ws", 1)+"/sarab/chat"+path, nil)
+		if err != nil {
+			t.Fatalf("error connecting to %s: %v", path, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	expectMessage := func(conn *websocket.Conn, expected string) {
+		t.Helper()
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("error reading message %s: %v", expected, err)
+		}
+		if string(message) != expected {
+			t.Fatalf("expected message %s, but found %s", expected, message)
+		}
+	}
+	expectClose := func(conn *websocket.Conn, code int) {
+		t.Helper()
+		_, message, err := conn.ReadMessage()
+		var closeError *websocket.CloseError
+		if !errors.As(err, &closeError) || closeError.Code != code {
+			t.Fatalf("expected the connection to close with %d, but found %s, %v", code, message, err)
+		}
+	}
+
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "chat"}, http.StatusCreated)
+	mocksUrl := BASE_URL + "/api/workspaces/chat/websockets"
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{Path: "/ws"}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{
+		Path:  "/ws",
+		Steps: []models.WebsocketStep{{Type: models.ExpectStep}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{
+		Path:  "/ws",
+		Steps: []models.WebsocketStep{{Type: models.CloseStep, Code: 1006}},
+	}, http.StatusBadRequest)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{
+		Path: "/ws",
+		Steps: []models.WebsocketStep{
+			{Type: models.SendStep, Message: `{"type":"welcome"}`},
+			{Type: models.ExpectStep, Match: &models.MessageMatch{Json: map[string]any{"type": "join"}}, TimeoutMs: 2000},
+			{Type: models.SendStep, Message: `{"type":"joined"}`, DelayMs: 50},
+			{Type: models.CloseStep, Code: 4000, Reason: "bye", DelayMs: 50},
+		},
+		Replies: []models.WebsocketReply{{Match: models.MessageMatch{Equals: "ping"}, Message: "pong"}},
+	}, http.StatusCreated)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{
+		Path:    "/ws",
+		Replies: []models.WebsocketReply{{Message: "duplicate"}},
+	}, http.StatusConflict)
+	expectStatus(t, client, mocksUrl, "POST", routes.CreateWebsocketMockRequest{
+		Path:  "/strict",
+		Steps: []models.WebsocketStep{{Type: models.ExpectStep, Match: &models.MessageMatch{Regex: "^hello"}, TimeoutMs: 100}},
+	}, http.StatusCreated)
+	expectStatus(t, client, BASE_URL+"/api/workspaces/chat/journal", "DELETE", nil, http.StatusNoContent)
+
+	conn := dial("/ws")
+	expectMessage(conn, `{"type":"welcome"}`)
+	// the messages the expect step doesn't match are answered by the replies
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	expectMessage(conn, "pong")
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"join","room":"lobby"}`))
+	expectMessage(conn, `{"type":"joined"}`)
+	expectClose(conn, 4000)
+	conn.Close()
+
+	conn = dial("/strict")
+	expectClose(conn, websocket.ClosePolicyViolation)
+	conn.Close()
+
+	// a plain request to the path is left to the mocks
+	expectStatus(t, client, BASE_URL+"/sarab/chat/ws", "GET", nil, http.StatusNotFound)
+
+	res, err := sendRequest(client, BASE_URL+"/api/workspaces/chat/journal?protocol=websocket", "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting the journal: %v", err)
+	}
+	var entries []models.JournalEntry
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		t.Fatalf("error decoding the journal: %v", err)
+	}
+	res.Body.Close()
+	var frames []string
+	for _, entry := range entries {
+		frames = append(frames, entry.Direction+" "+entry.Message)
+	}
+	expected := []string{`out {"type":"welcome"}`, "in ping", "out pong", `in {"type":"join","room":"lobby"}`, `out {"type":"joined"}`, "out bye"}
+	if len(frames) < len(expected) || strings.Join(frames[:len(expected)], "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected the frames %q, but found %q", expected, frames)
+	}
+	if entries[5].CloseCode != 4000 || entries[0].Connection == "" || entries[0].Path != "/ws" {
+		t.Fatalf("unexpected close frame %+v", entries[5])
+	}
+	strictClosed := slices.ContainsFunc(entries, func(entry models.JournalEntry) bool {
+		return entry.Path == "/strict" && entry.Direction == "out" && entry.CloseCode == websocket.ClosePolicyViolation
+	})
+	if !strictClosed {
+		t.Fatalf("expected the strict connection to be closed for the missing message, but found %+v", entries)
+	}
+
+	res, err = sendRequest(client, BASE_URL+"/api/workspaces/chat/journal?protocol=http", "GET", nil)
+	if err != nil {
+		t.Fatalf("error getting the journal: %v", err)
+	}
+	entries = nil
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		t.Fatalf("error decoding the journal: %v", err)
+	}
+	res.Body.Close()
+	if len(entries) != 3 || entries[0].Status != http.StatusSwitchingProtocols || entries[2].Status != http.StatusNotFound {
+		t.Fatalf("expected the upgrades and the plain request in the journal, but found %+v", entries)
+	}
+
+	afterEach(t, app)
+}
+
+func TestJournalLeavesOutAccessToken(t *testing.T) {
+
+	app := beforeEach()
+
+	client := &http.Client{}
+	expectStatus(t, client, BASE_URL+"/api/workspaces", "POST", models.Workspace{Name: "vault"}, http.StatusCreated)
+	expectStatus(t, client, BASE_URL+"/api/workspaces/vault/mocks", "POST", routes.CreateNewMockRequest{Path: "/secrets", Method: "GET", Status: 200}, http.StatusCreated)
+	var rotated routes.RotateWorkspaceAccessTokenResponse
+	if err := json.Unmarshal(expectStatus(t, client, BASE_URL+"/api/workspaces/vault/token", "POST", nil, http.StatusOK), &rotated); err != nil {
+		t.Fatalf("error decoding the access token: %v", err)
+	}
+
+	res, err := http.Get(BASE_URL + "/sarab/vault/secrets?page=2&sarab_token=" + rotated.AccessToken)
+	if err != nil {
+		t.Fatalf("error calling sarab: %v", err)
+	}
+	res.Body.Close()
+	req, _ := http.NewRequest("GET", BASE_URL+"/sarab/vault/secrets", nil)
+	req.Header.Set("X-Sarab-Token", rotated.AccessToken)
+	if res, err = client.Do(req); err != nil {
+		t.Fatalf("error calling sarab: %v", err)
+	}
+	res.Body.Close()
+
+	raw := expectStatus(t, client, BASE_URL+"/api/workspaces/vault/journal", "GET", nil, http.StatusOK)
+	var entries []models.JournalEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		t.Fatalf("error decoding the journal: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Query != "page=2" || entries[1].Query != "" || strings.Contains(string(raw), rotated.AccessToken) {
+		t.Fatalf("expected the requests without their access token in the journal, but found %s", raw)
+	}
+
+	afterEach(t, app)
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// roleRanks orders the roles, a role is allowed everything the lower ranked roles are
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+func (r Role) IsValid() bool {
+	_, found := roleRanks[r]
+	return found
+}
+
+func (r Role) Includes(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+type ApiKey struct {
+	Id         int64        `json:"id,omitempty"`
+	Name       string       `json:"name"`
+	Role       Role         `json:"role"`
+	Workspaces WorkspaceIds `json:"workspaces"`
+	KeyHash    string       `json:"-"`
+}
+
+// CanAccess tells if the key is scoped to the workspace, only an admin key can access all of them.
+func (k *ApiKey) CanAccess(workspaceId int64) bool {
+	return k.Role == RoleAdmin || slices.Contains(k.Workspaces, workspaceId)
+}
+
+// WorkspaceIds are stored in api_key.workspaces as a JSON array
+type WorkspaceIds []int64
+
+func (w *WorkspaceIds) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*w = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), w)
+	case []byte:
+		return json.Unmarshal(v, w)
+	default:
+		return fmt.Errorf("cannot scan %T into WorkspaceIds", value)
+	}
+}
+
+func (w WorkspaceIds) Value() (driver.Value, error) {
+	if len(w) == 0 {
+		return nil, nil
+	}
+	value, err := json.Marshal([]int64(w))
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+const createApiKeyTableQuery = `
+	CREATE TABLE IF NOT EXISTS api_key (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		role TEXT NOT NULL,
+		workspaces TEXT
+	);
+`
@@ -0,0 +1,34 @@
+package models
+
+// Callback is an HTTP request fired after a delay whenever the mock response ResponseId is served, retried until it gets a 2xx.
+type Callback struct {
+	Id         int64  `json:"id"`
+	Workspace  int64  `json:"workspace"`
+	ResponseId int64  `json:"response_id"`
+	Method     string `json:"method"`
+	// Url, the values of Headers, and Body are Go templates of the request that triggered the callback
+	Url     string    `json:"url"`
+	Headers StringMap `json:"headers,omitempty"`
+	Body    string    `json:"body,omitempty"`
+	DelayMs int       `json:"delay_ms"`
+	// MaxAttempts is the number of deliveries tried, RetryDelayMs doubling after every failed one
+	MaxAttempts  int `json:"max_attempts"`
+	RetryDelayMs int `json:"retry_delay_ms"`
+}
+
+const createCallbackTableQuery = `
+	CREATE TABLE IF NOT EXISTS callback (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		response_id INTEGER NOT NULL,
+		method TEXT NOT NULL,
+		url TEXT NOT NULL,
+		headers TEXT NOT NULL DEFAULT '{}',
+		body TEXT NOT NULL DEFAULT '',
+		delay_ms INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		retry_delay_ms INTEGER NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		FOREIGN KEY (response_id) REFERENCES route_response(id)
+	);
+`
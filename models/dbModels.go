@@ -1,11 +1,45 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 type Workspace struct {
-	Id          int64  `json:"id,omitempty"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Id          int64         `json:"id,omitempty"`
+	Name        string        `json:"name"`
+	Slug        string        `json:"slug"`
+	Type        WorkspaceType `json:"type"`
+	Description string        `json:"description"`
+	// Port is the workspace own listener port, serving its mocks at the root, if any
+	Port *int `json:"port,omitempty"`
+	// PortTls serves the workspace listener over HTTPS
+	PortTls bool `json:"port_tls,omitempty"`
+	// PortClientCa is the PEM of the CAs the client certificates of the workspace listener must be issued by, requiring mTLS when set
+	PortClientCa *string `json:"port_client_ca,omitempty"`
+	// AccessTokenHash is the hash of the token required by the workspace /sarab endpoints, if any
+	AccessTokenHash sql.NullString `json:"-"`
+}
+
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// IsValidSlug tells if the slug is URL safe, and not all digits so it can never be mistaken for a workspace id.
+func IsValidSlug(slug string) bool {
+	return validSlug.MatchString(slug) && strings.Trim(slug, "0123456789") != ""
+}
+
+// Slugify derives a slug from a workspace name, e.g. "Checkout Team" becomes "checkout-team".
+func Slugify(name string) string {
+	slug := strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if !IsValidSlug(slug) {
+		slug = strings.Trim("workspace-"+slug, "-")
+	}
+	return slug
 }
 
 const createWorkspaceTableQuery = `
@@ -16,16 +50,39 @@ const createWorkspaceTableQuery = `
 	);
 `
 
+// WorkspaceHost maps a hostname to a workspace, so the requests to that host are served by the workspace mocks without the /sarab prefix.
+type WorkspaceHost struct {
+	Host      string `json:"host"`
+	Workspace int64  `json:"workspace"`
+}
+
+var validHost = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9\-]*[a-z0-9])?)*$`)
+
+// IsValidHost tells if the host is a hostname, without a port.
+func IsValidHost(host string) bool {
+	return len(host) <= 253 && validHost.MatchString(host)
+}
+
+const createWorkspaceHostTableQuery = `
+	CREATE TABLE IF NOT EXISTS workspace_host (
+		host TEXT PRIMARY KEY,
+		workspace INTEGER NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id)
+	);
+`
+
 type Route struct {
-	Id           int64          `json:"id"`
-	Path         string         `json:"path"`
-	ParentPath   sql.NullInt64  `json:"parent_path"`
-	IsParam      bool           `json:"is_param"`
-	ParamName    sql.NullString `json:"param_name"`
-	HasResponses bool           `json:"has_response"`
-	Workspace    int64          `json:"workspace"`
+	Id              int64          `json:"id"`
+	Path            string         `json:"path"`
+	ParentPath      sql.NullInt64  `json:"parent_path"`
+	IsParam         bool           `json:"is_param"`
+	ParamName       sql.NullString `json:"param_name"`
+	ParamConstraint sql.NullString `json:"param_constraint"`
+	HasResponses    bool           `json:"has_response"`
+	Workspace       int64          `json:"workspace"`
 }
 
+// createRouteTableQuery is the first version of the route table, see Migrations for the changes since.
 const createRouteTableQuery = `
 	CREATE TABLE IF NOT EXISTS route (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -44,10 +101,18 @@ const createRouteTableQuery = `
 type RouteResponse struct {
 	Id         int64          `json:"id"`
 	Path       int64          `json:"path"`
-	PathParams sql.NullString `json:"path_params"`
+	PathParams PathParams     `json:"path_params"`
 	Method     string         `json:"method"`
 	Status     int            `json:"status"`
 	Response   sql.NullString `json:"response"`
+	Matchers   Matchers       `json:"matchers,omitempty"`
+	Stream     ResponseStream `json:"stream,omitzero"`
+	// Templated renders Response with the fake data functions on every call
+	Templated bool `json:"templated,omitempty"`
+	// Schema is the JSON Schema the body is generated from on every call, which can $ref the components of the workspace OpenAPI document
+	Schema JsonValue `json:"schema,omitempty"`
+	// Seed makes a templated response, or a response generated from its Schema, the same on every call
+	Seed *int64 `json:"seed,omitempty"`
 }
 
 const createRouteResponseTableQuery = `
@@ -63,4 +128,84 @@ const createRouteResponseTableQuery = `
 	);
 `
 
-const CreateQueries = "PRAGMA foreign_key = ON; \n " + createWorkspaceTableQuery + " \n " + createRouteTableQuery + " \n " + createRouteResponseTableQuery
+// PathParams are the param values a response is specific to, stored in route_response.path_params as a JSON object
+type PathParams map[string]string
+
+func (p *PathParams) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case []byte:
+		return json.Unmarshal(v, p)
+	default:
+		return fmt.Errorf("cannot scan %T into PathParams", value)
+	}
+}
+
+func (p PathParams) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	// map keys are marshalled in sorted order, which keeps the UNIQUE constraint on path_params meaningful
+	value, err := json.Marshal(map[string]string(p))
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+// Mock is a route response along with the full path of its route.
+type Mock struct {
+	ResponseId   int64          `json:"response_id"`
+	FullPath     string         `json:"full_path"`
+	ParamNames   string         `json:"param_names"`
+	PathParams   PathParams     `json:"path_params,omitempty"`
+	Matchers     Matchers       `json:"matchers,omitempty"`
+	Method       string         `json:"method"`
+	ResponseBody sql.NullString `json:"response_body"`
+	Stream       ResponseStream `json:"stream,omitzero"`
+	Templated    bool           `json:"templated,omitempty"`
+	Schema       JsonValue      `json:"schema,omitempty"`
+	Seed         *int64         `json:"seed,omitempty"`
+	Status       int            `json:"status"`
+	DirectPathId int64          `json:"direct_path_id"`
+}
+
+// StringMap is stored as a JSON object of strings, e.g. soap_mock.namespaces by prefix or callback.headers by name.
+type StringMap map[string]string
+
+func (values *StringMap) Scan(value any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*values = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into StringMap", value)
+	}
+	if err := json.Unmarshal(raw, values); err != nil {
+		return err
+	}
+	if len(*values) == 0 {
+		*values = nil
+	}
+	return nil
+}
+
+func (values StringMap) Value() (driver.Value, error) {
+	if len(values) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// GraphqlMock is the response to the GraphQL operations posted to Path that match its operation type, name, and variables.
+type GraphqlMock struct {
+	Id        int64  `json:"id"`
+	Workspace int64  `json:"workspace"`
+	Path      string `json:"path"`
+	// OperationType is query, mutation, or subscription, any type when empty
+	OperationType string `json:"operation_type,omitempty"`
+	// OperationName is the name of the operation, any operation when empty
+	OperationName string `json:"operation_name,omitempty"`
+	// Variables must all be given with the same values, other variables are ignored
+	Variables JsonObject `json:"variables,omitempty"`
+	Status    int        `json:"status"`
+	// Data and Errors are returned as the data and errors of the GraphQL response
+	Data   JsonValue `json:"data,omitempty"`
+	Errors JsonValue `json:"errors,omitempty"`
+}
+
+// GraphqlSchema is the SDL of the GraphQL API at Path, validating its documents and generating the fields that are not mocked.
+type GraphqlSchema struct {
+	Workspace int64  `json:"workspace"`
+	Path      string `json:"path"`
+	Sdl       string `json:"sdl"`
+}
+
+// JsonObject is stored as a JSON object, never NULL so it can be part of a UNIQUE constraint, e.g. graphql_mock.variables.
+type JsonObject map[string]any
+
+func (object *JsonObject) Scan(value any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*object = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into JsonObject", value)
+	}
+	if err := json.Unmarshal(raw, object); err != nil {
+		return err
+	}
+	if len(*object) == 0 {
+		*object = nil
+	}
+	return nil
+}
+
+func (object JsonObject) Value() (driver.Value, error) {
+	if len(object) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// MatchedBy tells whether values has all the fields of the object with the same values, whatever its other fields.
+func (object JsonObject) MatchedBy(values map[string]any) bool {
+	for name, value := range object {
+		given, found := values[name]
+		if !found || !reflect.DeepEqual(value, given) {
+			return false
+		}
+	}
+	return true
+}
+
+// JsonValue is any JSON value but null kept as is, stored as TEXT which is NULL when there is no value.
+type JsonValue json.RawMessage
+
+func (value JsonValue) MarshalJSON() ([]byte, error) {
+	if value == nil {
+		return []byte("null"), nil
+	}
+	return value, nil
+}
+
+// UnmarshalJSON keeps null as no value, like a NULL column.
+func (value *JsonValue) UnmarshalJSON(raw []byte) error {
+	if string(raw) == "null" {
+		*value = nil
+		return nil
+	}
+	*value = append((*value)[:0], raw...)
+	return nil
+}
+
+func (value *JsonValue) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*value = nil
+	case string:
+		*value = JsonValue(v)
+	case []byte:
+		*value = append(JsonValue(nil), v...)
+	default:
+		return fmt.Errorf("cannot scan %T into JsonValue", src)
+	}
+	return nil
+}
+
+func (value JsonValue) Value() (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return string(value), nil
+}
+
+const createGraphqlTablesQuery = `
+	CREATE TABLE IF NOT EXISTS graphql_mock (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		operation_type TEXT NOT NULL DEFAULT '',
+		operation_name TEXT NOT NULL DEFAULT '',
+		variables TEXT NOT NULL DEFAULT '{}',
+		status INTEGER NOT NULL,
+		data TEXT,
+		errors TEXT,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		UNIQUE (workspace, path, operation_type, operation_name, variables)
+	);
+	CREATE TABLE IF NOT EXISTS graphql_schema (
+		workspace INTEGER PRIMARY KEY,
+		path TEXT NOT NULL,
+		sdl TEXT NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id)
+	);
+`
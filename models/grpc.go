@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+)
+
+// GrpcMock is the answer to the unary calls of Service/Method whose request has all the fields of Match.
+type GrpcMock struct {
+	Id        int64 `json:"id"`
+	Workspace int64 `json:"workspace"`
+	// Service is the full name of the service, e.g. helloworld.Greeter
+	Service string `json:"service"`
+	Method  string `json:"method"`
+	// Match are request fields, by their proto names, the request must have with the same values, any request when empty
+	Match JsonObject `json:"match,omitempty"`
+	// Response is the response message as JSON, returned when Code is OK
+	Response JsonValue `json:"response,omitempty"`
+	// Code and Message are the status of the call, given by name or number, e.g. NOT_FOUND or 5
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// GrpcSchema are the proto descriptors of the services a workspace serves over gRPC.
+type GrpcSchema struct {
+	Workspace     int64              `json:"workspace"`
+	DescriptorSet ProtoDescriptorSet `json:"descriptor_set"`
+}
+
+// ProtoDescriptorSet is a serialized google.protobuf.FileDescriptorSet, stored in grpc_schema.descriptor_set as base64.
+type ProtoDescriptorSet []byte
+
+func (set *ProtoDescriptorSet) Scan(value any) error {
+	var encoded string
+	switch v := value.(type) {
+	case string:
+		encoded = v
+	case []byte:
+		encoded = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ProtoDescriptorSet", value)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	*set = raw
+	return nil
+}
+
+func (set ProtoDescriptorSet) Value() (driver.Value, error) {
+	return base64.StdEncoding.EncodeToString(set), nil
+}
+
+const createGrpcTablesQuery = `
+	CREATE TABLE IF NOT EXISTS grpc_mock (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		service TEXT NOT NULL,
+		method TEXT NOT NULL,
+		match_fields TEXT NOT NULL DEFAULT '{}',
+		response TEXT,
+		code INTEGER NOT NULL DEFAULT 0,
+		message TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		UNIQUE (workspace, service, method, match_fields)
+	);
+	CREATE TABLE IF NOT EXISTS grpc_schema (
+		workspace INTEGER PRIMARY KEY,
+		descriptor_set TEXT NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id)
+	);
+`
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// JournalEntry records a request or a gRPC call served by a workspace, a frame of one of its WebSocket connections,
+// or a delivery attempt of one of its callbacks.
+type JournalEntry struct {
+	Id        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	Workspace int64     `json:"workspace"`
+	// Protocol is http, grpc, websocket for the frames, or callback for the callback deliveries
+	Protocol string `json:"protocol"`
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path"`
+	Query    string `json:"query,omitempty"`
+	// Status is the HTTP status, or the status code of a gRPC call, 0 for a callback delivery without response
+	Status int `json:"status,omitempty"`
+	// Connection groups the frames of the same WebSocket connection
+	Connection string `json:"connection,omitempty"`
+	// Direction is in for the frames the client sent, and out for the ones sent to it
+	Direction string `json:"direction,omitempty"`
+	// Message is the request body, the frame payload, or the body of the callback
+	Message   string `json:"message,omitempty"`
+	CloseCode int    `json:"close_code,omitempty"`
+	// Attempt is the number of the callback delivery, and Error why it failed
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Violations are how an HTTP request breaks the OpenAPI document of the workspace
+	Violations []RequestViolation `json:"violations,omitempty"`
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// MatcherType is the part of the request a Matcher inspects.
+type MatcherType string
+
+const (
+	// ClientCertMatcher matches the verified client certificate of an mTLS request by its subject and SAN.
+	ClientCertMatcher MatcherType = "client_cert"
+	// JwtMatcher matches the bearer JWT of the Authorization header, verified with Secret or the keys of JwksUrl, by its claims.
+	JwtMatcher MatcherType = "jwt"
+)
+
+// Matcher is a condition on the request, besides the path params, that a response is specific to.
+type Matcher struct {
+	Type MatcherType `json:"type"`
+	// Subject is the sub of a jwt, or of a client_cert either the full subject, e.g. `CN=acme,O=Acme Bank`, or only its common name, any subject when empty
+	Subject string `json:"subject,omitempty"`
+	// San is one of the DNS names, emails, IPs, or URIs of the certificate, any SAN when empty
+	San string `json:"san,omitempty"`
+	// Secret verifies HS256 tokens, when the keys are not at JwksUrl
+	Secret string `json:"secret,omitempty"`
+	// JwksUrl is where the public keys verifying RS256 tokens are fetched from, e.g. the jwks of an oidc workspace
+	JwksUrl string `json:"jwks_url,omitempty"`
+	// Audience is one of the aud of the token, any audience when empty
+	Audience string `json:"audience,omitempty"`
+	// Scope are space separated scopes the token must all have, in its scope or scp claim
+	Scope string `json:"scope,omitempty"`
+}
+
+func (matcher Matcher) Validate() error {
+	switch matcher.Type {
+	case ClientCertMatcher:
+		if matcher.Secret != "" || matcher.JwksUrl != "" || matcher.Audience != "" || matcher.Scope != "" {
+			return fmt.Errorf("a client_cert matcher only has subject and san")
+		}
+		return nil
+	case JwtMatcher:
+		if matcher.San != "" {
+			return fmt.Errorf("a jwt matcher has no san")
+		}
+		if (matcher.Secret == "") == (matcher.JwksUrl == "") {
+			return fmt.Errorf("a jwt matcher needs either a secret or a jwks_url")
+		}
+		if matcher.JwksUrl != "" {
+			jwksUrl, err := url.Parse(matcher.JwksUrl)
+			if err != nil || (jwksUrl.Scheme != "http" && jwksUrl.Scheme != "https") || jwksUrl.Host == "" {
+				return fmt.Errorf("jwks_url [%s] must be an http or https URL", matcher.JwksUrl)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("matcher type [%s] is not supported, it must be %s or %s", matcher.Type, ClientCertMatcher, JwtMatcher)
+}
+
+// Matchers are stored in route_response.matchers as a JSON array, all of them must match for the response to be used.
+type Matchers []Matcher
+
+func (matchers *Matchers) Scan(value any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*matchers = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into Matchers", value)
+	}
+	if err := json.Unmarshal(raw, matchers); err != nil {
+		return err
+	}
+	if len(*matchers) == 0 {
+		*matchers = nil
+	}
+	return nil
+}
+
+// Value is never NULL, so responses differing only by their matchers are told apart by the UNIQUE constraint.
+func (matchers Matchers) Value() (driver.Value, error) {
+	if len(matchers) == 0 {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(matchers)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,466 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Migration is a numbered schema change, applied in a single transaction either by running Query or by calling Apply.
+type Migration struct {
+	Version     int
+	Description string
+	Query       string
+	// Apply gets rebind to turn the `?` placeholders of its queries into the ones of the database
+	Apply func(transaction *sql.Tx, rebind func(query string) string) error
+}
+
+const CreateSchemaVersionTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// Migrations are ordered by version. Once released a migration must never change, add a new one instead.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create workspace, route, and route_response tables",
+		Query:       createWorkspaceTableQuery + " \n " + createRouteTableQuery + " \n " + createRouteResponseTableQuery,
+	},
+	{
+		Version:     2,
+		Description: "add route.param_constraint and make it part of the route UNIQUE constraint",
+		Query: `
+			CREATE TABLE route_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL,
+				parent_path INTEGER,
+				is_param BOOLEAN DEFAULT 0,
+				param_name TEXT,
+				param_constraint TEXT,
+				has_responses BOOLEAN DEFAULT 0,
+				workspace INTEGER NOT NULL,
+				FOREIGN KEY (workspace) REFERENCES workspace(id),
+				FOREIGN KEY (parent_path) REFERENCES route(id),
+				UNIQUE (path, workspace, parent_path, param_constraint)
+			);
+			INSERT INTO route_new (id, path, parent_path, is_param, param_name, has_responses, workspace)
+				SELECT id, path, parent_path, is_param, param_name, has_responses, workspace FROM route;
+			DROP TABLE route;
+			ALTER TABLE route_new RENAME TO route;
+		`,
+	},
+	{
+		Version:     3,
+		Description: "convert route_response.path_params from 'name:value, ...' to JSON objects",
+		Apply:       convertLegacyPathParams,
+	},
+	{
+		Version:     4,
+		Description: "create api_key table",
+		Query:       createApiKeyTableQuery,
+	},
+	{
+		Version:     5,
+		Description: "add workspace.access_token_hash",
+		Query:       "ALTER TABLE workspace ADD COLUMN access_token_hash TEXT;",
+	}, {
+		Version:     6,
+		Description: "add workspace.slug derived from the workspace name",
+		Apply:       addWorkspaceSlug,
+	},
+	{
+		Version:     7,
+		Description: "create workspace_host table",
+		Query:       createWorkspaceHostTableQuery,
+	},
+	{
+		Version:     8,
+		Description: "add workspace.port",
+		Query:       "ALTER TABLE workspace ADD COLUMN port INTEGER; CREATE UNIQUE INDEX workspace_port ON workspace (port);",
+	}, {
+		Version:     9,
+		Description: "add workspace.port_tls and workspace.port_client_ca",
+		Query:       "ALTER TABLE workspace ADD COLUMN port_tls BOOLEAN NOT NULL DEFAULT 0; ALTER TABLE workspace ADD COLUMN port_client_ca TEXT;",
+	},
+	{
+		Version:     10,
+		Description: "add route_response.matchers and make it part of the route_response UNIQUE constraint",
+		Query: `
+			CREATE TABLE route_response_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path INTEGER NOT NULL,
+				path_params TEXT,
+				method TEXT NOT NULL,
+				status INTEGER NOT NULL,
+				response TEXT,
+				matchers TEXT NOT NULL DEFAULT '[]',
+				FOREIGN KEY (path) REFERENCES route(id),
+				UNIQUE (path_params, path, method, matchers)
+			);
+			INSERT INTO route_response_new (id, path, path_params, method, status, response)
+				SELECT id, path, path_params, method, status, response FROM route_response;
+			DROP TABLE route_response;
+			ALTER TABLE route_response_new RENAME TO route_response;
+		`,
+	}, {
+		Version:     11,
+		Description: "add workspace.type and create oidc_provider table",
+		Query:       "ALTER TABLE workspace ADD COLUMN type TEXT NOT NULL DEFAULT 'mock'; " + createOidcProviderTableQuery,
+	}, {
+		Version:     12,
+		Description: "create graphql_mock and graphql_schema tables",
+		Query:       createGraphqlTablesQuery,
+	}, {
+		Version:     13,
+		Description: "create websocket_mock table",
+		Query:       createWebsocketMockTableQuery,
+	}, {
+		Version:     14,
+		Description: "add route_response.stream",
+		Query:       "ALTER TABLE route_response ADD COLUMN stream TEXT;",
+	}, {
+		Version:     15,
+		Description: "create grpc_mock and grpc_schema tables",
+		Query:       createGrpcTablesQuery,
+	}, {
+		Version:     16,
+		Description: "create soap_mock table",
+		Query:       createSoapMockTableQuery,
+	}, {
+		Version:     17,
+		Description: "create callback table",
+		Query:       createCallbackTableQuery,
+	}, {
+		Version:     18,
+		Description: "create resource and resource_item tables",
+		Query:       createResourceTablesQuery,
+	}, {
+		Version:     19,
+		Description: "add route_response.templated and route_response.seed",
+		Query:       "ALTER TABLE route_response ADD COLUMN templated BOOLEAN NOT NULL DEFAULT 0; ALTER TABLE route_response ADD COLUMN seed INTEGER;",
+	}, {
+		Version:     20,
+		Description: "add route_response.schema and create openapi_document table",
+		Query:       "ALTER TABLE route_response ADD COLUMN schema TEXT; " + createOpenapiDocumentTableQuery,
+	}, {
+		Version:     21,
+		Description: "add openapi_document.validation",
+		Query:       "ALTER TABLE openapi_document ADD COLUMN validation TEXT NOT NULL DEFAULT 'lenient';",
+	}, {
+		Version:     22,
+		Description: "add soap_mock.imported",
+		Query:       "ALTER TABLE soap_mock ADD COLUMN imported BOOLEAN NOT NULL DEFAULT 0;",
+	},
+}
+
+func convertLegacyPathParams(transaction *sql.Tx, rebind func(query string) string) error {
+	rows, err := transaction.Query("SELECT id, path_params FROM route_response WHERE path_params IS NOT NULL AND path_params NOT LIKE '{%'")
+	if err != nil {
+		return err
+	}
+
+	converted := make(map[int64]PathParams)
+	for rows.Next() {
+		var id int64
+		var legacy string
+		if err := rows.Scan(&id, &legacy); err != nil {
+			rows.Close()
+			return err
+		}
+		// the legacy format is "id:1, name:x"
+		pathParams := make(PathParams)
+		for part := range strings.SplitSeq(legacy, ", ") {
+			kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+			if len(kv) == 2 {
+				pathParams[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		converted[id] = pathParams
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, pathParams := range converted {
+		if _, err := transaction.Exec(rebind("UPDATE route_response SET path_params = ? WHERE id = ?"), pathParams, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addWorkspaceSlug(transaction *sql.Tx, rebind func(query string) string) error {
+	if _, err := transaction.Exec("ALTER TABLE workspace ADD COLUMN slug TEXT; CREATE UNIQUE INDEX workspace_slug ON workspace (slug);"); err != nil {
+		return err
+	}
+
+	rows, err := transaction.Query("SELECT id, name FROM workspace ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	slugs := make(map[int64]string)
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		slug := Slugify(name)
+		// different names can give the same slug, e.g. "Team A" and "team-a"
+		if taken[slug] {
+			slug = fmt.Sprintf("%s-%d", slug, id)
+		}
+		taken[slug] = true
+		slugs[id] = slug
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, slug := range slugs {
+		if _, err := transaction.Exec(rebind("UPDATE workspace SET slug = ? WHERE id = ?"), slug, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostgresMigrations are the Migrations of the PostgreSQL backend, which started from the latest SQLite schema.
+var PostgresMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create workspace, route, and route_response tables",
+		Query: `
+			CREATE TABLE IF NOT EXISTS workspace (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT UNIQUE NOT NULL,
+				description TEXT
+			);
+			CREATE TABLE IF NOT EXISTS route (
+				id BIGSERIAL PRIMARY KEY,
+				path TEXT NOT NULL,
+				parent_path BIGINT REFERENCES route(id),
+				is_param BOOLEAN DEFAULT FALSE,
+				param_name TEXT,
+				param_constraint TEXT,
+				has_responses BOOLEAN DEFAULT FALSE,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				UNIQUE (path, workspace, parent_path, param_constraint)
+			);
+			CREATE TABLE IF NOT EXISTS route_response (
+				id BIGSERIAL PRIMARY KEY,
+				path BIGINT NOT NULL REFERENCES route(id),
+				path_params TEXT,
+				method TEXT NOT NULL,
+				status INTEGER NOT NULL,
+				response TEXT,
+				UNIQUE (path_params, path, method)
+			);
+		`,
+	},
+	{
+		Version:     2,
+		Description: "create api_key table",
+		Query: `
+			CREATE TABLE IF NOT EXISTS api_key (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT UNIQUE NOT NULL,
+				key_hash TEXT UNIQUE NOT NULL,
+				role TEXT NOT NULL,
+				workspaces TEXT
+			);
+		`,
+	},
+	{
+		Version:     3,
+		Description: "add workspace.access_token_hash",
+		Query:       "ALTER TABLE workspace ADD COLUMN access_token_hash TEXT;",
+	}, {
+		Version:     4,
+		Description: "add workspace.slug derived from the workspace name",
+		Apply:       addWorkspaceSlug,
+	},
+	{
+		Version:     5,
+		Description: "create workspace_host table",
+		Query: `
+			CREATE TABLE IF NOT EXISTS workspace_host (
+				host TEXT PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id)
+			);
+		`,
+	},
+	{
+		Version:     6,
+		Description: "add workspace.port",
+		Query:       "ALTER TABLE workspace ADD COLUMN port INTEGER; CREATE UNIQUE INDEX workspace_port ON workspace (port);",
+	}, {
+		Version:     7,
+		Description: "add workspace.port_tls and workspace.port_client_ca",
+		Query:       "ALTER TABLE workspace ADD COLUMN port_tls BOOLEAN NOT NULL DEFAULT FALSE; ALTER TABLE workspace ADD COLUMN port_client_ca TEXT;",
+	},
+	{
+		Version:     8,
+		Description: "add route_response.matchers and make it part of the route_response UNIQUE constraint",
+		Query: `
+			ALTER TABLE route_response ADD COLUMN matchers TEXT NOT NULL DEFAULT '[]';
+			ALTER TABLE route_response DROP CONSTRAINT route_response_path_params_path_method_key;
+			ALTER TABLE route_response ADD UNIQUE (path_params, path, method, matchers);
+		`,
+	}, {
+		Version:     9,
+		Description: "add workspace.type and create oidc_provider table",
+		Query: `
+			ALTER TABLE workspace ADD COLUMN type TEXT NOT NULL DEFAULT 'mock';
+			CREATE TABLE IF NOT EXISTS oidc_provider (
+				workspace BIGINT PRIMARY KEY REFERENCES workspace(id),
+				settings TEXT NOT NULL,
+				signing_key TEXT NOT NULL
+			);
+		`,
+	}, {
+		Version:     10,
+		Description: "create graphql_mock and graphql_schema tables",
+		Query: `
+			CREATE TABLE IF NOT EXISTS graphql_mock (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				path TEXT NOT NULL,
+				operation_type TEXT NOT NULL DEFAULT '',
+				operation_name TEXT NOT NULL DEFAULT '',
+				variables TEXT NOT NULL DEFAULT '{}',
+				status INTEGER NOT NULL,
+				data TEXT,
+				errors TEXT,
+				UNIQUE (workspace, path, operation_type, operation_name, variables)
+			);
+			CREATE TABLE IF NOT EXISTS graphql_schema (
+				workspace BIGINT PRIMARY KEY REFERENCES workspace(id),
+				path TEXT NOT NULL,
+				sdl TEXT NOT NULL
+			);
+		`,
+	}, {
+		Version:     11,
+		Description: "create websocket_mock table",
+		Query: `
+			CREATE TABLE IF NOT EXISTS websocket_mock (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				path TEXT NOT NULL,
+				script TEXT NOT NULL,
+				UNIQUE (workspace, path)
+			);
+		`,
+	}, {
+		Version:     12,
+		Description: "add route_response.stream",
+		Query:       "ALTER TABLE route_response ADD COLUMN stream TEXT;",
+	}, {
+		Version:     13,
+		Description: "create grpc_mock and grpc_schema tables",
+		Query: `
+			CREATE TABLE IF NOT EXISTS grpc_mock (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				service TEXT NOT NULL,
+				method TEXT NOT NULL,
+				match_fields TEXT NOT NULL DEFAULT '{}',
+				response TEXT,
+				code INTEGER NOT NULL DEFAULT 0,
+				message TEXT NOT NULL DEFAULT '',
+				UNIQUE (workspace, service, method, match_fields)
+			);
+			CREATE TABLE IF NOT EXISTS grpc_schema (
+				workspace BIGINT PRIMARY KEY REFERENCES workspace(id),
+				descriptor_set TEXT NOT NULL
+			);
+		`,
+	}, {
+		Version:     14,
+		Description: "create soap_mock table",
+		Query: `
+			CREATE TABLE IF NOT EXISTS soap_mock (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				path TEXT NOT NULL,
+				action TEXT NOT NULL DEFAULT '',
+				xpaths TEXT NOT NULL DEFAULT '[]',
+				namespaces TEXT NOT NULL DEFAULT '{}',
+				status INTEGER NOT NULL,
+				body TEXT NOT NULL DEFAULT '',
+				fault TEXT,
+				UNIQUE (workspace, path, action, xpaths)
+			);
+		`,
+	}, {
+		Version:     15,
+		Description: "create callback table",
+		Query: `
+			CREATE TABLE IF NOT EXISTS callback (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				response_id BIGINT NOT NULL REFERENCES route_response(id),
+				method TEXT NOT NULL,
+				url TEXT NOT NULL,
+				headers TEXT NOT NULL DEFAULT '{}',
+				body TEXT NOT NULL DEFAULT '',
+				delay_ms INTEGER NOT NULL DEFAULT 0,
+				max_attempts INTEGER NOT NULL,
+				retry_delay_ms INTEGER NOT NULL
+			);
+		`,
+	}, {
+		Version:     16,
+		Description: "create resource and resource_item tables",
+		Query: `
+			CREATE TABLE IF NOT EXISTS resource (
+				id BIGSERIAL PRIMARY KEY,
+				workspace BIGINT NOT NULL REFERENCES workspace(id),
+				path TEXT NOT NULL,
+				id_field TEXT NOT NULL,
+				state TEXT NOT NULL,
+				seed TEXT,
+				UNIQUE (workspace, path)
+			);
+			CREATE TABLE IF NOT EXISTS resource_item (
+				id BIGSERIAL PRIMARY KEY,
+				resource BIGINT NOT NULL REFERENCES resource(id),
+				item_id TEXT NOT NULL,
+				data TEXT NOT NULL,
+				UNIQUE (resource, item_id)
+			);
+		`,
+	}, {
+		Version:     17,
+		Description: "add route_response.templated and route_response.seed",
+		Query:       "ALTER TABLE route_response ADD COLUMN templated BOOLEAN NOT NULL DEFAULT FALSE; ALTER TABLE route_response ADD COLUMN seed BIGINT;",
+	}, {
+		Version:     18,
+		Description: "add route_response.schema and create openapi_document table",
+		Query: `
+			ALTER TABLE route_response ADD COLUMN schema TEXT;
+			CREATE TABLE IF NOT EXISTS openapi_document (
+				workspace BIGINT PRIMARY KEY REFERENCES workspace(id),
+				document TEXT NOT NULL
+			);
+		`,
+	}, {
+		Version:     19,
+		Description: "add openapi_document.validation",
+		Query:       "ALTER TABLE openapi_document ADD COLUMN validation TEXT NOT NULL DEFAULT 'lenient';",
+	}, {
+		Version:     20,
+		Description: "add soap_mock.imported",
+		Query:       "ALTER TABLE soap_mock ADD COLUMN imported BOOLEAN NOT NULL DEFAULT FALSE;",
+	},
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// WorkspaceType tells which built-in endpoints a workspace serves besides its mocks.
+type WorkspaceType string
+
+const (
+	MockWorkspace WorkspaceType = "mock"
+	// OidcWorkspace serves a stub OAuth2 / OpenID Connect provider, see OidcProvider
+	OidcWorkspace WorkspaceType = "oidc"
+)
+
+func (workspaceType WorkspaceType) IsValid() bool {
+	return workspaceType == MockWorkspace || workspaceType == OidcWorkspace
+}
+
+// OidcProvider is the stub provider of an oidc workspace, which signs its tokens with SigningKey.
+type OidcProvider struct {
+	Workspace int64        `json:"workspace"`
+	Settings  OidcSettings `json:"settings"`
+	// SigningKey is the PEM of the RSA key the tokens are signed with, generated with the provider
+	SigningKey string `json:"-"`
+}
+
+// OidcSettings are the configurable part of an OidcProvider, stored in oidc_provider.settings as JSON.
+type OidcSettings struct {
+	Clients []OidcClient `json:"clients"`
+	Users   []OidcUser   `json:"users"`
+	// Claims are added to every issued token
+	Claims map[string]any `json:"claims,omitempty"`
+	// TokenLifetime is in seconds
+	TokenLifetime int `json:"token_lifetime"`
+}
+
+type OidcClient struct {
+	ClientId string `json:"client_id"`
+	// ClientSecret is empty for public clients, which must use PKCE instead
+	ClientSecret string `json:"client_secret,omitempty"`
+	// RedirectUris are the allowed redirect_uri values, at least one is required
+	RedirectUris []string `json:"redirect_uris"`
+	// Claims are added to the tokens issued to the client
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type OidcUser struct {
+	Subject string `json:"sub"`
+	// Claims are added to the tokens of the user and returned by userinfo, e.g. name and email
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// DefaultOidcSettings are the settings of a new provider, so it works before being configured.
+func DefaultOidcSettings() OidcSettings {
+	return OidcSettings{
+		Clients: []OidcClient{{ClientId: "moksarab", ClientSecret: "moksarab-secret", RedirectUris: []string{"http://localhost:3000/callback"}}},
+		Users: []OidcUser{{
+			Subject: "alice",
+			Claims:  map[string]any{"name": "Alice", "email": "alice@example.com", "email_verified": true},
+		}},
+		TokenLifetime: 3600,
+	}
+}
+
+func (settings OidcSettings) Validate() error {
+	if settings.TokenLifetime <= 0 {
+		return fmt.Errorf("token_lifetime must be a positive number of seconds")
+	}
+	clientIds := make(map[string]bool)
+	for _, client := range settings.Clients {
+		if client.ClientId == "" || clientIds[client.ClientId] {
+			return fmt.Errorf("client_id must be given and unique, found [%s]", client.ClientId)
+		}
+		clientIds[client.ClientId] = true
+		if len(client.RedirectUris) == 0 {
+			return fmt.Errorf("client [%s] must have at least one redirect_uris", client.ClientId)
+		}
+		for _, redirectUri := range client.RedirectUris {
+			if parsed, err := url.Parse(redirectUri); err != nil || !parsed.IsAbs() {
+				return fmt.Errorf("redirect_uris of client [%s] must be absolute URLs, found [%s]", client.ClientId, redirectUri)
+			}
+		}
+	}
+	subjects := make(map[string]bool)
+	for _, user := range settings.Users {
+		if user.Subject == "" || subjects[user.Subject] {
+			return fmt.Errorf("user sub must be given and unique, found [%s]", user.Subject)
+		}
+		subjects[user.Subject] = true
+	}
+	return nil
+}
+
+func (settings *OidcSettings) Scan(value any) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), settings)
+	case []byte:
+		return json.Unmarshal(v, settings)
+	}
+	return fmt.Errorf("cannot scan %T into OidcSettings", value)
+}
+
+func (settings OidcSettings) Value() (driver.Value, error) {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+const createOidcProviderTableQuery = `
+	CREATE TABLE IF NOT EXISTS oidc_provider (
+		workspace INTEGER PRIMARY KEY,
+		settings TEXT NOT NULL,
+		signing_key TEXT NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id)
+	);
+`
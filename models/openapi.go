@@ -0,0 +1,34 @@
+package models
+
+const (
+	// StrictValidation answers the requests breaking the OpenAPI document with a 400
+	StrictValidation = "strict"
+	// LenientValidation serves the requests breaking the OpenAPI document, and only records why in the journal
+	LenientValidation = "lenient"
+)
+
+// OpenapiDocument is the OpenAPI 3 document of a workspace, as JSON or YAML, whose component schemas the responses can be generated from.
+// The requests to its operations are validated against it.
+type OpenapiDocument struct {
+	Workspace int64  `json:"workspace"`
+	Document  string `json:"document"`
+	// Validation is strict or lenient
+	Validation string `json:"validation"`
+}
+
+// RequestViolation is how a request breaks the OpenAPI document of its workspace.
+type RequestViolation struct {
+	// In is path, query, header, or cookie for a parameter, and body for the request body
+	In string `json:"in"`
+	// Name is the name of the parameter, or the JSON pointer of the invalid value of the body
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+const createOpenapiDocumentTableQuery = `
+	CREATE TABLE IF NOT EXISTS openapi_document (
+		workspace INTEGER PRIMARY KEY,
+		document TEXT NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id)
+	);
+`
@@ -0,0 +1,48 @@
+package models
+
+// the places the items of a resource are kept in
+const (
+	// MemoryResourceState keeps the items in memory, so they are back to the seed on every start
+	MemoryResourceState = "memory"
+	// DatabaseResourceState stores the items with the rest of the workspace
+	DatabaseResourceState = "database"
+)
+
+// Resource is a REST collection served at Path, whose items are JSON objects identified by their IdField.
+type Resource struct {
+	Id        int64  `json:"id"`
+	Workspace int64  `json:"workspace"`
+	Path      string `json:"path"`
+	IdField   string `json:"id_field"`
+	State     string `json:"state"`
+	// Seed is the JSON array of the items the resource starts with, and is reset to
+	Seed JsonValue `json:"seed,omitempty"`
+}
+
+// ResourceItem is an item of a resource, by the value of its id field as a string.
+type ResourceItem struct {
+	Resource int64      `json:"resource"`
+	ItemId   string     `json:"item_id"`
+	Data     JsonObject `json:"data"`
+}
+
+const createResourceTablesQuery = `
+	CREATE TABLE IF NOT EXISTS resource (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		id_field TEXT NOT NULL,
+		state TEXT NOT NULL,
+		seed TEXT,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		UNIQUE (workspace, path)
+	);
+	CREATE TABLE IF NOT EXISTS resource_item (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		resource INTEGER NOT NULL,
+		item_id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		FOREIGN KEY (resource) REFERENCES resource(id),
+		UNIQUE (resource, item_id)
+	);
+`
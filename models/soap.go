@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// SoapMock answers the SOAP envelopes posted to Path with its SOAPAction, and matching all its XPaths.
+type SoapMock struct {
+	Id        int64  `json:"id"`
+	Workspace int64  `json:"workspace"`
+	Path      string `json:"path"`
+	// Action is the SOAPAction of the requests, any action when empty
+	Action string       `json:"action,omitempty"`
+	XPaths XPathMatches `json:"xpaths,omitempty"`
+	// Namespaces are the prefixes the XPaths use, besides soap which is always the namespace of the request envelope
+	Namespaces StringMap `json:"namespaces,omitempty"`
+	Status     int       `json:"status"`
+	// Body is the content of the soap:Body of the response envelope
+	Body  string    `json:"body,omitempty"`
+	Fault SoapFault `json:"fault,omitzero"`
+	// Imported is set on the mocks scaffolded from a WSDL, which the next import at the path replaces
+	Imported bool `json:"imported"`
+}
+
+// XPathMatch matches when its expression selects a node, or is true, and when Equals is given the value of a node or of the expression is Equals.
+type XPathMatch struct {
+	Expression string `json:"expression"`
+	Equals     string `json:"equals,omitempty"`
+}
+
+// XPathMatches are stored in soap_mock.xpaths as a JSON array, never NULL so they are part of the UNIQUE constraint.
+type XPathMatches []XPathMatch
+
+func (matches *XPathMatches) Scan(value any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*matches = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into XPathMatches", value)
+	}
+	if err := json.Unmarshal(raw, matches); err != nil {
+		return err
+	}
+	if len(*matches) == 0 {
+		*matches = nil
+	}
+	return nil
+}
+
+func (matches XPathMatches) Value() (driver.Value, error) {
+	if len(matches) == 0 {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(matches)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// SoapFault is the fault a SOAP mock answers with instead of a body, in the SOAP version of the request.
+// It is stored in soap_mock.fault as JSON, which is NULL for the mocks answering with a body.
+type SoapFault struct {
+	// Code is Client or Server, or their SOAP 1.2 names Sender and Receiver, VersionMismatch, or MustUnderstand
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason"`
+	// Detail is the XML content of the fault detail
+	Detail string `json:"detail,omitempty"`
+}
+
+func (fault SoapFault) IsZero() bool {
+	return fault == SoapFault{}
+}
+
+func (fault *SoapFault) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*fault = SoapFault{}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), fault)
+	case []byte:
+		return json.Unmarshal(v, fault)
+	}
+	return fmt.Errorf("cannot scan %T into SoapFault", value)
+}
+
+func (fault SoapFault) Value() (driver.Value, error) {
+	if fault.IsZero() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(fault)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+const createSoapMockTableQuery = `
+	CREATE TABLE IF NOT EXISTS soap_mock (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		action TEXT NOT NULL DEFAULT '',
+		xpaths TEXT NOT NULL DEFAULT '[]',
+		namespaces TEXT NOT NULL DEFAULT '{}',
+		status INTEGER NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		fault TEXT,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		UNIQUE (workspace, path, action, xpaths)
+	);
+`
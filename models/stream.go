@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StreamType is how a ResponseStream is written.
+type StreamType string
+
+const (
+	// ChunkedStream writes every chunk as is, flushing it as an HTTP chunk
+	ChunkedStream StreamType = "chunked"
+	// SseStream writes every chunk as a Server-Sent Event
+	SseStream StreamType = "sse"
+)
+
+// ResponseStream is a response written chunk by chunk instead of at once, stored in route_response.stream as JSON,
+// which is NULL for the responses that are not streamed.
+type ResponseStream struct {
+	Type StreamType `json:"type"`
+	// ContentType of a chunked stream, text/plain by default, while an SSE stream is always text/event-stream
+	ContentType string        `json:"content_type,omitempty"`
+	Chunks      []StreamChunk `json:"chunks"`
+}
+
+type StreamChunk struct {
+	// DelayMs is how long to wait before writing the chunk
+	DelayMs int    `json:"delay_ms,omitempty"`
+	Data    string `json:"data"`
+	// Event and Id are the event type and id of an SSE event
+	Event string `json:"event,omitempty"`
+	Id    string `json:"id,omitempty"`
+}
+
+func (stream ResponseStream) IsZero() bool {
+	return stream.Type == "" && len(stream.Chunks) == 0
+}
+
+func (stream ResponseStream) Validate() error {
+	if stream.Type != ChunkedStream && stream.Type != SseStream {
+		return fmt.Errorf("stream type must be one of %s or %s", ChunkedStream, SseStream)
+	}
+	if len(stream.Chunks) == 0 {
+		return errors.New("a stream needs chunks")
+	}
+	if stream.Type == SseStream && stream.ContentType != "" {
+		return errors.New("an sse stream is always text/event-stream, content_type is only for chunked streams")
+	}
+	for i, chunk := range stream.Chunks {
+		if chunk.DelayMs < 0 {
+			return fmt.Errorf("chunk %d: delay_ms can't be negative", i)
+		}
+		if stream.Type == ChunkedStream && (chunk.Event != "" || chunk.Id != "") {
+			return fmt.Errorf("chunk %d: event and id are only for sse streams", i)
+		}
+		if strings.ContainsAny(chunk.Event+chunk.Id, "\r\n") {
+			return fmt.Errorf("chunk %d: event and id can't have line breaks", i)
+		}
+	}
+	return nil
+}
+
+func (stream *ResponseStream) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*stream = ResponseStream{}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), stream)
+	case []byte:
+		return json.Unmarshal(v, stream)
+	}
+	return fmt.Errorf("cannot scan %T into ResponseStream", value)
+}
+
+func (stream ResponseStream) Value() (driver.Value, error) {
+	if stream.IsZero() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(stream)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// WebsocketMock answers the WebSocket upgrades of Path by running its Script.
+type WebsocketMock struct {
+	Id        int64           `json:"id"`
+	Workspace int64           `json:"workspace"`
+	Path      string          `json:"path"`
+	Script    WebsocketScript `json:"script"`
+}
+
+// WebsocketStepType is what a WebsocketStep does.
+type WebsocketStepType string
+
+const (
+	// SendStep pushes Message to the client after DelayMs
+	SendStep WebsocketStepType = "send"
+	// ExpectStep waits for a client message matching Match, for up to TimeoutMs when set
+	ExpectStep WebsocketStepType = "expect"
+	// CloseStep closes the connection with Code and Reason after DelayMs
+	CloseStep WebsocketStepType = "close"
+)
+
+// WebsocketScript is run in order on every connection, while the client messages no expect step is waiting for are
+// answered by the first matching reply. It is stored in websocket_mock.script as JSON.
+type WebsocketScript struct {
+	Steps   []WebsocketStep  `json:"steps"`
+	Replies []WebsocketReply `json:"replies,omitempty"`
+}
+
+type WebsocketStep struct {
+	Type      WebsocketStepType `json:"type"`
+	Message   string            `json:"message,omitempty"`
+	DelayMs   int               `json:"delay_ms,omitempty"`
+	Match     *MessageMatch     `json:"match,omitempty"`
+	TimeoutMs int               `json:"timeout_ms,omitempty"`
+	Code      int               `json:"code,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+}
+
+type WebsocketReply struct {
+	Match   MessageMatch `json:"match"`
+	Message string       `json:"message"`
+	DelayMs int          `json:"delay_ms,omitempty"`
+}
+
+// MessageMatch matches a message by all the conditions it has, any message when it has none.
+type MessageMatch struct {
+	Equals   string `json:"equals,omitempty"`
+	Contains string `json:"contains,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	// Json are fields the message, as a JSON object, must have with the same values
+	Json map[string]any `json:"json,omitempty"`
+}
+
+func (match MessageMatch) Validate() error {
+	if match.Regex != "" {
+		if _, err := regexp.Compile(match.Regex); err != nil {
+			return fmt.Errorf("regex [%s] is invalid: %w", match.Regex, err)
+		}
+	}
+	return nil
+}
+
+func (match MessageMatch) Matches(message string) bool {
+	if match.Equals != "" && message != match.Equals {
+		return false
+	}
+	if match.Contains != "" && !strings.Contains(message, match.Contains) {
+		return false
+	}
+	if match.Regex != "" {
+		if matched, err := regexp.MatchString(match.Regex, message); err != nil || !matched {
+			return false
+		}
+	}
+	if len(match.Json) > 0 {
+		var object map[string]any
+		if err := json.Unmarshal([]byte(message), &object); err != nil {
+			return false
+		}
+		for field, value := range match.Json {
+			if given, found := object[field]; !found || !reflect.DeepEqual(given, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (script WebsocketScript) Validate() error {
+	for i, step := range script.Steps {
+		if step.DelayMs < 0 || step.TimeoutMs < 0 {
+			return fmt.Errorf("step %d: delay_ms and timeout_ms can't be negative", i)
+		}
+		switch step.Type {
+		case SendStep:
+		case ExpectStep:
+			if step.Match == nil {
+				return fmt.Errorf("step %d: an expect step needs a match", i)
+			}
+			if err := step.Match.Validate(); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		case CloseStep:
+			// 1000 to 4999 are the codes an endpoint can send, but the reserved 1004 to 1006 and 1015
+			if step.Code != 0 && (step.Code < 1000 || step.Code > 4999 || (step.Code >= 1004 && step.Code <= 1006) || step.Code == 1015) {
+				return fmt.Errorf("step %d: close code [%d] can't be sent", i, step.Code)
+			}
+		default:
+			return fmt.Errorf("step %d: type must be one of %s, %s, or %s", i, SendStep, ExpectStep, CloseStep)
+		}
+	}
+	for i, reply := range script.Replies {
+		if reply.DelayMs < 0 {
+			return fmt.Errorf("reply %d: delay_ms can't be negative", i)
+		}
+		if err := reply.Match.Validate(); err != nil {
+			return fmt.Errorf("reply %d: %w", i, err)
+		}
+	}
+	if len(script.Steps) == 0 && len(script.Replies) == 0 {
+		return errors.New("a script needs steps or replies")
+	}
+	return nil
+}
+
+func (script *WebsocketScript) Scan(value any) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), script)
+	case []byte:
+		return json.Unmarshal(v, script)
+	}
+	return fmt.Errorf("cannot scan %T into WebsocketScript", value)
+}
+
+func (script WebsocketScript) Value() (driver.Value, error) {
+	raw, err := json.Marshal(script)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+const createWebsocketMockTableQuery = `
+	CREATE TABLE IF NOT EXISTS websocket_mock (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		script TEXT NOT NULL,
+		FOREIGN KEY (workspace) REFERENCES workspace(id),
+		UNIQUE (workspace, path)
+	);
+`
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"embed"
+	"flag"
+	"moksarab/certs"
 	"moksarab/config"
 	"moksarab/database"
 	"moksarab/routes"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
@@ -36,12 +44,17 @@ func InitilizeMocSarabServer() *fiber.App {
 		Views:         templateEngine,
 	})
 
+	if config.WorkspaceEnabled {
+		// mapped hosts are served by their workspace mocks at the root, before any other route
+		app.Use(routes.HandleHostRequests)
+	}
+
 	routes.RegesiterUiRoutes(app)
 	app.Use("/public", adaptor.HTTPHandler(http.FileServer(http.FS(publicFS))))
 
 	var sarab fiber.Router
 	if config.WorkspaceEnabled {
-		sarab = app.Use("/sarab/:workspaceId/*", routes.HandleSarabRequests)
+		sarab = app.Use("/sarab/:workspace/*", routes.HandleSarabRequests)
 	} else {
 		sarab = app.Use("/sarab/*", routes.HandleSarabRequests)
 	}
@@ -49,15 +62,92 @@ func InitilizeMocSarabServer() *fiber.App {
 	api := app.Group("/api")
 
 	routes.RegisterAPIRoutes(api)
+
+	if config.WorkspaceEnabled {
+		if err := routes.StartWorkspaceListeners(context.Background(), app.Config().ServerHeader); err != nil {
+			log.Errorf("Could not start the workspace listeners: %v", err)
+		}
+		app.Hooks().OnShutdown(routes.ShutdownWorkspaceListeners)
+	}
+	app.Hooks().OnShutdown(routes.ShutdownCallbacks)
 	sarab.Use(routes.HandleSarabRequests)
 	return app
 }
 
+// listenTLS serves the app over HTTPS on config.TlsPort in the background, it stops with the app Shutdown.
+func listenTLS(app *fiber.App) error {
+	if err := certs.LoadCertificate(); err != nil {
+		return err
+	}
+	tlsConfig, err := certs.ServerConfig()
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", ":"+config.TlsPort, tlsConfig)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := app.Listener(listener); err != nil {
+			log.Errorf("HTTPS listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// listenGrpc serves the gRPC mocks on config.GrpcPort in the background, it stops with the app Shutdown.
+func listenGrpc(app *fiber.App) error {
+	listener, err := net.Listen("tcp", ":"+config.GrpcPort)
+	if err != nil {
+		return err
+	}
+	server := routes.NewGrpcServer()
+	app.Hooks().OnShutdown(func() error {
+		server.Stop()
+		return nil
+	})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Errorf("gRPC listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
 func main() {
+	pendingMigrations := flag.Bool("pending-migrations", false, "print the pending database migrations and exit")
+	flag.Parse()
+
+	if *pendingMigrations {
+		database.PrintPendingMigrations()
+		return
+	}
+
 	database.InitilizeDatabase()
-	defer database.Db.Close()
+	defer database.Store.Close()
 
 	app := InitilizeMocSarabServer()
 
-	log.Fatal(app.Listen(":" + config.Port))
+	if config.TlsPort != "" {
+		if err := listenTLS(app); err != nil {
+			log.Fatalf("Could not serve HTTPS: %v", err)
+		}
+	}
+	if config.GrpcPort != "" {
+		if err := listenGrpc(app); err != nil {
+			log.Fatalf("Could not serve gRPC: %v", err)
+		}
+	}
+
+	// shut down gracefully, so that the deferred storage Close runs, e.g. to write the memory storage snapshot
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		_ = app.Shutdown()
+	}()
+
+	if err := app.Listen(":" + config.Port); err != nil {
+		log.Error(err)
+	}
 }
@@ -1,12 +1,16 @@
 package routes
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"moksarab/config"
 	"moksarab/database"
 	"moksarab/models"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,16 +18,100 @@ import (
 )
 
 func RegisterAPIRoutes(router fiber.Router) {
+	if config.AdminApiKey != "" {
+		router.Use(authenticateApiKey)
+		router.Post("/keys", requireRole(models.RoleAdmin), createApiKey)
+		router.Get("/keys", requireRole(models.RoleAdmin), getApiKeys)
+		router.Delete("/keys/:keyId", requireRole(models.RoleAdmin), deleteApiKey)
+	}
+
+	router.Get("/tls/ca", requireRole(models.RoleViewer), getTlsCa)
+
+	editor := []fiber.Handler{requireRole(models.RoleEditor), loadWorkspace, checkWorkspaceAccess}
+	viewer := []fiber.Handler{requireRole(models.RoleViewer), loadWorkspace, checkWorkspaceAccess}
 	if config.WorkspaceEnabled {
-		router.Post("/workspaces", createWorkspace)
-		router.Get("/workspaces", getWorkspaces)
-		router.Post("/workspaces/:workspaceId/mocks", createNewMock)
-		router.Get("/workspaces/:workspaceId/mocks", getMocks)
-		router.Post("/workspaces/:workspaceId/mocks/:mockId", createMockResponse)
+		router.Post("/workspaces", requireRole(models.RoleAdmin), createWorkspace)
+		router.Get("/workspaces", requireRole(models.RoleViewer), getWorkspaces)
+		router.Patch("/workspaces/:workspace", requireRole(models.RoleAdmin), loadWorkspace, updateWorkspace)
+		router.Post("/workspaces/:workspace/mocks", append(editor, createNewMock)...)
+		router.Get("/workspaces/:workspace/mocks", append(viewer, getMocks)...)
+		router.Post("/workspaces/:workspace/mocks/:mockId", append(editor, createMockResponse)...)
+		router.Post("/workspaces/:workspace/token", append(editor, rotateWorkspaceAccessToken)...)
+		router.Delete("/workspaces/:workspace/token", append(editor, deleteWorkspaceAccessToken)...)
+		// the workspace listeners are bound on the host, so only the admins can open or close them
+		router.Put("/workspaces/:workspace/port", requireRole(models.RoleAdmin), loadWorkspace, setWorkspacePort)
+		router.Delete("/workspaces/:workspace/port", requireRole(models.RoleAdmin), loadWorkspace, deleteWorkspacePort)
+		router.Get("/workspaces/:workspace/oidc", append(viewer, getOidcSettings)...)
+		router.Put("/workspaces/:workspace/oidc", append(editor, setOidcSettings)...)
+		router.Post("/workspaces/:workspace/graphql/mocks", append(editor, createGraphqlMock)...)
+		router.Get("/workspaces/:workspace/graphql/mocks", append(viewer, getGraphqlMocks)...)
+		router.Delete("/workspaces/:workspace/graphql/mocks/:mockId", append(editor, deleteGraphqlMock)...)
+		router.Put("/workspaces/:workspace/graphql/schema", append(editor, setGraphqlSchema)...)
+		router.Get("/workspaces/:workspace/graphql/schema", append(viewer, getGraphqlSchema)...)
+		router.Delete("/workspaces/:workspace/graphql/schema", append(editor, deleteGraphqlSchema)...)
+		router.Post("/workspaces/:workspace/grpc/mocks", append(editor, createGrpcMock)...)
+		router.Get("/workspaces/:workspace/grpc/mocks", append(viewer, getGrpcMocks)...)
+		router.Delete("/workspaces/:workspace/grpc/mocks/:mockId", append(editor, deleteGrpcMock)...)
+		router.Put("/workspaces/:workspace/grpc/schema", append(editor, setGrpcSchema)...)
+		router.Get("/workspaces/:workspace/grpc/schema", append(viewer, getGrpcSchema)...)
+		router.Delete("/workspaces/:workspace/grpc/schema", append(editor, deleteGrpcSchema)...)
+		router.Put("/workspaces/:workspace/openapi", append(editor, setOpenapiDocument)...)
+		router.Get("/workspaces/:workspace/openapi", append(viewer, getOpenapiDocument)...)
+		router.Delete("/workspaces/:workspace/openapi", append(editor, deleteOpenapiDocument)...)
+		router.Post("/workspaces/:workspace/soap/mocks", append(editor, createSoapMock)...)
+		router.Get("/workspaces/:workspace/soap/mocks", append(viewer, getSoapMocks)...)
+		router.Delete("/workspaces/:workspace/soap/mocks/:mockId", append(editor, deleteSoapMock)...)
+		router.Post("/workspaces/:workspace/soap/wsdl", append(editor, importWsdl)...)
+		router.Post("/workspaces/:workspace/websockets", append(editor, createWebsocketMock)...)
+		router.Get("/workspaces/:workspace/websockets", append(viewer, getWebsocketMocks)...)
+		router.Delete("/workspaces/:workspace/websockets/:mockId", append(editor, deleteWebsocketMock)...)
+		router.Post("/workspaces/:workspace/resources", append(editor, createResource)...)
+		router.Get("/workspaces/:workspace/resources", append(viewer, getResources)...)
+		router.Delete("/workspaces/:workspace/resources/:resourceId", append(editor, deleteResource)...)
+		router.Post("/workspaces/:workspace/resources/:resourceId/reset", append(editor, resetResourceItems)...)
+		router.Post("/workspaces/:workspace/callbacks", append(editor, createCallback)...)
+		router.Get("/workspaces/:workspace/callbacks", append(viewer, getCallbacks)...)
+		router.Delete("/workspaces/:workspace/callbacks/:callbackId", append(editor, deleteCallback)...)
+		router.Get("/workspaces/:workspace/journal", append(viewer, getJournal)...)
+		router.Delete("/workspaces/:workspace/journal", append(editor, deleteJournal)...)
+		router.Post("/workspaces/:workspace/hosts", append(editor, addWorkspaceHost)...)
+		router.Get("/workspaces/:workspace/hosts", append(viewer, getWorkspaceHosts)...)
+		router.Delete("/workspaces/:workspace/hosts/:host", append(editor, deleteWorkspaceHost)...)
 	} else {
-		router.Post("/mocks", createNewMock)
-		router.Get("/mocks", getMocks)
-		router.Post("/mocks/:mockId", createMockResponse)
+		router.Post("/mocks", append(editor, createNewMock)...)
+		router.Get("/mocks", append(viewer, getMocks)...)
+		router.Post("/mocks/:mockId", append(editor, createMockResponse)...)
+		router.Post("/graphql/mocks", append(editor, createGraphqlMock)...)
+		router.Get("/graphql/mocks", append(viewer, getGraphqlMocks)...)
+		router.Delete("/graphql/mocks/:mockId", append(editor, deleteGraphqlMock)...)
+		router.Put("/graphql/schema", append(editor, setGraphqlSchema)...)
+		router.Get("/graphql/schema", append(viewer, getGraphqlSchema)...)
+		router.Delete("/graphql/schema", append(editor, deleteGraphqlSchema)...)
+		router.Post("/grpc/mocks", append(editor, createGrpcMock)...)
+		router.Get("/grpc/mocks", append(viewer, getGrpcMocks)...)
+		router.Delete("/grpc/mocks/:mockId", append(editor, deleteGrpcMock)...)
+		router.Put("/grpc/schema", append(editor, setGrpcSchema)...)
+		router.Get("/grpc/schema", append(viewer, getGrpcSchema)...)
+		router.Delete("/grpc/schema", append(editor, deleteGrpcSchema)...)
+		router.Put("/openapi", append(editor, setOpenapiDocument)...)
+		router.Get("/openapi", append(viewer, getOpenapiDocument)...)
+		router.Delete("/openapi", append(editor, deleteOpenapiDocument)...)
+		router.Post("/soap/mocks", append(editor, createSoapMock)...)
+		router.Get("/soap/mocks", append(viewer, getSoapMocks)...)
+		router.Delete("/soap/mocks/:mockId", append(editor, deleteSoapMock)...)
+		router.Post("/soap/wsdl", append(editor, importWsdl)...)
+		router.Post("/websockets", append(editor, createWebsocketMock)...)
+		router.Get("/websockets", append(viewer, getWebsocketMocks)...)
+		router.Delete("/websockets/:mockId", append(editor, deleteWebsocketMock)...)
+		router.Post("/resources", append(editor, createResource)...)
+		router.Get("/resources", append(viewer, getResources)...)
+		router.Delete("/resources/:resourceId", append(editor, deleteResource)...)
+		router.Post("/resources/:resourceId/reset", append(editor, resetResourceItems)...)
+		router.Post("/callbacks", append(editor, createCallback)...)
+		router.Get("/callbacks", append(viewer, getCallbacks)...)
+		router.Delete("/callbacks/:callbackId", append(editor, deleteCallback)...)
+		router.Get("/journal", append(viewer, getJournal)...)
+		router.Delete("/journal", append(editor, deleteJournal)...)
 	}
 }
 
@@ -42,15 +130,31 @@ func createWorkspace(c *fiber.Ctx) error {
 			"message": "workspace name cannot be empty.",
 		})
 	}
+	if reqBody.Slug == "" {
+		reqBody.Slug = models.Slugify(reqBody.Name)
+	}
+	if reqBody.Type == "" {
+		reqBody.Type = models.MockWorkspace
+	}
+	if !reqBody.Type.IsValid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "workspace type must be one of mock or oidc",
+		})
+	}
+	if !models.IsValidSlug(reqBody.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "workspace slug must be lowercase letters, digits, and dashes, and cannot be only digits",
+		})
+	}
 
-	var id int64
-	insertError := database.Db.QueryRowContext(c.Context(), "INSERT INTO workspace (name, description) VALUES (?, ?) RETURNING id",
-		reqBody.Name,
-		reqBody.Description,
-	).Scan(&id)
+	id, insertError := database.Store.CreateWorkspace(c.Context(), *reqBody)
 	if insertError != nil {
 		return HandleSQLErrors(c, insertError)
 	}
+	// a recreated database reuses the ids, the journal of a new workspace starts empty
+	clearJournal(id)
 	if c.Get("HX-Request", "false") == "true" {
 		c.Set("HX-Redirect", fmt.Sprintf("/workspaces/%d", id))
 	}
@@ -69,30 +173,10 @@ func getWorkspaces(c *fiber.Ctx) error {
 		})
 	}
 
-	rows, selectError := database.Db.QueryContext(c.Context(), "SELECT id, name, description FROM workspace LIMIT ? OFFSET ?",
-		pageSize,
-		(pageSize * pageNumber),
-	)
+	workspaces, totalElements, selectError := database.Store.GetWorkspaces(c.Context(), pageNumber, pageSize)
 	if selectError != nil {
 		return HandleSQLErrors(c, selectError)
 	}
-	defer rows.Close()
-	var workspaces []models.Workspace
-	for rows.Next() {
-		var workspace models.Workspace
-		extractError := rows.Scan(&workspace.Id, &workspace.Name, &workspace.Description)
-		if extractError != nil {
-			return HandleSQLErrors(c, extractError)
-		}
-		workspaces = append(workspaces, workspace)
-	}
-
-	countResult := database.Db.QueryRowContext(c.Context(), "SELECT COUNT(*) FROM workspace")
-	var totalElements int
-	countError := countResult.Scan(&totalElements)
-	if countError != nil {
-		return HandleSQLErrors(c, countError)
-	}
 
 	pageResponse := models.PageOf(workspaces, pageNumber, pageSize, totalElements)
 
@@ -103,56 +187,215 @@ func getWorkspaces(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(pageResponse)
 }
 
-type CreateNewMockRequest struct {
-	Path         string  `json:"path"`
-	Method       string  `json:"method"`
-	Status       int     `json:"status"`
-	ResponseBody *string `json:"response_body,omitempty"`
+const workspaceLocal = "workspace"
+
+// findWorkspace finds the workspace of the request by the id or the slug in its :workspace param, or the default workspace when workspaces are disabled.
+func findWorkspace(c *fiber.Ctx) (*models.Workspace, error) {
+	return lookupWorkspace(c.Context(), c.Params("workspace"))
 }
 
-func createNewMock(c *fiber.Ctx) error {
+// lookupWorkspace finds the workspace by its id or its slug, or the default workspace when workspaces are disabled.
+func lookupWorkspace(ctx context.Context, idOrSlug string) (*models.Workspace, error) {
+	if !config.WorkspaceEnabled {
+		return database.Store.GetWorkspace(ctx, 4269)
+	}
+	// slugs are never only digits, so a number is always an id
+	if workspaceId, err := strconv.ParseInt(idOrSlug, 10, 64); err == nil {
+		return database.Store.GetWorkspace(ctx, workspaceId)
+	}
+	return database.Store.GetWorkspaceBySlug(ctx, idOrSlug)
+}
 
-	workspaceId := 4269
-	if config.WorkspaceEnabled {
-		var err error
-		if workspaceId, err = c.ParamsInt("workspaceId", -1); err != nil || workspaceId == -1 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "workspaceId must be valid integer",
-			})
-		}
+// loadWorkspace puts the workspace of the request in its locals for the next handlers.
+func loadWorkspace(c *fiber.Ctx) error {
+
+	workspace, err := findWorkspace(c)
+	if err != nil {
+		return HandleSQLErrors(c, err)
 	}
-	log.Debugf("Creating a new mock in workspace %d", workspaceId)
-	var reqBody *CreateNewMockRequest
+	if workspace == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%s] is not found", c.Params("workspace")),
+		})
+	}
+	c.Locals(workspaceLocal, workspace)
+	return c.Next()
+}
+
+type UpdateWorkspaceRequest struct {
+	Slug string `json:"slug"`
+}
+
+// updateWorkspace changes the slug of the workspace, the old slug stops working right away.
+func updateWorkspace(c *fiber.Ctx) error {
 
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody UpdateWorkspaceRequest
 	if err := c.BodyParser(&reqBody); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Bad Request",
 			"message": err.Error(),
 		})
 	}
+	if !models.IsValidSlug(reqBody.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "workspace slug must be lowercase letters, digits, and dashes, and cannot be only digits",
+		})
+	}
 
-	if !isValidPath(reqBody.Path) || !isValidHttpMethod(strings.ToUpper(reqBody.Method)) || !isValidHttpResponseStatus(reqBody.Status) {
+	if _, err := database.Store.UpdateWorkspaceSlug(c.Context(), workspace.Id, reqBody.Slug); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	workspace.Slug = reqBody.Slug
+	return c.Status(fiber.StatusOK).JSON(workspace)
+}
+
+type RotateWorkspaceAccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// rotateWorkspaceAccessToken generates a new access token for the workspace /sarab endpoints, replacing the previous one if any.
+func rotateWorkspaceAccessToken(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	accessToken, err := generateSecret("mst_")
+	if err != nil {
+		return err
+	}
+	updated, err := database.Store.SetWorkspaceAccessTokenHash(c.Context(), workspace.Id, sql.NullString{String: hashSecret(accessToken), Valid: true})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !updated {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] is not found", workspace.Id),
+		})
+	}
+
+	// the token is only ever shown here, only its hash is stored
+	return c.Status(fiber.StatusOK).JSON(RotateWorkspaceAccessTokenResponse{AccessToken: accessToken})
+}
+
+func deleteWorkspaceAccessToken(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	updated, err := database.Store.SetWorkspaceAccessTokenHash(c.Context(), workspace.Id, sql.NullString{Valid: false})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !updated {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] is not found", workspace.Id),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type AddWorkspaceHostRequest struct {
+	Host string `json:"host"`
+}
+
+func addWorkspaceHost(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody AddWorkspaceHostRequest
+	if err := c.BodyParser(&reqBody); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Bad Request",
-			"message": "Path, Method, and Status must be vaild",
+			"message": err.Error(),
 		})
 	}
+	host := strings.ToLower(reqBody.Host)
+	if !models.IsValidHost(host) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "host must be a hostname without a port, e.g. payments.mock.local",
+		})
+	}
+
+	if err := database.Store.AddWorkspaceHost(c.Context(), models.WorkspaceHost{Host: host, Workspace: workspace.Id}); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.SendStatus(fiber.StatusCreated)
+}
 
-	transaction, err := database.Db.BeginTx(c.Context(), nil)
+func getWorkspaceHosts(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	hosts, err := database.Store.GetWorkspaceHosts(c.Context(), workspace.Id)
 	if err != nil {
 		return HandleSQLErrors(c, err)
 	}
+	return c.Status(fiber.StatusOK).JSON(hosts)
+}
 
-	pathParts := getPathParts(reqBody.Path)
-	numberOfParts := len(pathParts)
-	var lastInseretedId *sql.NullInt64
+func deleteWorkspaceHost(c *fiber.Ctx) error {
 
-	for i, part := range pathParts {
-		lastInseretedId, err = insertPartReturningIdOrGetExistingRouteId(transaction, part, lastInseretedId, workspaceId, (i+1) == numberOfParts)
-		if err != nil {
-			return HandleSQLErrors(c, err)
-		}
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	host := strings.ToLower(c.Params("host"))
+	deleted, err := database.Store.DeleteWorkspaceHost(c.Context(), models.WorkspaceHost{Host: host, Workspace: workspace.Id})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("host [%s] is not mapped to workspace [%d]", host, workspace.Id),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type CreateNewMockRequest struct {
+	Path         string          `json:"path"`
+	Method       string          `json:"method"`
+	Status       int             `json:"status"`
+	ResponseBody *string         `json:"response_body,omitempty"`
+	Matchers     models.Matchers `json:"matchers,omitempty"`
+	// Stream writes the response in chunks instead of ResponseBody
+	Stream models.ResponseStream `json:"stream,omitzero"`
+	// Templated renders ResponseBody with the fake data functions on every call, the same way with a Seed
+	Templated bool `json:"templated,omitempty"`
+	// Schema generates the body from a JSON Schema on every call instead, the same way with a Seed
+	Schema models.JsonValue `json:"schema,omitempty"`
+	Seed   *int64           `json:"seed,omitempty"`
+}
+
+func createNewMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	workspaceId := int(workspace.Id)
+	log.Debugf("Creating a new mock in workspace %d", workspaceId)
+	var reqBody *CreateNewMockRequest
+
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if !isValidPath(reqBody.Path) || !isValidHttpMethod(strings.ToUpper(reqBody.Method)) || !isValidHttpResponseStatus(reqBody.Status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "Path, Method, and Status must be vaild",
+		})
+	}
+	if err := validateMatchers(reqBody.Matchers); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if err := validateStream(reqBody.Stream, reqBody.ResponseBody != nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
 	}
 
 	var mockedResponseBody sql.NullString
@@ -162,16 +405,24 @@ func createNewMock(c *fiber.Ctx) error {
 		mockedResponseBody = sql.NullString{Valid: false}
 	}
 
-	_, err = transaction.Exec("INSERT INTO route_response (status, path, method, response) VALUES (?, ?, ?, ?)",
-		reqBody.Status,
-		lastInseretedId.Int64,
-		strings.ToUpper(reqBody.Method),
-		mockedResponseBody,
-	)
-	if err != nil {
-		return HandleSQLErrors(c, err)
+	response := models.RouteResponse{
+		Method:    strings.ToUpper(reqBody.Method),
+		Status:    reqBody.Status,
+		Response:  mockedResponseBody,
+		Matchers:  reqBody.Matchers,
+		Stream:    reqBody.Stream,
+		Templated: reqBody.Templated,
+		Schema:    reqBody.Schema,
+		Seed:      reqBody.Seed,
+	}
+	if err := validateGeneratedResponse(c.Context(), workspace.Id, response); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
 	}
-	err = transaction.Commit()
+
+	err := database.Store.CreateMock(c.Context(), workspaceId, getPathSegments(reqBody.Path), response)
 	if err != nil {
 		return HandleSQLErrors(c, err)
 	}
@@ -188,55 +439,41 @@ func getPathParts(path string) []string {
 	return parts
 }
 
-func insertPartReturningIdOrGetExistingRouteId(transaction *sql.Tx, part string, lastInsertedId *sql.NullInt64, workspaceId int, isLastPart bool) (*sql.NullInt64, error) {
-
-	isParam := strings.HasPrefix(part, "/:")
-	paramName := sql.NullString{Valid: false}
-	if isParam {
-		paramName.Valid = true
-		paramName.String = strings.Split(part, "/:")[1]
-		part = "/<param>"
-	}
-	var id sql.NullInt64
-
-	existingRouteResult := transaction.QueryRow("SELECT id, has_response FROM route WHERE path = ? and workspace = ? and parent_path = ?",
-		part,
-		int64(workspaceId),
-		lastInsertedId,
-	)
-	var alreadyHasResponse bool
-	err := existingRouteResult.Scan(&id, &alreadyHasResponse)
-	if err == nil {
-		if isLastPart && !alreadyHasResponse {
-			_, err = transaction.Exec("UPDATE route set has_response = 1 where id = ?", id)
-			if err != nil {
-				return nil, err
-			}
-		} else if isLastPart && alreadyHasResponse {
-			return nil, fmt.Errorf("UNIQUE constraint failed: this route already exist.")
+// getPathSegments converts the path parts into the route segments to be stored, the params are stored as `/<param>`.
+func getPathSegments(path string) []models.Route {
+	var segments []models.Route
+	for _, part := range getPathParts(path) {
+		segment := models.Route{Path: part}
+		if paramMatch := paramSegment.FindStringSubmatch(part); paramMatch != nil {
+			segment.Path = "/<param>"
+			segment.IsParam = true
+			segment.ParamName = sql.NullString{String: paramMatch[1], Valid: true}
+			segment.ParamConstraint = sql.NullString{String: paramMatch[2], Valid: paramMatch[2] != ""}
 		}
-		return &id, nil
-	}
-
-	err = transaction.QueryRow("INSERT INTO route (path, parent_path, workspace, has_responses, is_param, param_name) VALUES (?, ?, ?, ?, ?, ?) RETURNING id",
-		part,
-		lastInsertedId,
-		workspaceId,
-		isLastPart,
-		isParam,
-		paramName,
-	).Scan(&id)
-	if err != nil {
-		return nil, err
+		segments = append(segments, segment)
 	}
-
-	return &id, nil
+	return segments
 }
 
-var validPath = regexp.MustCompile(`^/?([a-zA-Z0-9_\-:]+/?)*$`)
+var validPath = regexp.MustCompile(`^/?(([a-zA-Z0-9_\-:]+|:[a-zA-Z0-9_\-]+(\([^/]+\)|<[a-zA-Z]+>)|\*\*?)(/([a-zA-Z0-9_\-:]+|:[a-zA-Z0-9_\-]+(\([^/]+\)|<[a-zA-Z]+>)|\*\*?))*)?/?$`)
+
+// paramSegment captures the name and the optional constraint of a param segment, e.g. `/:id(\d+)` or `/:id<uuid>`
+var paramSegment = regexp.MustCompile(`^/:([a-zA-Z0-9_\-]+)(\([^/]+\)|<[a-zA-Z]+>)?$`)
 
 func isValidPath(path string) bool {
-	return validPath.MatchString(path)
+	if !validPath.MatchString(path) {
+		return false
+	}
+	parts := getPathParts(path)
+	for _, part := range parts {
+		if paramMatch := paramSegment.FindStringSubmatch(part); paramMatch != nil && paramMatch[2] != "" {
+			if _, err := compileParamConstraint(paramMatch[2]); err != nil {
+				return false
+			}
+		}
+	}
+	// a catch-all segment swallows the rest of the path, so it can only be the last one
+	return !slices.Contains(parts[:len(parts)-1], catchAllSegment)
 }
 
 func isValidHttpMethod(method string) bool {
@@ -251,111 +488,23 @@ func isValidHttpResponseStatus(statusCode int) bool {
 	return statusCode >= 100 && statusCode <= 599
 }
 
-type GetMocksResponse struct {
-	ResponseId   int64          `json:"response_id"`
-	FullPath     string         `json:"full_path"`
-	ParamNames   string         `json:"param_names"`
-	Method       string         `json:"method"`
-	ResponseBody sql.NullString `json:"response_body"`
-	Status       int            `json:"status"`
-	DirectPathId int64          `json:"direct_path_id"`
-}
+type GetMocksResponse = models.Mock
 
 func getMocks(c *fiber.Ctx) error {
 
-	workspaceId := 4269
-	if config.WorkspaceEnabled {
-		var err error
-		if workspaceId, err = c.ParamsInt("workspaceId", -1); err != nil || workspaceId == -1 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "workspaceId must be valid integer",
-			})
-		}
-	}
-
-	rows, err := database.Db.QueryContext(c.Context(), `	
-		WITH RECURSIVE route_path(id, path, parent_path, full_path, param_names, origin_id) AS (
-			-- Base case: responses with no path_params, filtered by workspace
-			SELECT
-				r.id,
-				r.path,
-				r.parent_path,
-				r.path AS full_path,
-				r.param_name AS param_names,
-				r.id AS origin_id
-			FROM route r
-			JOIN route_response rr ON rr.path = r.id
-			WHERE rr.path_params IS NULL
-			  AND r.workspace = ?   -- 👈
-
-			UNION ALL
-
-			-- Recursive step: climb up parent_path, staying within the same workspace
-			SELECT
-				p.id,
-				p.path,
-				p.parent_path,
-				p.path || rp.full_path,
-				COALESCE(p.param_name || ',', '') || rp.param_names,
-				rp.origin_id
-			FROM route p
-			JOIN route_path rp ON rp.parent_path = p.id
-			WHERE p.workspace = ?   -- 👈
-		)
-
-		-- Final result with pagination
-		SELECT
-			rr.id AS response_id,
-			rp.full_path AS full_path,
-			rp.param_names as param_names,
-			rr.method,
-			rr.response AS response_body,
-			rr.status,
-			rr.path AS direct_path_id
-		FROM route_response rr
-		JOIN (
-			SELECT origin_id, full_path, param_names
-			FROM route_path
-			WHERE parent_path IS NULL
-		) rp ON rr.path = rp.origin_id
-		WHERE rr.path_params IS NULL
-		ORDER BY rr.id;
-		`,
-		workspaceId,
-		workspaceId,
-	)
+	workspaceId := int(c.Locals(workspaceLocal).(*models.Workspace).Id)
+	mocks, err := database.Store.GetMocks(c.Context(), workspaceId)
 	if err != nil {
 		return HandleSQLErrors(c, err)
 	}
-	defer rows.Close()
-
-	var mocks []GetMocksResponse
-
-	for rows.Next() {
-		var mock GetMocksResponse
-		err := rows.Scan(&mock.ResponseId, &mock.FullPath, &mock.ParamNames, &mock.Method, &mock.ResponseBody, &mock.Status, &mock.DirectPathId)
-		if err != nil {
-			return HandleSQLErrors(c, err)
-		}
-		mocks = append(mocks, mock)
-	}
 
 	return c.Status(fiber.StatusOK).JSON(mocks)
 }
 
 func createMockResponse(c *fiber.Ctx) error {
-	workspaceId := 4269
+	workspaceId := int(c.Locals(workspaceLocal).(*models.Workspace).Id)
 	var mockId int
 	var err error
-	if config.WorkspaceEnabled {
-		if workspaceId, err = c.ParamsInt("workspaceId", -1); err != nil || workspaceId == -1 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "workspaceId must be valid integer",
-			})
-		}
-	}
 	if mockId, err = c.ParamsInt("mockId", -1); err != nil || mockId == -1 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Bad Request",
@@ -379,36 +528,107 @@ func createMockResponse(c *fiber.Ctx) error {
 		})
 	}
 
-	if !reqBody.PathParams.Valid {
+	if len(reqBody.PathParams) == 0 {
+		reqBody.PathParams = nil
+	}
+	if reqBody.PathParams == nil && len(reqBody.Matchers) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "path params or matchers are required",
+		})
+	}
+	if err := validateMatchers(reqBody.Matchers); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Bad Request",
-			"message": "path params are required",
+			"message": err.Error(),
+		})
+	}
+	if err := validateStream(reqBody.Stream, reqBody.Response.Valid); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if err := validateGeneratedResponse(c.Context(), int64(workspaceId), reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
 		})
 	}
 
-	_, err = database.Db.ExecContext(c.Context(), "INSERT INTO route_response (path, path_params, method, status, response) VALUES (?, ?, ?, ?, ?)",
-		mockId,
-		reqBody.PathParams,
-		strings.ToUpper(reqBody.Method),
-		reqBody.Status,
-		reqBody.Response,
-	)
+	routesById, err := database.Store.GetRoutes(c.Context(), workspaceId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if _, found := routesById[int64(mockId)]; !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("mock [%d] is not found", mockId),
+		})
+	}
+
+	if err = validatePathParams(reqBody.PathParams, getRouteChain(routesById, int64(mockId))); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	err = database.Store.CreateRouteResponse(c.Context(), models.RouteResponse{
+		Path:       int64(mockId),
+		PathParams: reqBody.PathParams,
+		Method:     strings.ToUpper(reqBody.Method),
+		Status:     reqBody.Status,
+		Response:   reqBody.Response,
+		Matchers:   reqBody.Matchers,
+		Stream:     reqBody.Stream,
+		Templated:  reqBody.Templated,
+		Schema:     reqBody.Schema,
+		Seed:       reqBody.Seed,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
 
 	return c.SendStatus(fiber.StatusCreated)
 }
 
+// validatePathParams makes sure every path param is a param of the route chain, and that its value satisfies the param constraint if any.
+func validatePathParams(pathParams models.PathParams, chain []models.Route) error {
+	paramRoutes := make(map[string]models.Route)
+	for _, route := range chain {
+		if route.IsParam {
+			paramRoutes[route.ParamName.String] = route
+		}
+	}
+
+	for name, value := range pathParams {
+		route, found := paramRoutes[name]
+		if !found {
+			return fmt.Errorf("path param [%s] is not a param of mock path [%s]", name, getChainFullPath(chain))
+		}
+		if route.ParamConstraint.Valid {
+			constraint, err := compileParamConstraint(route.ParamConstraint.String)
+			if err != nil || !constraint.MatchString(value) {
+				return fmt.Errorf("path param [%s] value [%s] does not satisfy constraint %s", name, value, route.ParamConstraint.String)
+			}
+		}
+	}
+	return nil
+}
+
 func HandleSQLErrors(c *fiber.Ctx, err error) error {
 	msg := err.Error()
 
 	log.Debugf("Database Error: %v", err)
 
 	switch {
-	case strings.Contains(msg, "UNIQUE constraint failed"):
+	case errors.Is(err, database.ErrConflict):
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error":   "Conflict",
 			"message": "A record with this value already exists.",
 		})
-	case strings.Contains(msg, "NOT NULL"):
+	case errors.Is(err, database.ErrNotNull):
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Bad Request",
 			"message": msg,
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"moksarab/config"
+	"moksarab/database"
+	"moksarab/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const apiKeyLocal = "apiKey"
+
+// bootstrapApiKey is the admin key given by ADMIN_API_KEY, it is never stored.
+var bootstrapApiKey = models.ApiKey{Name: "bootstrap", Role: models.RoleAdmin}
+
+// authenticateApiKey requires every request to carry a known API key, either in the X-API-Key header or as a Bearer token.
+func authenticateApiKey(c *fiber.Ctx) error {
+
+	key := c.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	}
+	if key == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Unauthorized",
+			"message": "an API key is required in the X-API-Key header",
+		})
+	}
+
+	keyHash := hashSecret(key)
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashSecret(config.AdminApiKey))) == 1 {
+		c.Locals(apiKeyLocal, &bootstrapApiKey)
+		return c.Next()
+	}
+
+	apiKey, err := database.Store.GetApiKeyByHash(c.Context(), keyHash)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if apiKey == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Unauthorized",
+			"message": "the API key is invalid",
+		})
+	}
+	c.Locals(apiKeyLocal, apiKey)
+	return c.Next()
+}
+
+// requireRole only lets through the keys having at least the given role.
+func requireRole(role models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !hasRole(c, role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Forbidden",
+				"message": fmt.Sprintf("the API key role must be %s or higher", role),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// hasRole tells if the API key of the request has at least the given role, any request has it without authentication.
+func hasRole(c *fiber.Ctx, role models.Role) bool {
+	if config.AdminApiKey == "" {
+		return true
+	}
+	return c.Locals(apiKeyLocal).(*models.ApiKey).Role.Includes(role)
+}
+
+// checkWorkspaceAccess only lets through the keys that can access the workspace of the request.
+func checkWorkspaceAccess(c *fiber.Ctx) error {
+	if config.AdminApiKey == "" {
+		return c.Next()
+	}
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	apiKey := c.Locals(apiKeyLocal).(*models.ApiKey)
+	if !apiKey.CanAccess(workspace.Id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Forbidden",
+			"message": fmt.Sprintf("the API key cannot access workspace %d", workspace.Id),
+		})
+	}
+	return c.Next()
+}
+
+func hashSecret(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func generateSecret(prefix string) (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(random), nil
+}
+
+type CreateApiKeyResponse struct {
+	models.ApiKey
+	Key string `json:"key"`
+}
+
+func createApiKey(c *fiber.Ctx) error {
+
+	var reqBody models.ApiKey
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if reqBody.Name == "" || !reqBody.Role.IsValid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "API key name cannot be empty, and role must be one of admin, editor, or viewer",
+		})
+	}
+
+	key, err := generateSecret("msk_")
+	if err != nil {
+		return err
+	}
+	reqBody.KeyHash = hashSecret(key)
+
+	id, err := database.Store.CreateApiKey(c.Context(), reqBody)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	reqBody.Id = id
+
+	// the key is only ever shown here, only its hash is stored
+	return c.Status(fiber.StatusCreated).JSON(CreateApiKeyResponse{ApiKey: reqBody, Key: key})
+}
+
+func getApiKeys(c *fiber.Ctx) error {
+
+	apiKeys, err := database.Store.GetApiKeys(c.Context())
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(apiKeys)
+}
+
+func deleteApiKey(c *fiber.Ctx) error {
+
+	keyId, err := c.ParamsInt("keyId", -1)
+	if err != nil || keyId == -1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "keyId must be valid integer",
+		})
+	}
+
+	deleted, err := database.Store.DeleteApiKey(c.Context(), int64(keyId))
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("API key [%d] is not found", keyId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,370 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"moksarab/database"
+	"moksarab/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// the defaults and limits of the callback deliveries
+const (
+	defaultCallbackAttempts   = 3
+	maxCallbackAttempts       = 10
+	defaultCallbackRetryDelay = 1000
+	callbackTimeout           = 10 * time.Second
+)
+
+type CreateCallbackRequest struct {
+	ResponseId   int64            `json:"response_id"`
+	Method       string           `json:"method"`
+	Url          string           `json:"url"`
+	Headers      models.StringMap `json:"headers"`
+	Body         string           `json:"body"`
+	DelayMs      int              `json:"delay_ms"`
+	MaxAttempts  int              `json:"max_attempts"`
+	RetryDelayMs int              `json:"retry_delay_ms"`
+}
+
+// callbackRequest is the request that triggered the callbacks, as their templates see it, e.g. {{.PathParams.id}} or {{.Json.order.id}}.
+type callbackRequest struct {
+	Method     string
+	Path       string
+	Query      map[string]string
+	Headers    map[string]string
+	PathParams map[string]string
+	Body       string
+	// Json is the body parsed as JSON, nil when it isn't JSON
+	Json any
+}
+
+// templateFuncs are the functions of the callback templates.
+var templateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		raw, err := json.Marshal(value)
+		return string(raw), err
+	},
+}
+
+// callbackDeliveries tracks the pending deliveries, so they are cancelled when the app shuts down.
+var callbackDeliveries = struct {
+	sync.Mutex
+	pending *pendingDeliveries
+}{pending: newPendingDeliveries()}
+
+type pendingDeliveries struct {
+	sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newPendingDeliveries() *pendingDeliveries {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pendingDeliveries{ctx: ctx, cancel: cancel}
+}
+
+var callbackClient = &http.Client{Timeout: callbackTimeout}
+
+func createCallback(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateCallbackRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	reqBody.Method = strings.ToUpper(reqBody.Method)
+	if reqBody.Method == "" {
+		reqBody.Method = fiber.MethodPost
+	}
+	if reqBody.MaxAttempts == 0 {
+		reqBody.MaxAttempts = defaultCallbackAttempts
+	}
+	if reqBody.RetryDelayMs == 0 {
+		reqBody.RetryDelayMs = defaultCallbackRetryDelay
+	}
+	if err := validateCallback(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	mocks, err := database.Store.GetMocks(c.Context(), int(workspace.Id))
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !slices.ContainsFunc(mocks, func(mock models.Mock) bool { return mock.ResponseId == reqBody.ResponseId }) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("response_id [%d] is not a mock response of the workspace", reqBody.ResponseId),
+		})
+	}
+
+	id, err := database.Store.CreateCallback(c.Context(), models.Callback{
+		Workspace:    workspace.Id,
+		ResponseId:   reqBody.ResponseId,
+		Method:       reqBody.Method,
+		Url:          reqBody.Url,
+		Headers:      reqBody.Headers,
+		Body:         reqBody.Body,
+		DelayMs:      reqBody.DelayMs,
+		MaxAttempts:  reqBody.MaxAttempts,
+		RetryDelayMs: reqBody.RetryDelayMs,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": id})
+}
+
+func validateCallback(callback CreateCallbackRequest) error {
+	if !isValidHttpMethod(callback.Method) {
+		return fmt.Errorf("method [%s] must be valid", callback.Method)
+	}
+	if callback.Url == "" {
+		return errors.New("url is required")
+	}
+	if callback.DelayMs < 0 || callback.RetryDelayMs < 0 {
+		return errors.New("delay_ms and retry_delay_ms must not be negative")
+	}
+	if callback.MaxAttempts < 1 || callback.MaxAttempts > maxCallbackAttempts {
+		return fmt.Errorf("max_attempts must be between 1 and %d", maxCallbackAttempts)
+	}
+	templates := map[string]string{"url": callback.Url, "body": callback.Body}
+	for name, value := range callback.Headers {
+		templates["header "+name] = value
+	}
+	for name, text := range templates {
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(text); err != nil {
+			return fmt.Errorf("%s is not a valid template: %w", name, err)
+		}
+	}
+	// a url without template actions is checked right away
+	if !strings.Contains(callback.Url, "{{") {
+		return validateCallbackUrl(callback.Url)
+	}
+	return nil
+}
+
+func validateCallbackUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url [%s] must be an absolute http or https URL", rawUrl)
+	}
+	return nil
+}
+
+func getCallbacks(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	callbacks, err := database.Store.GetCallbacks(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(callbacks)
+}
+
+func deleteCallback(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	callbackId, err := strconv.ParseInt(c.Params("callbackId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "callbackId must be a number",
+		})
+	}
+	deleted, err := database.Store.DeleteCallback(c.Context(), workspace.Id, callbackId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("callback [%d] is not found", callbackId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// fireCallbacks starts the deliveries of the callbacks of the served response in the background,
+// with a copy of the request since fiber reuses its buffers once the response is sent.
+func fireCallbacks(c *fiber.Ctx, workspace *models.Workspace, responseId int64, pathParams map[string]string, trimmedPath string) error {
+	callbacks, err := database.Store.GetCallbacks(c.Context(), workspace.Id)
+	if err != nil {
+		return err
+	}
+	callbacks = slices.DeleteFunc(callbacks, func(callback models.Callback) bool { return callback.ResponseId != responseId })
+	if len(callbacks) == 0 {
+		return nil
+	}
+
+	request := callbackRequest{
+		Method:     strings.Clone(c.Method()),
+		Path:       strings.Clone(trimmedPath),
+		Query:      cloneStrings(c.Queries()),
+		Headers:    make(map[string]string),
+		PathParams: cloneStrings(pathParams),
+		Body:       string(c.Body()),
+	}
+	for name, values := range c.GetReqHeaders() {
+		request.Headers[strings.Clone(name)] = strings.Clone(strings.Join(values, ", "))
+	}
+	if err := json.Unmarshal(c.Body(), &request.Json); err != nil {
+		request.Json = nil
+	}
+
+	callbackDeliveries.Lock()
+	deliveries := callbackDeliveries.pending
+	deliveries.Add(len(callbacks))
+	callbackDeliveries.Unlock()
+	for _, callback := range callbacks {
+		go func() {
+			defer deliveries.Done()
+			deliverCallback(deliveries.ctx, callback, request)
+		}()
+	}
+	return nil
+}
+
+func cloneStrings(values map[string]string) map[string]string {
+	cloned := make(map[string]string, len(values))
+	for key, value := range values {
+		cloned[strings.Clone(key)] = strings.Clone(value)
+	}
+	return cloned
+}
+
+// deliverCallback sends the callback after its delay, and again after the retry delay, doubling every time, until it gets a 2xx response.
+// Every attempt is recorded in the journal of the workspace.
+func deliverCallback(ctx context.Context, callback models.Callback, request callbackRequest) {
+	record := func(attempt int, target string, body string, status int, err error) {
+		entry := models.JournalEntry{
+			Workspace: callback.Workspace,
+			Protocol:  "callback",
+			Method:    callback.Method,
+			Path:      target,
+			Status:    status,
+			Message:   body,
+			Attempt:   attempt,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		recordJournalEntry(entry)
+	}
+
+	target, headers, body, err := renderCallback(callback, request)
+	if err != nil {
+		log.Warnf("Could not render the callback %d: %v", callback.Id, err)
+		record(0, target, body, 0, err)
+		return
+	}
+
+	delay := time.Duration(callback.DelayMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		status, err := sendCallback(ctx, callback.Method, target, headers, body)
+		if err == nil && (status < 200 || status > 299) {
+			err = fmt.Errorf("the callback was answered with %d", status)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		record(attempt, target, body, status, err)
+		if err == nil {
+			return
+		}
+		if attempt >= callback.MaxAttempts {
+			log.Warnf("Giving up the callback %d to %s after %d attempts: %v", callback.Id, target, attempt, err)
+			return
+		}
+		delay = time.Duration(callback.RetryDelayMs) * time.Millisecond << (attempt - 1)
+	}
+}
+
+func renderCallback(callback models.Callback, request callbackRequest) (string, map[string]string, string, error) {
+	render := func(name string, text string) (string, error) {
+		parsed, err := template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var rendered strings.Builder
+		if err := parsed.Execute(&rendered, request); err != nil {
+			return "", err
+		}
+		return rendered.String(), nil
+	}
+
+	target, err := render("url", callback.Url)
+	if err != nil {
+		return callback.Url, nil, "", err
+	}
+	if err := validateCallbackUrl(target); err != nil {
+		return target, nil, "", err
+	}
+	body, err := render("body", callback.Body)
+	if err != nil {
+		return target, nil, "", err
+	}
+	headers := make(map[string]string)
+	for name, value := range callback.Headers {
+		if headers[name], err = render("header "+name, value); err != nil {
+			return target, nil, body, err
+		}
+	}
+	return target, headers, body, nil
+}
+
+func sendCallback(ctx context.Context, method string, target string, headers map[string]string, body string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewBufferString(body))
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res, err := callbackClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	return res.StatusCode, nil
+}
+
+// ShutdownCallbacks cancels the pending callback deliveries and waits for them, it is called when the main app shuts down.
+func ShutdownCallbacks() error {
+	callbackDeliveries.Lock()
+	deliveries := callbackDeliveries.pending
+	callbackDeliveries.pending = newPendingDeliveries()
+	callbackDeliveries.Unlock()
+
+	deliveries.cancel()
+	deliveries.Wait()
+	return nil
+}
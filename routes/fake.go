@@ -0,0 +1,342 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"moksarab/models"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxGeneratedItems caps the arrays of {{generate}}, so a typo in a count can't take the server down.
+const maxGeneratedItems = 10000
+
+var (
+	firstNames       = []string{"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Daniel", "Karen", "Emma", "Liam", "Olivia", "Noah", "Sophia", "Lucas", "Mia", "Ethan", "Amelia", "Leo"}
+	lastNames        = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin", "Lee", "Clark", "Lewis", "Walker", "Hall", "Young"}
+	companyWords     = []string{"Acme", "Globex", "Initech", "Umbrella", "Stark", "Wayne", "Vertex", "Summit", "Pioneer", "Horizon", "Nimbus", "Quantum", "Apex", "Beacon", "Cobalt", "Evergreen", "Falcon", "Harbor", "Keystone", "Lighthouse"}
+	companySuffix    = []string{"Inc", "LLC", "Ltd", "Group", "Holdings", "Partners", "Corp", "Co"}
+	streetNames      = []string{"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake", "Hill", "Park", "View", "Sunset", "River", "Church", "Highland"}
+	streetTypes      = []string{"Street", "Avenue", "Road", "Boulevard", "Lane", "Drive", "Way", "Court"}
+	cities           = []string{"London", "Paris", "Berlin", "Madrid", "Rome", "Amsterdam", "Vienna", "Lisbon", "Dublin", "Chicago", "Boston", "Seattle", "Toronto", "Sydney", "Singapore"}
+	countries        = []string{"United Kingdom", "France", "Germany", "Spain", "Italy", "Netherlands", "Austria", "Portugal", "Ireland", "United States", "Canada", "Australia", "Singapore", "Japan", "Brazil"}
+	emailDomains     = []string{"example.com", "example.org", "example.net", "mail.example.com"}
+	loremWords       = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "enim", "ad", "minim", "veniam", "quis", "nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip"}
+	gulfFirstNames   = []string{"Mohammed", "Abdullah", "Fahad", "Khalid", "Faisal", "Saud", "Sultan", "Turki", "Omar", "Yousef", "Nasser", "Hamad", "Fatimah", "Noura", "Sara", "Reem", "Maha", "Lama", "Hessa", "Aisha", "Mariam", "Latifa", "Dana", "Shaikha"}
+	gulfLastNames    = []string{"Al-Saud", "Al-Otaibi", "Al-Qahtani", "Al-Ghamdi", "Al-Zahrani", "Al-Harbi", "Al-Mutairi", "Al-Dosari", "Al-Shehri", "Al-Subaie", "Al-Shamsi", "Al-Mansoori", "Al-Nuaimi", "Al-Maktoum", "Al-Thani", "Al-Sabah", "Al-Khalifa", "Al-Busaidi"}
+	saudiCities      = []string{"Riyadh", "Jeddah", "Mecca", "Medina", "Dammam", "Khobar", "Dhahran", "Taif", "Tabuk", "Abha", "Buraidah", "Hail", "Jazan", "Najran", "Yanbu"}
+	gulfCities       = []string{"Riyadh", "Jeddah", "Dammam", "Dubai", "Abu Dhabi", "Sharjah", "Doha", "Kuwait City", "Manama", "Muscat", "Salalah", "Al Ain"}
+	gulfCountries    = []string{"Saudi Arabia", "United Arab Emirates", "Qatar", "Kuwait", "Bahrain", "Oman"}
+	gulfCurrencies   = []string{"SAR", "AED", "QAR", "KWD", "BHD", "OMR"}
+	gulfCompanyWords = []string{"Trading", "Holding", "Contracting", "Group"}
+	emirates         = []string{"Abu Dhabi", "Dubai", "Sharjah", "Ajman", "Umm Al Quwain", "Ras Al Khaimah", "Fujairah"}
+	// the bank codes of the IBANs, the first digits of their BBAN
+	saudiBankCodes    = []string{"10", "20", "45", "55", "60", "65", "80"}
+	emiratesBankCodes = []string{"026", "030", "033", "035", "044", "050"}
+)
+
+// fakeGenerators are the fake data generators by name, for {{fake "person.name"}} and the shapes of {{generate}}.
+var fakeGenerators = map[string]func(f *faker) any{
+	"person.firstName": func(f *faker) any { return f.pick(firstNames) },
+	"person.lastName":  func(f *faker) any { return f.pick(lastNames) },
+	"person.name":      func(f *faker) any { return f.pick(firstNames) + " " + f.pick(lastNames) },
+	"company.name":     func(f *faker) any { return f.pick(companyWords) + " " + f.pick(companySuffix) },
+	"address.street": func(f *faker) any {
+		return fmt.Sprintf("%d %s %s", f.intBetween(1, 9999), f.pick(streetNames), f.pick(streetTypes))
+	},
+	"address.city":    func(f *faker) any { return f.pick(cities) },
+	"address.country": func(f *faker) any { return f.pick(countries) },
+	"address.zipCode": func(f *faker) any { return f.digits(5) },
+	"address.full": func(f *faker) any {
+		return fmt.Sprintf("%d %s %s, %s %s, %s", f.intBetween(1, 9999), f.pick(streetNames), f.pick(streetTypes), f.digits(5), f.pick(cities), f.pick(countries))
+	},
+	"phone.number": func(f *faker) any {
+		return fmt.Sprintf("+1-%d-%s-%s", f.intBetween(201, 989), f.digits(3), f.digits(4))
+	},
+	"internet.email": func(f *faker) any {
+		return strings.ToLower(fmt.Sprintf("%s.%s%d@%s", f.pick(firstNames), f.pick(lastNames), f.intBetween(1, 99), f.pick(emailDomains)))
+	},
+	"internet.username": func(f *faker) any { return strings.ToLower(f.pick(firstNames)) + "_" + f.digits(4) },
+	"internet.url": func(f *faker) any {
+		return "https://" + strings.ToLower(f.pick(companyWords)) + "." + f.pick(emailDomains)
+	},
+	"lorem.word":     func(f *faker) any { return f.pick(loremWords) },
+	"lorem.sentence": func(f *faker) any { return f.sentence() },
+	"lorem.paragraph": func(f *faker) any {
+		sentences := make([]string, f.intBetween(3, 6))
+		for i := range sentences {
+			sentences[i] = f.sentence()
+		}
+		return strings.Join(sentences, " ")
+	},
+	"date.past":      func(f *faker) any { return f.daysFromToday(-f.intBetween(1, 365)).Format(time.DateOnly) },
+	"date.future":    func(f *faker) any { return f.daysFromToday(f.intBetween(1, 365)).Format(time.DateOnly) },
+	"date.birthdate": func(f *faker) any { return f.daysFromToday(-f.intBetween(18*365, 80*365)).Format(time.DateOnly) },
+	"date.timestamp": func(f *faker) any {
+		return f.daysFromToday(-f.intBetween(1, 365)).Add(time.Duration(f.rand.Int64N(int64(24 * time.Hour)))).Truncate(time.Second).Format(time.RFC3339)
+	},
+	"id.uuid":        func(f *faker) any { return f.uuid() },
+	"id.int":         func(f *faker) any { return f.intBetween(1, 100000) },
+	"number.int":     func(f *faker) any { return f.intBetween(0, 1000) },
+	"number.boolean": func(f *faker) any { return f.rand.IntN(2) == 1 },
+	"finance.amount": func(f *faker) any { return float64(f.intBetween(100, 1000000)) / 100 },
+	"finance.iban":   func(f *faker) any { return iban("DE", f.digits(18)) },
+	"gulf.firstName": func(f *faker) any { return f.pick(gulfFirstNames) },
+	"gulf.lastName":  func(f *faker) any { return f.pick(gulfLastNames) },
+	"gulf.name":      func(f *faker) any { return f.pick(gulfFirstNames) + " " + f.pick(gulfLastNames) },
+	"gulf.city":      func(f *faker) any { return f.pick(gulfCities) },
+	"gulf.country":   func(f *faker) any { return f.pick(gulfCountries) },
+	"gulf.currency":  func(f *faker) any { return f.pick(gulfCurrencies) },
+	"gulf.company":   func(f *faker) any { return f.pick(gulfLastNames) + " " + f.pick(gulfCompanyWords) + " Co." },
+	"sa.city":        func(f *faker) any { return f.pick(saudiCities) },
+	"sa.postalCode":  func(f *faker) any { return strconv.Itoa(f.intBetween(11000, 99999)) },
+	"sa.phone":       func(f *faker) any { return "+9665" + f.digits(8) },
+	"sa.nationalId":  func(f *faker) any { return withLuhnDigit("1" + f.digits(8)) },
+	"sa.iqama":       func(f *faker) any { return withLuhnDigit("2" + f.digits(8)) },
+	"sa.vatNumber":   func(f *faker) any { return "3" + f.digits(13) + "3" },
+	"sa.iban":        func(f *faker) any { return iban("SA", f.pick(saudiBankCodes)+f.digits(18)) },
+	"ae.phone":       func(f *faker) any { return "+9715" + f.pick([]string{"0", "2", "4", "5", "6", "8"}) + f.digits(7) },
+	"ae.emiratesId": func(f *faker) any {
+		return formatEmiratesId(withLuhnDigit("784" + strconv.Itoa(f.intBetween(1950, 2005)) + f.digits(7)))
+	},
+	"ae.iban":    func(f *faker) any { return iban("AE", f.pick(emiratesBankCodes)+f.digits(16)) },
+	"ae.emirate": func(f *faker) any { return f.pick(emirates) },
+}
+
+// seededToday is the current day of the seeded fakers, so their dates are the same from one day to the next.
+var seededToday = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// faker draws the fake data of a response, the same for the same seed.
+type faker struct {
+	rand   *rand.Rand
+	source *rand.ChaCha8
+	today  time.Time
+}
+
+func newFaker(seed *int64) *faker {
+	var key [32]byte
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if seed != nil {
+		binary.LittleEndian.PutUint64(key[:], uint64(*seed))
+		today = seededToday
+	} else {
+		for i := 0; i < len(key); i += 8 {
+			binary.LittleEndian.PutUint64(key[i:], rand.Uint64())
+		}
+	}
+	source := rand.NewChaCha8(key)
+	return &faker{rand: rand.New(source), source: source, today: today}
+}
+
+func (f *faker) pick(values []string) string {
+	return values[f.rand.IntN(len(values))]
+}
+
+func (f *faker) intBetween(min int, max int) int {
+	return min + f.rand.IntN(max-min+1)
+}
+
+func (f *faker) digits(n int) string {
+	digits := make([]byte, n)
+	for i := range digits {
+		digits[i] = byte('0' + f.rand.IntN(10))
+	}
+	return string(digits)
+}
+
+func (f *faker) sentence() string {
+	words := make([]string, f.intBetween(5, 12))
+	for i := range words {
+		words[i] = f.pick(loremWords)
+	}
+	sentence := strings.Join(words, " ")
+	return strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+}
+
+// daysFromToday counts from the start of the current day, or from seededToday with a seed so the response never changes.
+func (f *faker) daysFromToday(days int) time.Time {
+	return f.today.AddDate(0, 0, days)
+}
+
+func (f *faker) uuid() string {
+	id, err := uuid.NewRandomFromReader(f.source)
+	if err != nil {
+		// ChaCha8 never fails to read
+		panic(err)
+	}
+	return id.String()
+}
+
+// iban computes the ISO 13616 check digits of the BBAN, e.g. SA0380000000608010167519.
+func iban(country string, bban string) string {
+	remainder := 0
+	for _, char := range bban + country + "00" {
+		digits := string(char)
+		if char >= 'A' && char <= 'Z' {
+			digits = strconv.Itoa(int(char-'A') + 10)
+		}
+		for _, digit := range digits {
+			remainder = (remainder*10 + int(digit-'0')) % 97
+		}
+	}
+	return fmt.Sprintf("%s%02d%s", country, 98-remainder, bban)
+}
+
+// withLuhnDigit appends the Luhn check digit of the Saudi IDs and the Emirates IDs.
+func withLuhnDigit(payload string) string {
+	sum := 0
+	for i := range len(payload) {
+		digit := int(payload[len(payload)-1-i] - '0')
+		if i%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return payload + strconv.Itoa((10-sum%10)%10)
+}
+
+func formatEmiratesId(id string) string {
+	return id[:3] + "-" + id[3:7] + "-" + id[7:14] + "-" + id[14:]
+}
+
+// funcs are the template functions of the templated responses, drawing from the faker.
+func (f *faker) funcs() template.FuncMap {
+	return template.FuncMap{
+		"fake": func(name string) (any, error) {
+			generator, found := fakeGenerators[name]
+			if !found {
+				return nil, fmt.Errorf("fake data generator [%s] is not found", name)
+			}
+			return generator(f), nil
+		},
+		"generate": func(count int, shape string) (string, error) {
+			if count < 0 || count > maxGeneratedItems {
+				return "", fmt.Errorf("generate count must be between 0 and %d", maxGeneratedItems)
+			}
+			var generated bytes.Buffer
+			generated.WriteByte('[')
+			for i := range count {
+				if i > 0 {
+					generated.WriteByte(',')
+				}
+				if err := f.generateShape(shape, &generated); err != nil {
+					return "", err
+				}
+			}
+			generated.WriteByte(']')
+			return generated.String(), nil
+		},
+		"intBetween": func(min int, max int) (int, error) {
+			if max < min {
+				return 0, errors.New("intBetween max must not be less than min")
+			}
+			return f.intBetween(min, max), nil
+		},
+		"pick": func(values ...any) (any, error) {
+			if len(values) == 0 {
+				return nil, errors.New("pick needs values")
+			}
+			return values[f.rand.IntN(len(values))], nil
+		},
+	}
+}
+
+// generateShape writes the JSON shape with its strings naming a generator replaced by generated values,
+// keeping the order of the fields and everything else as is.
+func (f *faker) generateShape(shape string, out *bytes.Buffer) error {
+	decoder := json.NewDecoder(strings.NewReader(shape))
+	decoder.UseNumber()
+	if err := f.generateValue(decoder, out); err != nil {
+		return fmt.Errorf("shape is not valid JSON: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("shape is not valid JSON: it must be a single value")
+	}
+	return nil
+}
+
+func (f *faker) generateValue(decoder *json.Decoder, out *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		closing := byte(']')
+		if value == '{' {
+			closing = '}'
+		}
+		out.WriteByte(byte(value))
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if value == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				raw, _ := json.Marshal(key)
+				out.Write(raw)
+				out.WriteByte(':')
+			}
+			if err := f.generateValue(decoder, out); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		out.WriteByte(closing)
+		return nil
+	case string:
+		if generator, found := fakeGenerators[value]; found {
+			token = generator(f)
+		}
+	}
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	out.Write(raw)
+	return nil
+}
+
+func validateTemplatedResponse(response models.RouteResponse) error {
+	if !response.Templated {
+		return nil
+	}
+	if !response.Response.Valid {
+		return errors.New("a templated response needs a response body")
+	}
+	// rendering it once catches the unknown generators and the invalid shapes too
+	if _, err := renderTemplatedResponse(response.Response.String, response.Seed); err != nil {
+		return fmt.Errorf("response body is not a valid template: %w", err)
+	}
+	return nil
+}
+
+// renderTemplatedResponse renders the response body with fresh fake data, or the same data on every call with a seed.
+func renderTemplatedResponse(body string, seed *int64) (string, error) {
+	parsed, err := template.New("response").Funcs(templateFuncs).Funcs(newFaker(seed).funcs()).Parse(body)
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err := parsed.Execute(&rendered, nil); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
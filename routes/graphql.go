@@ -0,0 +1,473 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+const defaultGraphqlPath = "/graphql"
+
+var graphqlOperationTypes = []string{string(ast.Query), string(ast.Mutation), string(ast.Subscription)}
+
+type CreateGraphqlMockRequest struct {
+	Path          string            `json:"path"`
+	OperationType string            `json:"operation_type"`
+	OperationName string            `json:"operation_name"`
+	Variables     models.JsonObject `json:"variables"`
+	Status        int               `json:"status"`
+	Data          models.JsonValue  `json:"data"`
+	Errors        models.JsonValue  `json:"errors"`
+}
+
+type SetGraphqlSchemaRequest struct {
+	Path string `json:"path"`
+	Sdl  string `json:"sdl"`
+}
+
+// graphqlRequest is a GraphQL request, either posted as JSON or given in the query params of a GET.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func createGraphqlMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateGraphqlMockRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if reqBody.Path == "" {
+		reqBody.Path = defaultGraphqlPath
+	}
+	if reqBody.Status == 0 {
+		reqBody.Status = fiber.StatusOK
+	}
+	if err := validateGraphqlMock(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	id, err := database.Store.CreateGraphqlMock(c.Context(), models.GraphqlMock{
+		Workspace:     workspace.Id,
+		Path:          reqBody.Path,
+		OperationType: reqBody.OperationType,
+		OperationName: reqBody.OperationName,
+		Variables:     reqBody.Variables,
+		Status:        reqBody.Status,
+		Data:          reqBody.Data,
+		Errors:        reqBody.Errors,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": id})
+}
+
+func validateGraphqlMock(mock CreateGraphqlMockRequest) error {
+	if !isValidPath(mock.Path) || strings.Contains(mock.Path, ":") || strings.Contains(mock.Path, "*") {
+		return fmt.Errorf("path [%s] must be a path without params", mock.Path)
+	}
+	if mock.OperationType != "" && !slices.Contains(graphqlOperationTypes, mock.OperationType) {
+		return fmt.Errorf("operation_type must be one of %s", strings.Join(graphqlOperationTypes, ", "))
+	}
+	if !isValidHttpResponseStatus(mock.Status) {
+		return fmt.Errorf("status [%d] must be valid", mock.Status)
+	}
+	var errorList []any
+	if mock.Errors != nil && json.Unmarshal(mock.Errors, &errorList) != nil {
+		return errors.New("errors must be an array")
+	}
+	var data map[string]any
+	if mock.Data != nil && json.Unmarshal(mock.Data, &data) != nil {
+		return errors.New("data must be an object")
+	}
+	return nil
+}
+
+func getGraphqlMocks(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mocks, err := database.Store.GetGraphqlMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(mocks)
+}
+
+func deleteGraphqlMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mockId, err := strconv.ParseInt(c.Params("mockId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "mockId must be a number",
+		})
+	}
+	deleted, err := database.Store.DeleteGraphqlMock(c.Context(), workspace.Id, mockId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("GraphQL mock [%d] is not found", mockId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// setGraphqlSchema replaces the SDL of the workspace, which must be a valid schema.
+func setGraphqlSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody SetGraphqlSchemaRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if reqBody.Path == "" {
+		reqBody.Path = defaultGraphqlPath
+	}
+	if !isValidPath(reqBody.Path) || strings.Contains(reqBody.Path, ":") || strings.Contains(reqBody.Path, "*") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("path [%s] must be a path without params", reqBody.Path),
+		})
+	}
+	if _, err := loadGraphqlSchema(reqBody.Sdl); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	schema := models.GraphqlSchema{Workspace: workspace.Id, Path: reqBody.Path, Sdl: reqBody.Sdl}
+	if err := database.Store.SaveGraphqlSchema(c.Context(), schema); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(schema)
+}
+
+func getGraphqlSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	schema, err := database.Store.GetGraphqlSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if schema == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no GraphQL schema", workspace.Id),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(schema)
+}
+
+func deleteGraphqlSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	deleted, err := database.Store.DeleteGraphqlSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no GraphQL schema", workspace.Id),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func loadGraphqlSchema(sdl string) (*ast.Schema, error) {
+	if strings.TrimSpace(sdl) == "" {
+		return nil, errors.New("sdl is required")
+	}
+	return gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: sdl})
+}
+
+// serveGraphqlMocks answers the GraphQL operations sent to the path of a GraphQL mock or schema of the workspace,
+// it returns false for any other request, or when no GraphQL mock matches and there is no schema, so the mocks are tried.
+func serveGraphqlMocks(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	if c.Method() != fiber.MethodPost && c.Method() != fiber.MethodGet {
+		return false, nil
+	}
+
+	mocks, err := database.Store.GetGraphqlMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	mocks = slices.DeleteFunc(mocks, func(mock models.GraphqlMock) bool { return mock.Path != trimmedPath })
+	storedSchema, err := database.Store.GetGraphqlSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	if storedSchema != nil && storedSchema.Path != trimmedPath {
+		storedSchema = nil
+	}
+	if len(mocks) == 0 && storedSchema == nil {
+		return false, nil
+	}
+
+	request, err := parseGraphqlRequest(c)
+	if err != nil {
+		// not a GraphQL request, e.g. a GET without a query
+		return false, nil
+	}
+
+	var schema *ast.Schema
+	var document *ast.QueryDocument
+	if storedSchema != nil {
+		if schema, err = loadGraphqlSchema(storedSchema.Sdl); err != nil {
+			return true, graphqlErrors(c, fiber.StatusInternalServerError, gqlerror.List{gqlerror.Wrap(err)})
+		}
+		var errs gqlerror.List
+		if document, errs = gqlparser.LoadQueryWithRules(schema, request.Query, nil); len(errs) > 0 {
+			return true, graphqlErrors(c, fiber.StatusBadRequest, errs)
+		}
+	} else if document, err = parser.ParseQuery(&ast.Source{Input: request.Query}); err != nil {
+		return true, graphqlErrors(c, fiber.StatusBadRequest, gqlerror.List{gqlerror.Wrap(err)})
+	}
+
+	operation, err := getGraphqlOperation(document, request.OperationName)
+	if err != nil {
+		return true, graphqlErrors(c, fiber.StatusBadRequest, gqlerror.List{gqlerror.Wrap(err)})
+	}
+
+	matched := matchGraphqlMock(mocks, operation, request.Variables)
+	if matched == nil && schema == nil {
+		return false, nil
+	}
+
+	status := fiber.StatusOK
+	response := make(map[string]any)
+	var mockedData any
+	if matched != nil {
+		status = matched.Status
+		if matched.Data != nil {
+			if err := json.Unmarshal(matched.Data, &mockedData); err != nil {
+				return true, err
+			}
+		}
+		if matched.Errors != nil {
+			response["errors"] = json.RawMessage(matched.Errors)
+		}
+	}
+	switch {
+	case schema != nil && (matched == nil || matched.Data != nil || matched.Errors == nil):
+		// the fields of the operation that are not mocked are generated from the schema
+		response["data"] = generateGraphqlObject(schema, getGraphqlRootType(schema, operation.Operation), operation.SelectionSet, mockedData)
+	default:
+		response["data"] = mockedData
+	}
+	return true, c.Status(status).JSON(response)
+}
+
+func parseGraphqlRequest(c *fiber.Ctx) (graphqlRequest, error) {
+	var request graphqlRequest
+	switch {
+	case c.Method() == fiber.MethodGet:
+		request.Query = c.Query("query")
+		request.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return request, err
+			}
+		}
+	case strings.HasPrefix(c.Get(fiber.HeaderContentType), "application/graphql"):
+		request.Query = string(c.Body())
+	default:
+		if err := json.Unmarshal(c.Body(), &request); err != nil {
+			return request, err
+		}
+	}
+	if strings.TrimSpace(request.Query) == "" {
+		return request, errors.New("query is required")
+	}
+	return request, nil
+}
+
+func getGraphqlOperation(document *ast.QueryDocument, operationName string) (*ast.OperationDefinition, error) {
+	if operationName != "" {
+		if operation := document.Operations.ForName(operationName); operation != nil {
+			return operation, nil
+		}
+		return nil, fmt.Errorf("operation [%s] is not in the document", operationName)
+	}
+	if len(document.Operations) != 1 {
+		return nil, errors.New("operationName is required when the document does not have exactly one operation")
+	}
+	return document.Operations[0], nil
+}
+
+// matchGraphqlMock returns the mock matching the operation with the most criteria, the first created one on a tie.
+func matchGraphqlMock(mocks []models.GraphqlMock, operation *ast.OperationDefinition, variables map[string]any) *models.GraphqlMock {
+	var matched *models.GraphqlMock
+	matchedCriteria := -1
+	for i, mock := range mocks {
+		if mock.OperationType != "" && mock.OperationType != string(operation.Operation) {
+			continue
+		}
+		if mock.OperationName != "" && mock.OperationName != operation.Name {
+			continue
+		}
+		criteria := len(mock.Variables)
+		if mock.OperationType != "" {
+			criteria++
+		}
+		if mock.OperationName != "" {
+			criteria++
+		}
+		if criteria > matchedCriteria && mock.Variables.MatchedBy(variables) {
+			matched = &mocks[i]
+			matchedCriteria = criteria
+		}
+	}
+	return matched
+}
+
+func graphqlErrors(c *fiber.Ctx, status int, errs gqlerror.List) error {
+	return c.Status(status).JSON(fiber.Map{"errors": errs})
+}
+
+func getGraphqlRootType(schema *ast.Schema, operation ast.Operation) *ast.Definition {
+	switch operation {
+	case ast.Mutation:
+		return schema.Mutation
+	case ast.Subscription:
+		return schema.Subscription
+	}
+	return schema.Query
+}
+
+// generateGraphqlObject returns the selected fields of the object, taking the mocked ones and generating the others.
+func generateGraphqlObject(schema *ast.Schema, definition *ast.Definition, selectionSet ast.SelectionSet, mocked any) any {
+	mockedObject, _ := mocked.(map[string]any)
+	if definition.IsAbstractType() {
+		definition = getGraphqlConcreteType(schema, definition, mockedObject)
+		if definition == nil {
+			return nil
+		}
+	}
+
+	object := make(map[string]any)
+	var collect func(selectionSet ast.SelectionSet)
+	collect = func(selectionSet ast.SelectionSet) {
+		for _, selection := range selectionSet {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				mockedValue, isMocked := mockedObject[selection.Alias]
+				switch {
+				case selection.Name == "__typename":
+					object[selection.Alias] = definition.Name
+				case selection.Definition == nil:
+					object[selection.Alias] = mockedValue
+				case isMocked && mockedValue == nil:
+					object[selection.Alias] = nil
+				default:
+					object[selection.Alias] = generateGraphqlValue(schema, selection, selection.Definition.Type, mockedValue)
+				}
+			case *ast.InlineFragment:
+				if graphqlTypeConditionApplies(schema, definition, selection.TypeCondition) {
+					collect(selection.SelectionSet)
+				}
+			case *ast.FragmentSpread:
+				if selection.Definition != nil && graphqlTypeConditionApplies(schema, definition, selection.Definition.TypeCondition) {
+					collect(selection.Definition.SelectionSet)
+				}
+			}
+		}
+	}
+	collect(selectionSet)
+	return object
+}
+
+func generateGraphqlValue(schema *ast.Schema, field *ast.Field, fieldType *ast.Type, mocked any) any {
+	if fieldType.Elem != nil {
+		mockedList, isList := mocked.([]any)
+		if mocked != nil && !isList {
+			return mocked
+		}
+		if mocked == nil {
+			// a generated list has a single generated item
+			mockedList = []any{nil}
+		}
+		list := make([]any, 0, len(mockedList))
+		for _, item := range mockedList {
+			list = append(list, generateGraphqlValue(schema, field, fieldType.Elem, item))
+		}
+		return list
+	}
+
+	definition := schema.Types[fieldType.NamedType]
+	switch {
+	case definition == nil:
+		return mocked
+	case definition.Kind == ast.Object || definition.IsAbstractType():
+		return generateGraphqlObject(schema, definition, field.SelectionSet, mocked)
+	case mocked != nil:
+		return mocked
+	case definition.Kind == ast.Enum && len(definition.EnumValues) > 0:
+		return definition.EnumValues[0].Name
+	}
+	switch definition.Name {
+	case "ID":
+		return "1"
+	case "Int":
+		return 1
+	case "Float":
+		return 1.5
+	case "Boolean":
+		return true
+	}
+	// strings, and custom scalars, are named after their field
+	return field.Name
+}
+
+// getGraphqlConcreteType picks the type of an interface or union value, the mocked __typename or else the first possible type.
+func getGraphqlConcreteType(schema *ast.Schema, definition *ast.Definition, mocked map[string]any) *ast.Definition {
+	possibleTypes := schema.GetPossibleTypes(definition)
+	if typeName, ok := mocked["__typename"].(string); ok {
+		for _, possibleType := range possibleTypes {
+			if possibleType.Name == typeName {
+				return possibleType
+			}
+		}
+	}
+	if len(possibleTypes) == 0 {
+		return nil
+	}
+	return possibleTypes[0]
+}
+
+func graphqlTypeConditionApplies(schema *ast.Schema, definition *ast.Definition, typeCondition string) bool {
+	if typeCondition == "" || typeCondition == definition.Name {
+		return true
+	}
+	condition := schema.Types[typeCondition]
+	return condition != nil && condition.IsAbstractType() && slices.Contains(schema.GetPossibleTypes(condition), definition)
+}
@@ -0,0 +1,425 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// the metadata of the gRPC calls picking the workspace and giving its access token
+const (
+	grpcWorkspaceMetadata   = "x-sarab-workspace"
+	grpcAccessTokenMetadata = "x-sarab-token"
+)
+
+type CreateGrpcMockRequest struct {
+	Service  string            `json:"service"`
+	Method   string            `json:"method"`
+	Match    models.JsonObject `json:"match"`
+	Response models.JsonValue  `json:"response"`
+	Code     codes.Code        `json:"code"`
+	Message  string            `json:"message"`
+}
+
+// SetGrpcSchemaRequest gives either the .proto files by their import path, or a FileDescriptorSet as base64.
+type SetGrpcSchemaRequest struct {
+	Files         map[string]string `json:"files"`
+	DescriptorSet []byte            `json:"descriptor_set"`
+}
+
+type GrpcSchemaResponse struct {
+	models.GrpcSchema
+	// Methods are the methods of the services in the schema, e.g. helloworld.Greeter/SayHello
+	Methods []string `json:"methods"`
+}
+
+// grpcJson is the JSON of the messages, with their proto field names and unset fields, as the mocks match them.
+var grpcJson = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+func createGrpcMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateGrpcMockRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if reqBody.Service == "" || reqBody.Method == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "service and method are required",
+		})
+	}
+	if reqBody.Code > codes.Unauthenticated {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("code [%d] must be a gRPC status code", reqBody.Code),
+		})
+	}
+
+	// the mocks are checked against the schema when there is one already
+	schema, err := database.Store.GetGrpcSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if schema != nil {
+		files, err := loadGrpcFiles(schema.DescriptorSet)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Internal Server Error",
+				"message": err.Error(),
+			})
+		}
+		if err := validateGrpcMock(files, reqBody); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+		}
+	}
+
+	id, err := database.Store.CreateGrpcMock(c.Context(), models.GrpcMock{
+		Workspace: workspace.Id,
+		Service:   reqBody.Service,
+		Method:    reqBody.Method,
+		Match:     reqBody.Match,
+		Response:  reqBody.Response,
+		Code:      reqBody.Code,
+		Message:   reqBody.Message,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": id})
+}
+
+// validateGrpcMock makes sure the method is a unary method of the schema, matched by fields of its request, and answered by its response.
+func validateGrpcMock(files *protoregistry.Files, mock CreateGrpcMockRequest) error {
+	method, err := findGrpcMethod(files, mock.Service, mock.Method)
+	if err != nil {
+		return err
+	}
+	for field := range mock.Match {
+		if method.Input().Fields().ByName(protoreflect.Name(field)) == nil {
+			return fmt.Errorf("match field [%s] is not a field of %s", field, method.Input().FullName())
+		}
+	}
+	if mock.Response != nil {
+		response := dynamicpb.NewMessage(method.Output())
+		if err := (protojson.UnmarshalOptions{Resolver: dynamicpb.NewTypes(files)}).Unmarshal(mock.Response, response); err != nil {
+			return fmt.Errorf("response is not a %s: %w", method.Output().FullName(), err)
+		}
+	}
+	return nil
+}
+
+func getGrpcMocks(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mocks, err := database.Store.GetGrpcMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(mocks)
+}
+
+func deleteGrpcMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mockId, err := strconv.ParseInt(c.Params("mockId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "mockId must be a number",
+		})
+	}
+	deleted, err := database.Store.DeleteGrpcMock(c.Context(), workspace.Id, mockId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("gRPC mock [%d] is not found", mockId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// setGrpcSchema replaces the proto descriptors of the workspace, compiling the .proto files when given.
+func setGrpcSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody SetGrpcSchemaRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	var descriptorSet models.ProtoDescriptorSet
+	var err error
+	switch {
+	case len(reqBody.Files) > 0 && len(reqBody.DescriptorSet) > 0:
+		err = errors.New("either files or descriptor_set must be given, not both")
+	case len(reqBody.Files) > 0:
+		descriptorSet, err = compileProtoFiles(c.Context(), reqBody.Files)
+	case len(reqBody.DescriptorSet) > 0:
+		descriptorSet = reqBody.DescriptorSet
+	default:
+		err = errors.New("files or descriptor_set is required")
+	}
+	var files *protoregistry.Files
+	if err == nil {
+		files, err = loadGrpcFiles(descriptorSet)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	schema := models.GrpcSchema{Workspace: workspace.Id, DescriptorSet: descriptorSet}
+	if err := database.Store.SaveGrpcSchema(c.Context(), schema); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(GrpcSchemaResponse{GrpcSchema: schema, Methods: getGrpcMethods(files)})
+}
+
+func getGrpcSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	schema, err := database.Store.GetGrpcSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if schema == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no gRPC schema", workspace.Id),
+		})
+	}
+	files, err := loadGrpcFiles(schema.DescriptorSet)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(GrpcSchemaResponse{GrpcSchema: *schema, Methods: getGrpcMethods(files)})
+}
+
+func deleteGrpcSchema(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	deleted, err := database.Store.DeleteGrpcSchema(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no gRPC schema", workspace.Id),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// compileProtoFiles compiles the .proto files, which can import each other and the well-known types,
+// into a descriptor set of them and of everything they import.
+func compileProtoFiles(ctx context.Context, sources map[string]string) (models.ProtoDescriptorSet, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	compiled, err := compiler.Compile(ctx, names...)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(file protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if added[file.Path()] {
+			return
+		}
+		added[file.Path()] = true
+		for i := 0; i < file.Imports().Len(); i++ {
+			add(file.Imports().Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range compiled {
+		add(file)
+	}
+	return proto.Marshal(set)
+}
+
+func loadGrpcFiles(descriptorSet models.ProtoDescriptorSet) (*protoregistry.Files, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("descriptor_set is not a FileDescriptorSet: %w", err)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+func getGrpcMethods(files *protoregistry.Files) []string {
+	methods := []string{}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		for i := 0; i < file.Services().Len(); i++ {
+			service := file.Services().Get(i)
+			for j := 0; j < service.Methods().Len(); j++ {
+				methods = append(methods, fmt.Sprintf("%s/%s", service.FullName(), service.Methods().Get(j).Name()))
+			}
+		}
+		return true
+	})
+	slices.Sort(methods)
+	return methods
+}
+
+// findGrpcMethod finds the unary method of the service, the streaming methods are not mocked.
+func findGrpcMethod(files *protoregistry.Files, serviceName string, methodName string) (protoreflect.MethodDescriptor, error) {
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	service, isService := descriptor.(protoreflect.ServiceDescriptor)
+	if err != nil || !isService {
+		return nil, fmt.Errorf("service [%s] is not found", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("method [%s] is not a method of service [%s]", methodName, serviceName)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("method [%s/%s] is streaming, only unary methods are mocked", serviceName, methodName)
+	}
+	return method, nil
+}
+
+// NewGrpcServer returns the server answering any gRPC call by the gRPC mocks of the workspace in its x-sarab-workspace metadata.
+func NewGrpcServer() *grpc.Server {
+	return grpc.NewServer(grpc.UnknownServiceHandler(serveGrpcCall))
+}
+
+// serveGrpcCall answers the unary call by the gRPC mock of its method matching the most request fields,
+// and records it in the journal with its status code.
+func serveGrpcCall(_ any, stream grpc.ServerStream) (err error) {
+	fullMethod, _ := grpc.MethodFromServerStream(stream)
+	entry := models.JournalEntry{Protocol: "grpc", Path: fullMethod}
+	defer func() {
+		if entry.Workspace != 0 {
+			entry.Status = int(status.Code(err))
+			recordJournalEntry(entry)
+		}
+	}()
+
+	ctx := stream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	workspace, err := lookupWorkspace(ctx, firstMetadata(md, grpcWorkspaceMetadata))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if workspace == nil {
+		return status.Errorf(codes.NotFound, "workspace [%s] of the %s metadata is not found", firstMetadata(md, grpcWorkspaceMetadata), grpcWorkspaceMetadata)
+	}
+	entry.Workspace = workspace.Id
+	if workspace.AccessTokenHash.Valid && !accessTokenMatches(firstMetadata(md, grpcAccessTokenMetadata), workspace.AccessTokenHash.String) {
+		return status.Errorf(codes.Unauthenticated, "this workspace requires its access token in the %s metadata", grpcAccessTokenMetadata)
+	}
+
+	schema, err := database.Store.GetGrpcSchema(ctx, workspace.Id)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if schema == nil {
+		return status.Errorf(codes.Unimplemented, "workspace [%d] has no gRPC schema", workspace.Id)
+	}
+	files, err := loadGrpcFiles(schema.DescriptorSet)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	serviceName, methodName, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	method, err := findGrpcMethod(files, serviceName, methodName)
+	if err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	request := dynamicpb.NewMessage(method.Input())
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+	requestJson, err := grpcJson.Marshal(request)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(requestJson, &fields); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	// protojson output is deliberately unstable, the journal gets the compact JSON
+	compactJson, _ := json.Marshal(fields)
+	entry.Message = string(compactJson)
+
+	mocks, err := database.Store.GetGrpcMocks(ctx, workspace.Id)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	var matched *models.GrpcMock
+	for i, mock := range mocks {
+		if mock.Service == serviceName && mock.Method == methodName && mock.Match.MatchedBy(fields) &&
+			(matched == nil || len(mock.Match) > len(matched.Match)) {
+			matched = &mocks[i]
+		}
+	}
+	if matched == nil {
+		return status.Errorf(codes.Unimplemented, "no gRPC mock of %s matches the request", fullMethod)
+	}
+	if matched.Code != codes.OK {
+		return status.Error(matched.Code, matched.Message)
+	}
+
+	response := dynamicpb.NewMessage(method.Output())
+	if matched.Response != nil {
+		if err := (protojson.UnmarshalOptions{Resolver: dynamicpb.NewTypes(files)}).Unmarshal(matched.Response, response); err != nil {
+			return status.Errorf(codes.Internal, "gRPC mock [%d] response is not a %s: %v", matched.Id, method.Output().FullName(), err)
+		}
+	}
+	return stream.SendMsg(response)
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"moksarab/config"
+	"moksarab/models"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// journal keeps the latest config.JournalSize entries of each workspace in memory, so it starts empty on every start.
+var journal = struct {
+	sync.Mutex
+	lastId  int64
+	entries map[int64][]models.JournalEntry
+}{entries: make(map[int64][]models.JournalEntry)}
+
+func recordJournalEntry(entry models.JournalEntry) {
+	if config.JournalSize == 0 {
+		return
+	}
+	journal.Lock()
+	defer journal.Unlock()
+
+	journal.lastId++
+	entry.Id = journal.lastId
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entries := append(journal.entries[entry.Workspace], entry)
+	if len(entries) > config.JournalSize {
+		entries = slices.Delete(entries, 0, len(entries)-config.JournalSize)
+	}
+	journal.entries[entry.Workspace] = entries
+}
+
+// recordHttpRequest records the request once it is served, with the status it was answered with.
+// The journal is readable by the viewers, so the workspace access token is left out of the query, and no header is recorded.
+func recordHttpRequest(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) {
+	violations, _ := c.Locals(requestViolationsLocal).([]models.RequestViolation)
+	query := c.Context().QueryArgs()
+	if query.Has("sarab_token") {
+		args := fiber.AcquireArgs()
+		defer fiber.ReleaseArgs(args)
+		query.CopyTo(args)
+		args.Del("sarab_token")
+		query = args
+	}
+	recordJournalEntry(models.JournalEntry{
+		Workspace:  workspace.Id,
+		Protocol:   "http",
+		Method:     c.Method(),
+		Path:       trimmedPath,
+		Query:      string(query.QueryString()),
+		Status:     c.Response().StatusCode(),
+		Message:    string(c.Body()),
+		Violations: violations,
+	})
+}
+
+func clearJournal(workspaceId int64) {
+	journal.Lock()
+	defer journal.Unlock()
+	delete(journal.entries, workspaceId)
+}
+
+// getJournal returns the journal of the workspace from the oldest entry, optionally only of a protocol or a WebSocket connection.
+func getJournal(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	journal.Lock()
+	entries := slices.Clone(journal.entries[workspace.Id])
+	journal.Unlock()
+
+	entries = slices.DeleteFunc(entries, func(entry models.JournalEntry) bool {
+		return (c.Query("protocol") != "" && entry.Protocol != c.Query("protocol")) ||
+			(c.Query("connection") != "" && entry.Connection != c.Query("connection"))
+	})
+	if entries == nil {
+		entries = []models.JournalEntry{}
+	}
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
+
+func deleteJournal(c *fiber.Ctx) error {
+
+	clearJournal(c.Locals(workspaceLocal).(*models.Workspace).Id)
+	return c.SendStatus(fiber.StatusNoContent)
+}
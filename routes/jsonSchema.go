@@ -0,0 +1,466 @@
+package routes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"moksarab/models"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxSchemaDepth stops the generation of recursive schemas, past half of it the optional properties and items are left out.
+const maxSchemaDepth = 16
+
+const componentSchemaPrefix = "#/components/schemas/"
+
+// propertyGenerators pick the fake data of the string properties without a format by their name, e.g. email or first_name.
+var propertyGenerators = map[string]string{
+	"firstname":   "person.firstName",
+	"lastname":    "person.lastName",
+	"name":        "person.name",
+	"fullname":    "person.name",
+	"email":       "internet.email",
+	"username":    "internet.username",
+	"phone":       "phone.number",
+	"phonenumber": "phone.number",
+	"mobile":      "phone.number",
+	"street":      "address.street",
+	"address":     "address.full",
+	"city":        "address.city",
+	"country":     "address.country",
+	"zip":         "address.zipCode",
+	"zipcode":     "address.zipCode",
+	"postalcode":  "address.zipCode",
+	"company":     "company.name",
+	"companyname": "company.name",
+	"iban":        "finance.iban",
+	"url":         "internet.url",
+	"website":     "internet.url",
+	"description": "lorem.sentence",
+	"summary":     "lorem.sentence",
+}
+
+// schemaGenerator generates values valid against a JSON Schema, whose $ref point to the component schemas of the OpenAPI document.
+type schemaGenerator struct {
+	faker    *faker
+	document *openapi3.T
+}
+
+func (g *schemaGenerator) resolve(ref *openapi3.SchemaRef) (*openapi3.Schema, error) {
+	if ref == nil {
+		return &openapi3.Schema{}, nil
+	}
+	if ref.Value != nil {
+		return ref.Value, nil
+	}
+	name, found := strings.CutPrefix(ref.Ref, componentSchemaPrefix)
+	if !found {
+		return nil, fmt.Errorf("$ref [%s] must point to the %s of the workspace OpenAPI document", ref.Ref, componentSchemaPrefix)
+	}
+	if g.document == nil {
+		return nil, fmt.Errorf("$ref [%s] needs the workspace OpenAPI document, but there is none", ref.Ref)
+	}
+	if g.document.Components != nil {
+		if component := g.document.Components.Schemas[name]; component != nil && component.Value != nil {
+			return component.Value, nil
+		}
+	}
+	return nil, fmt.Errorf("$ref [%s] is not found in the workspace OpenAPI document", ref.Ref)
+}
+
+// generate generates a value of the schema, name is the property it is generated for, if any.
+func (g *schemaGenerator) generate(ref *openapi3.SchemaRef, name string, depth int) (any, error) {
+	if depth > maxSchemaDepth {
+		return nil, errors.New("schema is nested too deep, or recursive through its required properties")
+	}
+	schema, err := g.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schema.Enum) > 0 {
+		return schema.Enum[g.faker.rand.IntN(len(schema.Enum))], nil
+	}
+	switch {
+	case len(schema.AllOf) > 0:
+		return g.generateAllOf(schema, name, depth)
+	case len(schema.OneOf) > 0:
+		return g.generate(schema.OneOf[g.faker.rand.IntN(len(schema.OneOf))], name, depth+1)
+	case len(schema.AnyOf) > 0:
+		return g.generate(schema.AnyOf[g.faker.rand.IntN(len(schema.AnyOf))], name, depth+1)
+	}
+
+	switch schemaType(schema) {
+	case openapi3.TypeObject:
+		return g.generateObject(schema, depth)
+	case openapi3.TypeArray:
+		return g.generateArray(schema, name, depth)
+	case openapi3.TypeInteger:
+		return g.generateInteger(schema)
+	case openapi3.TypeNumber:
+		return g.generateNumber(schema)
+	case openapi3.TypeBoolean:
+		return g.faker.rand.IntN(2) == 1, nil
+	case openapi3.TypeNull:
+		return nil, nil
+	}
+	return g.generateString(schema, name)
+}
+
+// schemaType is the first type of the schema, or the one its keywords imply, string by default.
+func schemaType(schema *openapi3.Schema) string {
+	for _, typ := range schema.Type.Slice() {
+		if typ != openapi3.TypeNull || len(schema.Type.Slice()) == 1 {
+			return typ
+		}
+	}
+	switch {
+	case len(schema.Properties) > 0 || schema.AdditionalProperties.Schema != nil:
+		return openapi3.TypeObject
+	case schema.Items != nil:
+		return openapi3.TypeArray
+	}
+	return openapi3.TypeString
+}
+
+// generateAllOf merges the objects generated for every schema of allOf, and for the properties of the schema itself.
+func (g *schemaGenerator) generateAllOf(schema *openapi3.Schema, name string, depth int) (any, error) {
+	merged := make(map[string]any)
+	for _, part := range schema.AllOf {
+		value, err := g.generate(part, name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		object, isObject := value.(map[string]any)
+		if !isObject {
+			return value, nil
+		}
+		maps.Copy(merged, object)
+	}
+	if len(schema.Properties) > 0 {
+		own, err := g.generateObject(schema, depth)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(merged, own)
+	}
+	return merged, nil
+}
+
+// generateObject generates the required properties, and half of the time each optional one but the writeOnly ones.
+func (g *schemaGenerator) generateObject(schema *openapi3.Schema, depth int) (map[string]any, error) {
+	object := make(map[string]any)
+	names := slices.Sorted(maps.Keys(schema.Properties))
+	var included []string
+	var leftOut []string
+	for _, name := range names {
+		property, err := g.resolve(schema.Properties[name])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case slices.Contains(schema.Required, name):
+			included = append(included, name)
+		case property.WriteOnly:
+		case depth < maxSchemaDepth/2 && g.faker.rand.IntN(2) == 0 && (schema.MaxProps == nil || uint64(len(included)) < *schema.MaxProps):
+			included = append(included, name)
+		default:
+			leftOut = append(leftOut, name)
+		}
+	}
+	for _, name := range leftOut {
+		if uint64(len(included)) >= schema.MinProps {
+			break
+		}
+		included = append(included, name)
+	}
+
+	for _, name := range included {
+		value, err := g.generate(schema.Properties[name], name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		object[name] = value
+	}
+	if len(schema.Properties) == 0 && schema.AdditionalProperties.Schema != nil {
+		for range g.faker.intBetween(max(int(schema.MinProps), 1), max(int(schema.MinProps), 3)) {
+			value, err := g.generate(schema.AdditionalProperties.Schema, "", depth+1)
+			if err != nil {
+				return nil, err
+			}
+			object[g.faker.pick(loremWords)+g.faker.digits(2)] = value
+		}
+	}
+	return object, nil
+}
+
+func (g *schemaGenerator) generateArray(schema *openapi3.Schema, name string, depth int) ([]any, error) {
+	minItems := int(schema.MinItems)
+	maxItems := max(minItems, 3)
+	if schema.MaxItems != nil {
+		maxItems = int(*schema.MaxItems)
+	}
+	if minItems > maxItems {
+		return nil, fmt.Errorf("minItems %d is greater than maxItems %d", minItems, maxItems)
+	}
+	count := g.faker.intBetween(max(minItems, min(1, maxItems)), maxItems)
+	if depth >= maxSchemaDepth/2 {
+		count = minItems
+	}
+
+	items := []any{}
+	var generated []string
+	// the unique items are given a few tries, a small enum may not have enough of them
+	for tries := 0; len(items) < count && tries < count*10; tries++ {
+		item, err := g.generate(schema.Items, name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if schema.UniqueItems {
+			raw, _ := json.Marshal(item)
+			if slices.Contains(generated, string(raw)) {
+				continue
+			}
+			generated = append(generated, string(raw))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// numberBounds are the minimum and maximum of the schema, 1000 apart when only one of them, or none, is given.
+func numberBounds(schema *openapi3.Schema) (float64, float64) {
+	low, high := 0.0, 1000.0
+	switch {
+	case schema.Min != nil && schema.Max != nil:
+		low, high = *schema.Min, *schema.Max
+	case schema.Min != nil:
+		low, high = *schema.Min, *schema.Min+1000
+	case schema.Max != nil:
+		low, high = min(0, *schema.Max-1000), *schema.Max
+	}
+	return low, high
+}
+
+func (g *schemaGenerator) generateInteger(schema *openapi3.Schema) (int64, error) {
+	low, high := numberBounds(schema)
+	lowest, highest := int64(math.Ceil(low)), int64(math.Floor(high))
+	if schema.ExclusiveMin && float64(lowest) == low {
+		lowest++
+	}
+	if schema.ExclusiveMax && float64(highest) == high {
+		highest--
+	}
+	step := int64(1)
+	if schema.MultipleOf != nil {
+		if *schema.MultipleOf != math.Trunc(*schema.MultipleOf) || *schema.MultipleOf < 1 {
+			return 0, fmt.Errorf("multipleOf %g of an integer must be a positive integer", *schema.MultipleOf)
+		}
+		step = int64(*schema.MultipleOf)
+	}
+	// the multiples of the step between lowest and highest
+	first, last := int64(math.Ceil(float64(lowest)/float64(step))), int64(math.Floor(float64(highest)/float64(step)))
+	if first > last {
+		return 0, fmt.Errorf("no integer is between minimum %g and maximum %g", low, high)
+	}
+	return (first + g.faker.rand.Int64N(last-first+1)) * step, nil
+}
+
+func (g *schemaGenerator) generateNumber(schema *openapi3.Schema) (float64, error) {
+	low, high := numberBounds(schema)
+	if schema.MultipleOf != nil {
+		if *schema.MultipleOf <= 0 {
+			return 0, fmt.Errorf("multipleOf %g must be positive", *schema.MultipleOf)
+		}
+		first, last := math.Ceil(low / *schema.MultipleOf), math.Floor(high / *schema.MultipleOf)
+		if schema.ExclusiveMin && first**schema.MultipleOf == low {
+			first++
+		}
+		if schema.ExclusiveMax && last**schema.MultipleOf == high {
+			last--
+		}
+		if first > last {
+			return 0, fmt.Errorf("no multiple of %g is between minimum %g and maximum %g", *schema.MultipleOf, low, high)
+		}
+		return (first + float64(g.faker.rand.Int64N(int64(last-first)+1))) * *schema.MultipleOf, nil
+	}
+	if low > high || (low == high && (schema.ExclusiveMin || schema.ExclusiveMax)) {
+		return 0, fmt.Errorf("no number is between minimum %g and maximum %g", low, high)
+	}
+	// two decimals, unless the bounds are too close for them
+	value := math.Round((low+g.faker.rand.Float64()*(high-low))*100) / 100
+	if value < low || value > high || (schema.ExclusiveMin && value == low) || (schema.ExclusiveMax && value == high) {
+		value = (low + high) / 2
+	}
+	return value, nil
+}
+
+func (g *schemaGenerator) generateString(schema *openapi3.Schema, name string) (string, error) {
+	switch schema.Format {
+	case "date":
+		return g.faker.daysFromToday(-g.faker.intBetween(1, 365)).Format(time.DateOnly), nil
+	case "date-time":
+		return fakeGenerators["date.timestamp"](g.faker).(string), nil
+	case "time":
+		return fmt.Sprintf("%02d:%02d:%02d", g.faker.rand.IntN(24), g.faker.rand.IntN(60), g.faker.rand.IntN(60)), nil
+	case "email":
+		return fakeGenerators["internet.email"](g.faker).(string), nil
+	case "uuid":
+		return g.faker.uuid(), nil
+	case "uri", "url":
+		return fakeGenerators["internet.url"](g.faker).(string), nil
+	case "hostname":
+		return strings.ToLower(g.faker.pick(companyWords)) + ".example.com", nil
+	case "ipv4":
+		return fmt.Sprintf("%d.%d.%d.%d", g.faker.intBetween(1, 223), g.faker.rand.IntN(256), g.faker.rand.IntN(256), g.faker.intBetween(1, 254)), nil
+	case "ipv6":
+		return fmt.Sprintf("2001:db8::%x:%x", g.faker.rand.IntN(0x10000), g.faker.rand.IntN(0x10000)), nil
+	case "byte":
+		raw := make([]byte, g.faker.intBetween(4, 16))
+		_, _ = g.faker.source.Read(raw)
+		return base64.StdEncoding.EncodeToString(raw), nil
+	}
+	if schema.Pattern != "" {
+		return g.faker.matchingString(schema.Pattern)
+	}
+
+	value := g.faker.sentence()
+	if generator, found := propertyGenerators[strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))]; found {
+		value = fakeGenerators[generator](g.faker).(string)
+	}
+	// the value is padded with words, or cut, to the length of the schema
+	for utf8.RuneCountInString(value) < int(schema.MinLength) {
+		value += " " + g.faker.pick(loremWords)
+	}
+	if schema.MaxLength != nil && utf8.RuneCountInString(value) > int(*schema.MaxLength) {
+		value = string([]rune(value)[:*schema.MaxLength])
+	}
+	return value, nil
+}
+
+// matchingString generates a string the regular expression matches.
+func (f *faker) matchingString(pattern string) (string, error) {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("pattern [%s] is not valid: %w", pattern, err)
+	}
+	var matching strings.Builder
+	f.writeMatching(parsed.Simplify(), &matching)
+	return matching.String(), nil
+}
+
+func (f *faker) writeMatching(re *syntax.Regexp, out *strings.Builder) {
+	repeat := func(min int, max int) {
+		for range f.intBetween(min, max) {
+			f.writeMatching(re.Sub[0], out)
+		}
+	}
+	switch re.Op {
+	case syntax.OpLiteral:
+		out.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		out.WriteRune(f.classRune(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		out.WriteByte(f.pick(loremWords)[0])
+	case syntax.OpCapture:
+		f.writeMatching(re.Sub[0], out)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			f.writeMatching(sub, out)
+		}
+	case syntax.OpAlternate:
+		f.writeMatching(re.Sub[f.rand.IntN(len(re.Sub))], out)
+	case syntax.OpStar:
+		repeat(0, 3)
+	case syntax.OpPlus:
+		repeat(1, 4)
+	case syntax.OpQuest:
+		repeat(0, 1)
+	case syntax.OpRepeat:
+		if re.Max < 0 {
+			repeat(re.Min, re.Min+3)
+		} else {
+			repeat(re.Min, re.Max)
+		}
+	}
+}
+
+// classRune picks a printable ASCII rune of the character class, given as ranges, or else its first rune.
+func (f *faker) classRune(ranges []rune) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := max(ranges[i], ' '); r <= min(ranges[i+1], '~'); r++ {
+			printable = append(printable, r)
+		}
+	}
+	if len(printable) == 0 {
+		return ranges[0]
+	}
+	return printable[f.rand.IntN(len(printable))]
+}
+
+func parseResponseSchema(raw models.JsonValue) (*openapi3.SchemaRef, error) {
+	var schema openapi3.SchemaRef
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("schema is not a valid JSON Schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// generateSchemaResponse generates a JSON body valid against the schema, different on every call unless it has a seed.
+func generateSchemaResponse(ctx context.Context, workspaceId int64, raw models.JsonValue, seed *int64) ([]byte, error) {
+	document, err := loadOpenapiDocument(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	return generateSchemaBody(document, raw, seed)
+}
+
+// generateSchemaBody generates the body with the $ref of the schema resolved in the document, which may be nil.
+func generateSchemaBody(document *openapi3.T, raw models.JsonValue, seed *int64) ([]byte, error) {
+	schema, err := parseResponseSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	generator := schemaGenerator{faker: newFaker(seed), document: document}
+	value, err := generator.generate(schema, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// validateGeneratedResponse checks the responses whose body is rendered from a template or generated from a schema.
+func validateGeneratedResponse(ctx context.Context, workspaceId int64, response models.RouteResponse) error {
+	if err := validateTemplatedResponse(response); err != nil {
+		return err
+	}
+	return validateSchemaResponse(ctx, workspaceId, response)
+}
+
+// validateSchemaResponse makes sure a response generated from its schema has nothing else to send, and generates it once to catch the invalid schemas.
+func validateSchemaResponse(ctx context.Context, workspaceId int64, response models.RouteResponse) error {
+	if response.Seed != nil && !response.Templated && response.Schema == nil {
+		return errors.New("seed is only for templated responses and responses generated from a schema")
+	}
+	if response.Schema == nil {
+		return nil
+	}
+	if response.Response.Valid || !response.Stream.IsZero() || response.Templated {
+		return errors.New("a response generated from a schema has no response body, stream, or template")
+	}
+	if _, err := generateSchemaResponse(ctx, workspaceId, response.Schema, response.Seed); err != nil {
+		return fmt.Errorf("no response can be generated from the schema: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwk is a public key of a JWKS, only RSA keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+func newJwk(key *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: getKeyId(key),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func (key jwk) publicKey() (*rsa.PublicKey, error) {
+	if key.Kty != "RSA" {
+		return nil, fmt.Errorf("key type [%s] is not supported", key.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// getKeyId derives the kid from the key itself, so it stays the same as long as the key does.
+func getKeyId(key *rsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	hash := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+// signJwt signs the claims with RS256.
+func signJwt(key *rsa.PrivateKey, claims map[string]any) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "RS256", Typ: "JWT", Kid: getKeyId(&key.PublicKey)})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verifyJwt checks the signature of the token with the key returned for its header, either an *rsa.PublicKey for RS256
+// or a []byte secret for HS256, and that it is not expired, then returns its claims.
+func verifyJwt(token string, getKey func(header jwtHeader) (any, error)) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the token is not a JWT")
+	}
+	var header jwtHeader
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	key, err := getKey(header)
+	if err != nil {
+		return nil, err
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	// the algorithm has to agree with the configured key, so an HS256 token can't be verified with a public key
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("the token algorithm [%s] is not supported, it must be RS256", header.Alg)
+		}
+		hash := sha256.Sum256(signingInput)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+			return nil, errors.New("the token signature is invalid")
+		}
+	case []byte:
+		if header.Alg != "HS256" {
+			return nil, fmt.Errorf("the token algorithm [%s] is not supported, it must be HS256", header.Alg)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, errors.New("the token signature is invalid")
+		}
+	default:
+		return nil, fmt.Errorf("cannot verify a token with a %T key", key)
+	}
+
+	var claims map[string]any
+	if err := decodeJwtPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if exp, ok := claims["exp"].(float64); ok && now >= int64(exp) {
+		return nil, errors.New("the token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < int64(nbf) {
+		return nil, errors.New("the token is not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJwtPart(part string, value any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, value)
+}
+
+const jwksCacheLifetime = 5 * time.Minute
+
+// jwksMinRefetchInterval bounds how often the tokens with an unknown kid fetch the JWKS again.
+const jwksMinRefetchInterval = 10 * time.Second
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// jwksCache keeps the keys fetched from each JWKS URL for jwksCacheLifetime.
+var jwksCache = struct {
+	sync.Mutex
+	keys map[string]cachedJwks
+}{keys: make(map[string]cachedJwks)}
+
+type cachedJwks struct {
+	keys      []jwk
+	fetchedAt time.Time
+}
+
+// getJwksKey returns the RSA key of the JWKS at jwksUrl with the kid, or its only key when the token has no kid.
+// The JWKS is fetched again for an unknown kid, in case its keys were rotated, at most once every jwksMinRefetchInterval.
+func getJwksKey(ctx context.Context, jwksUrl, kid string) (*rsa.PublicKey, error) {
+	jwksCache.Lock()
+	cached, found := jwksCache.keys[jwksUrl]
+	jwksCache.Unlock()
+	stale := !found || time.Since(cached.fetchedAt) > jwksCacheLifetime
+	for {
+		if stale {
+			keys, err := fetchJwks(ctx, jwksUrl)
+			if err != nil {
+				return nil, err
+			}
+			cached = cachedJwks{keys: keys, fetchedAt: time.Now()}
+			jwksCache.Lock()
+			jwksCache.keys[jwksUrl] = cached
+			jwksCache.Unlock()
+		}
+		for _, key := range cached.keys {
+			if key.Kid == kid || (kid == "" && len(cached.keys) == 1) {
+				return key.publicKey()
+			}
+		}
+		if stale || time.Since(cached.fetchedAt) < jwksMinRefetchInterval {
+			return nil, fmt.Errorf("the token key [%s] is not in the JWKS", kid)
+		}
+		stale = true
+	}
+}
+
+func fetchJwks(ctx context.Context, jwksUrl string) ([]jwk, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the JWKS: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch the JWKS, it responded with %d", res.StatusCode)
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("could not decode the JWKS: %w", err)
+	}
+	return jwks.Keys, nil
+}
@@ -0,0 +1,231 @@
+package routes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"moksarab/certs"
+	"moksarab/config"
+	"moksarab/database"
+	"moksarab/models"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// workspaceListeners are the extra apps listening on the workspace ports, by port.
+var workspaceListeners = struct {
+	sync.Mutex
+	apps map[int]*fiber.App
+}{apps: make(map[int]*fiber.App)}
+
+// StartWorkspaceListeners starts a listener for every workspace having a port, a port that cannot be bound is only logged.
+func StartWorkspaceListeners(ctx context.Context, serverHeader string) error {
+	workspaces, err := database.Store.GetWorkspacesWithPort(ctx)
+	if err != nil {
+		return err
+	}
+	for _, workspace := range workspaces {
+		if err := startWorkspaceListener(workspace, serverHeader); err != nil {
+			log.Errorf("Could not start the listener of workspace %d: %v", workspace.Id, err)
+		}
+	}
+	return nil
+}
+
+// ShutdownWorkspaceListeners stops all the workspace listeners, it is called when the main app shuts down.
+func ShutdownWorkspaceListeners() error {
+	workspaceListeners.Lock()
+	defer workspaceListeners.Unlock()
+
+	for port, app := range workspaceListeners.apps {
+		if err := app.Shutdown(); err != nil {
+			log.Errorf("Could not shutdown the listener on port %d: %v", port, err)
+		}
+		delete(workspaceListeners.apps, port)
+	}
+	return nil
+}
+
+// startWorkspaceListener binds the workspace port right away, so a port already in use is reported to the caller.
+func startWorkspaceListener(workspace models.Workspace, serverHeader string) error {
+	workspaceListeners.Lock()
+	defer workspaceListeners.Unlock()
+
+	workspaceId, port := workspace.Id, *workspace.Port
+	if _, found := workspaceListeners.apps[port]; found {
+		return fmt.Errorf("port %d is already listened on", port)
+	}
+	var listener net.Listener
+	if workspace.PortTls {
+		clientCaPem := ""
+		if workspace.PortClientCa != nil {
+			clientCaPem = *workspace.PortClientCa
+		}
+		tlsConfig, err := certs.ListenerConfig(clientCaPem)
+		if err != nil {
+			return err
+		}
+		if listener, err = tls.Listen("tcp", fmt.Sprintf(":%d", port), tlsConfig); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port)); err != nil {
+			return err
+		}
+	}
+
+	app := fiber.New(fiber.Config{
+		CaseSensitive:         true,
+		ServerHeader:          serverHeader,
+		DisableStartupMessage: true,
+	})
+	app.Use(func(c *fiber.Ctx) error {
+		// the workspace is loaded on every request, so its access token changes apply right away
+		workspace, err := database.Store.GetWorkspace(c.Context(), workspaceId)
+		if err != nil {
+			return HandleSQLErrors(c, err)
+		}
+		if workspace == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Not Found",
+				"message": fmt.Sprintf("workspace [%d] is not found", workspaceId),
+			})
+		}
+		return serveWorkspaceMocks(c, workspace, c.Path())
+	})
+	go func() {
+		if err := app.Listener(listener); err != nil {
+			log.Errorf("The listener of workspace %d on port %d stopped: %v", workspaceId, port, err)
+		}
+	}()
+
+	workspaceListeners.apps[port] = app
+	log.Infof("Workspace %d is listening on port %d", workspaceId, port)
+	return nil
+}
+
+func stopWorkspaceListener(port int) {
+	workspaceListeners.Lock()
+	defer workspaceListeners.Unlock()
+
+	app, found := workspaceListeners.apps[port]
+	if !found {
+		return
+	}
+	if err := app.Shutdown(); err != nil {
+		log.Errorf("Could not shutdown the listener on port %d: %v", port, err)
+	}
+	delete(workspaceListeners.apps, port)
+}
+
+type SetWorkspacePortRequest struct {
+	Port int  `json:"port"`
+	Tls  bool `json:"tls"`
+	// ClientCa is the PEM of the CAs the client certificates must be issued by, the listener requires mTLS when set
+	ClientCa string `json:"client_ca,omitempty"`
+}
+
+// setWorkspacePort moves the workspace listener to the port, the previous listener is stopped only once the new one is up.
+// On the same port the listener is restarted with the new settings.
+func setWorkspacePort(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody SetWorkspacePortRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if !isValidWorkspacePort(reqBody.Port) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "port must be between 1 and 65535, and not the server, TLS, or gRPC port",
+		})
+	}
+	workspaces, err := database.Store.GetWorkspacesWithPort(c.Context())
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	for _, other := range workspaces {
+		if other.Id != workspace.Id && *other.Port == reqBody.Port {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Conflict",
+				"message": fmt.Sprintf("port %d is used by workspace [%s]", reqBody.Port, other.Name),
+			})
+		}
+	}
+	if reqBody.ClientCa != "" && (!reqBody.Tls || !x509.NewCertPool().AppendCertsFromPEM([]byte(reqBody.ClientCa))) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "client_ca must be PEM certificates, and requires tls",
+		})
+	}
+
+	previous := *workspace
+	workspace.Port, workspace.PortTls, workspace.PortClientCa = &reqBody.Port, reqBody.Tls, nil
+	if reqBody.ClientCa != "" {
+		workspace.PortClientCa = &reqBody.ClientCa
+	}
+	samePort := previous.Port != nil && *previous.Port == reqBody.Port
+	if samePort {
+		stopWorkspaceListener(reqBody.Port)
+	}
+
+	serverHeader := c.App().Config().ServerHeader
+	restorePrevious := func() {
+		if !samePort {
+			return
+		}
+		if err := startWorkspaceListener(previous, serverHeader); err != nil {
+			log.Errorf("Could not restart the listener of workspace %d: %v", previous.Id, err)
+		}
+	}
+	if err := startWorkspaceListener(*workspace, serverHeader); err != nil {
+		restorePrevious()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   "Conflict",
+			"message": fmt.Sprintf("cannot listen on port %d: %v", reqBody.Port, err),
+		})
+	}
+	if _, err := database.Store.SetWorkspacePort(c.Context(), *workspace); err != nil {
+		stopWorkspaceListener(reqBody.Port)
+		restorePrevious()
+		return HandleSQLErrors(c, err)
+	}
+	if previous.Port != nil && !samePort {
+		stopWorkspaceListener(*previous.Port)
+	}
+	return c.Status(fiber.StatusOK).JSON(workspace)
+}
+
+func deleteWorkspacePort(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	if workspace.Port == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no port", workspace.Id),
+		})
+	}
+	if _, err := database.Store.SetWorkspacePort(c.Context(), models.Workspace{Id: workspace.Id}); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	stopWorkspaceListener(*workspace.Port)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// isValidWorkspacePort rejects the ports out of range and the ports of the server listeners.
+func isValidWorkspacePort(port int) bool {
+	if port < 1 || port > 65535 {
+		return false
+	}
+	return !slices.Contains([]string{config.Port, config.TlsPort, config.GrpcPort}, strconv.Itoa(port))
+}
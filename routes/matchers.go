@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"crypto/x509"
+	"errors"
+	"moksarab/models"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// matchersMatch tells if the request satisfies all the matchers of a response.
+func matchersMatch(c *fiber.Ctx, token *bearerJwt, matchers models.Matchers) bool {
+	for _, matcher := range matchers {
+		switch matcher.Type {
+		case models.ClientCertMatcher:
+			if !clientCertMatches(c, matcher) {
+				return false
+			}
+		case models.JwtMatcher:
+			if !jwtMatches(c, token, matcher) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// clientCertMatches only considers a client certificate verified by the listener, which requires mTLS to be enabled on it.
+func clientCertMatches(c *fiber.Ctx, matcher models.Matcher) bool {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return false
+	}
+	certificate := state.VerifiedChains[0][0]
+	if matcher.Subject != "" && matcher.Subject != certificate.Subject.String() && matcher.Subject != certificate.Subject.CommonName {
+		return false
+	}
+	return matcher.San == "" || slices.Contains(getCertificateSans(certificate), matcher.San)
+}
+
+// bearerJwt is the bearer token of a request, verified once for each secret or JWKS of the jwt matchers.
+type bearerJwt struct {
+	token  string
+	claims map[string]map[string]any
+	errors map[string]error
+}
+
+func newBearerJwt(c *fiber.Ctx) *bearerJwt {
+	token, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	return &bearerJwt{
+		token:  strings.TrimSpace(token),
+		claims: make(map[string]map[string]any),
+		errors: make(map[string]error),
+	}
+}
+
+// verify returns the claims of the token once verified with the secret or the JWKS of the matcher.
+func (token *bearerJwt) verify(c *fiber.Ctx, matcher models.Matcher) (map[string]any, error) {
+	keySource := "jwks:" + matcher.JwksUrl
+	if matcher.Secret != "" {
+		keySource = "secret:" + matcher.Secret
+	}
+	if claims, found := token.claims[keySource]; found {
+		return claims, nil
+	}
+	if err, found := token.errors[keySource]; found {
+		return nil, err
+	}
+
+	var claims map[string]any
+	var err error
+	if token.token == "" {
+		err = errors.New("a Bearer token is required")
+	} else {
+		claims, err = verifyJwt(token.token, func(header jwtHeader) (any, error) {
+			if matcher.Secret != "" {
+				return []byte(matcher.Secret), nil
+			}
+			return getJwksKey(c.Context(), matcher.JwksUrl, header.Kid)
+		})
+	}
+	if err != nil {
+		token.errors[keySource] = err
+		return nil, err
+	}
+	token.claims[keySource] = claims
+	return claims, nil
+}
+
+// validate returns why the token is not verified by any jwt matcher of the responses, or nil when one verifies it or there are none.
+func (token *bearerJwt) validate(c *fiber.Ctx, responsesMatchers []models.Matchers) error {
+	var err error
+	for _, matchers := range responsesMatchers {
+		for _, matcher := range matchers {
+			if matcher.Type != models.JwtMatcher {
+				continue
+			}
+			if _, err = token.verify(c, matcher); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// jwtMatches requires the token to be verified by the matcher, then to have its sub, audience, and scopes.
+func jwtMatches(c *fiber.Ctx, token *bearerJwt, matcher models.Matcher) bool {
+	claims, err := token.verify(c, matcher)
+	if err != nil {
+		return false
+	}
+	if matcher.Subject != "" && claims["sub"] != matcher.Subject {
+		return false
+	}
+	if matcher.Audience != "" && !slices.Contains(getStringsClaim(claims["aud"]), matcher.Audience) {
+		return false
+	}
+	scopes := getStringsClaim(claims["scope"])
+	scopes = append(scopes, getStringsClaim(claims["scp"])...)
+	for _, scope := range strings.Fields(matcher.Scope) {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// getStringsClaim reads a claim that is either a space separated string or an array of strings, like aud and scope.
+func getStringsClaim(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []any:
+		var values []string
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func getCertificateSans(certificate *x509.Certificate) []string {
+	sans := slices.Clone(certificate.DNSNames)
+	sans = append(sans, certificate.EmailAddresses...)
+	for _, ip := range certificate.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// validateMatchers checks the matchers given to a new response.
+func validateMatchers(matchers models.Matchers) error {
+	for _, matcher := range matchers {
+		if err := matcher.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"moksarab/database"
+	"moksarab/models"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcAuthorizationCode is an issued authorization code, kept in memory until it is exchanged or expires.
+type oidcAuthorizationCode struct {
+	workspaceId         int64
+	clientId            string
+	redirectUri         string
+	subject             string
+	nonce               string
+	scope               string
+	codeChallenge       string
+	codeChallengeMethod string
+	expiresAt           time.Time
+}
+
+var oidcAuthorizationCodes = struct {
+	sync.Mutex
+	codes map[string]oidcAuthorizationCode
+}{codes: make(map[string]oidcAuthorizationCode)}
+
+const oidcAuthorizationCodeLifetime = 5 * time.Minute
+
+// oidcProviderCreations holds a mutex by workspace id, so the first concurrent requests create a single signing key.
+var oidcProviderCreations sync.Map
+
+// getOidcProvider returns the provider of the workspace with its parsed signing key, creating it with the default settings on first use.
+func getOidcProvider(ctx context.Context, workspaceId int64) (*models.OidcProvider, *rsa.PrivateKey, error) {
+	provider, err := database.Store.GetOidcProvider(ctx, workspaceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if provider == nil {
+		return createOidcProvider(ctx, workspaceId)
+	}
+	return parseOidcProvider(provider)
+}
+
+// createOidcProvider saves the default provider of the workspace, unless a concurrent request created it first.
+func createOidcProvider(ctx context.Context, workspaceId int64) (*models.OidcProvider, *rsa.PrivateKey, error) {
+	creation, _ := oidcProviderCreations.LoadOrStore(workspaceId, &sync.Mutex{})
+	creation.(*sync.Mutex).Lock()
+	defer creation.(*sync.Mutex).Unlock()
+
+	provider, err := database.Store.GetOidcProvider(ctx, workspaceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if provider != nil {
+		return parseOidcProvider(provider)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider = &models.OidcProvider{
+		Workspace:  workspaceId,
+		Settings:   models.DefaultOidcSettings(),
+		SigningKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	if err := database.Store.SaveOidcProvider(ctx, *provider); err != nil {
+		return nil, nil, err
+	}
+	return provider, key, nil
+}
+
+func parseOidcProvider(provider *models.OidcProvider) (*models.OidcProvider, *rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(provider.SigningKey))
+	if block == nil {
+		return nil, nil, errors.New("the OIDC signing key is not PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("the OIDC signing key is not an RSA key")
+	}
+	return provider, rsaKey, nil
+}
+
+// serveOidcEndpoint serves the built-in endpoints of an oidc workspace, it returns false for any other path so the mocks are tried.
+func serveOidcEndpoint(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	var handler func(*fiber.Ctx, oidcRequest) error
+	switch {
+	case c.Method() == fiber.MethodGet && trimmedPath == "/.well-known/openid-configuration":
+		handler = getOidcDiscovery
+	case c.Method() == fiber.MethodGet && trimmedPath == "/jwks":
+		handler = getOidcJwks
+	case c.Method() == fiber.MethodGet && trimmedPath == "/authorize":
+		handler = oidcAuthorize
+	case c.Method() == fiber.MethodPost && trimmedPath == "/token":
+		handler = oidcToken
+	case (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodPost) && trimmedPath == "/userinfo":
+		handler = getOidcUserinfo
+	default:
+		return false, nil
+	}
+
+	provider, key, err := getOidcProvider(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	return true, handler(c, oidcRequest{
+		provider: provider,
+		key:      key,
+		// the issuer is wherever the workspace is reached, e.g. /sarab/:workspace, a mapped host, or the workspace port
+		issuer: c.Protocol() + "://" + c.Hostname() + strings.TrimSuffix(c.Path(), trimmedPath),
+	})
+}
+
+type oidcRequest struct {
+	provider *models.OidcProvider
+	key      *rsa.PrivateKey
+	issuer   string
+}
+
+func (request oidcRequest) findClient(clientId string) *models.OidcClient {
+	for _, client := range request.provider.Settings.Clients {
+		if client.ClientId == clientId {
+			return &client
+		}
+	}
+	return nil
+}
+
+func (request oidcRequest) findUser(subject string) *models.OidcUser {
+	for _, user := range request.provider.Settings.Users {
+		if user.Subject == subject || subject == "" {
+			return &user
+		}
+	}
+	return nil
+}
+
+// claims are the provider, client, and user claims, overridden by the registered ones.
+func (request oidcRequest) claims(client *models.OidcClient, user *models.OidcUser, registered map[string]any) map[string]any {
+	claims := make(map[string]any)
+	maps.Copy(claims, request.provider.Settings.Claims)
+	maps.Copy(claims, client.Claims)
+	if user != nil {
+		maps.Copy(claims, user.Claims)
+	}
+	now := time.Now()
+	claims["iss"] = request.issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Duration(request.provider.Settings.TokenLifetime) * time.Second).Unix()
+	maps.Copy(claims, registered)
+	return claims
+}
+
+func oidcError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func getOidcDiscovery(c *fiber.Ctx, request oidcRequest) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"issuer":                                request.issuer,
+		"authorization_endpoint":                request.issuer + "/authorize",
+		"token_endpoint":                        request.issuer + "/token",
+		"userinfo_endpoint":                     request.issuer + "/userinfo",
+		"jwks_uri":                              request.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+func getOidcJwks(c *fiber.Ctx, request oidcRequest) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"keys": []jwk{newJwk(&request.key.PublicKey)}})
+}
+
+// oidcAuthorize logs in right away, as the user given by login_hint or else the first one, and redirects back with the code.
+func oidcAuthorize(c *fiber.Ctx, request oidcRequest) error {
+	client := request.findClient(c.Query("client_id"))
+	if client == nil {
+		return oidcError(c, fiber.StatusBadRequest, "invalid_client", "client_id is unknown")
+	}
+	redirectUri, err := url.Parse(c.Query("redirect_uri"))
+	if err != nil || !redirectUri.IsAbs() || !slices.Contains(client.RedirectUris, c.Query("redirect_uri")) {
+		return oidcError(c, fiber.StatusBadRequest, "invalid_request", "redirect_uri is missing or not allowed for the client")
+	}
+
+	query := redirectUri.Query()
+	if state := c.Query("state"); state != "" {
+		query.Set("state", state)
+	}
+	user := request.findUser(c.Query("login_hint"))
+	switch {
+	case c.Query("response_type") != "code":
+		query.Set("error", "unsupported_response_type")
+	case user == nil:
+		query.Set("error", "access_denied")
+		query.Set("error_description", "there is no user to log in as")
+	case client.ClientSecret == "" && c.Query("code_challenge") == "":
+		query.Set("error", "invalid_request")
+		query.Set("error_description", "public clients must use PKCE")
+	default:
+		code, err := generateSecret("")
+		if err != nil {
+			return err
+		}
+		oidcAuthorizationCodes.Lock()
+		// the codes never exchanged are dropped once expired
+		now := time.Now()
+		maps.DeleteFunc(oidcAuthorizationCodes.codes, func(_ string, issued oidcAuthorizationCode) bool {
+			return now.After(issued.expiresAt)
+		})
+		oidcAuthorizationCodes.codes[code] = oidcAuthorizationCode{
+			workspaceId:         request.provider.Workspace,
+			clientId:            client.ClientId,
+			redirectUri:         c.Query("redirect_uri"),
+			subject:             user.Subject,
+			nonce:               c.Query("nonce"),
+			scope:               c.Query("scope"),
+			codeChallenge:       c.Query("code_challenge"),
+			codeChallengeMethod: c.Query("code_challenge_method", "plain"),
+			expiresAt:           now.Add(oidcAuthorizationCodeLifetime),
+		}
+		oidcAuthorizationCodes.Unlock()
+		query.Set("code", code)
+	}
+	redirectUri.RawQuery = query.Encode()
+	return c.Redirect(redirectUri.String(), fiber.StatusFound)
+}
+
+func oidcToken(c *fiber.Ctx, request oidcRequest) error {
+	clientId, clientSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+	if authorization, found := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic "); found {
+		credentials, err := base64.StdEncoding.DecodeString(authorization)
+		if err != nil {
+			return oidcError(c, fiber.StatusUnauthorized, "invalid_client", "the basic authorization is invalid")
+		}
+		clientId, clientSecret, _ = strings.Cut(string(credentials), ":")
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+	client := request.findClient(clientId)
+	if client == nil || (client.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) != 1) {
+		return oidcError(c, fiber.StatusUnauthorized, "invalid_client", "the client is unknown or its secret is wrong")
+	}
+
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		return exchangeOidcAuthorizationCode(c, request, client)
+	case "client_credentials":
+		if client.ClientSecret == "" {
+			return oidcError(c, fiber.StatusUnauthorized, "invalid_client", "public clients cannot use client_credentials")
+		}
+		accessToken, err := signJwt(request.key, request.claims(client, nil, map[string]any{
+			"sub":       client.ClientId,
+			"aud":       client.ClientId,
+			"client_id": client.ClientId,
+			"scope":     c.FormValue("scope"),
+		}))
+		if err != nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   request.provider.Settings.TokenLifetime,
+			"scope":        c.FormValue("scope"),
+		})
+	}
+	return oidcError(c, fiber.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or client_credentials")
+}
+
+func exchangeOidcAuthorizationCode(c *fiber.Ctx, request oidcRequest, client *models.OidcClient) error {
+	oidcAuthorizationCodes.Lock()
+	code, found := oidcAuthorizationCodes.codes[c.FormValue("code")]
+	// a code is used once, even when the exchange fails
+	delete(oidcAuthorizationCodes.codes, c.FormValue("code"))
+	oidcAuthorizationCodes.Unlock()
+
+	if !found || time.Now().After(code.expiresAt) || code.workspaceId != request.provider.Workspace || code.clientId != client.ClientId {
+		return oidcError(c, fiber.StatusBadRequest, "invalid_grant", "the code is unknown, expired, or issued to another client")
+	}
+	if code.redirectUri != c.FormValue("redirect_uri") {
+		return oidcError(c, fiber.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if code.codeChallenge != "" {
+		verifier := c.FormValue("code_verifier")
+		if code.codeChallengeMethod == "S256" {
+			hash := sha256.Sum256([]byte(verifier))
+			verifier = base64.RawURLEncoding.EncodeToString(hash[:])
+		}
+		if verifier == "" || subtle.ConstantTimeCompare([]byte(verifier), []byte(code.codeChallenge)) != 1 {
+			return oidcError(c, fiber.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+		}
+	}
+	user := request.findUser(code.subject)
+	if user == nil {
+		return oidcError(c, fiber.StatusBadRequest, "invalid_grant", fmt.Sprintf("user [%s] does not exist anymore", code.subject))
+	}
+
+	accessToken, err := signJwt(request.key, request.claims(client, user, map[string]any{
+		"sub":       user.Subject,
+		"aud":       client.ClientId,
+		"client_id": client.ClientId,
+		"scope":     code.scope,
+	}))
+	if err != nil {
+		return err
+	}
+	response := fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   request.provider.Settings.TokenLifetime,
+		"scope":        code.scope,
+	}
+	if slices.Contains(strings.Fields(code.scope), "openid") {
+		idTokenClaims := map[string]any{
+			"sub":       user.Subject,
+			"aud":       client.ClientId,
+			"auth_time": time.Now().Unix(),
+		}
+		if code.nonce != "" {
+			idTokenClaims["nonce"] = code.nonce
+		}
+		if response["id_token"], err = signJwt(request.key, request.claims(client, user, idTokenClaims)); err != nil {
+			return err
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func getOidcUserinfo(c *fiber.Ctx, request oidcRequest) error {
+	accessToken, found := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !found {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oidcError(c, fiber.StatusUnauthorized, "invalid_token", "a Bearer access token is required")
+	}
+	claims, err := verifyJwt(accessToken, func(jwtHeader) (any, error) { return &request.key.PublicKey, nil })
+	if err == nil && claims["iss"] != request.issuer {
+		err = errors.New("the token is issued by another issuer")
+	}
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oidcError(c, fiber.StatusUnauthorized, "invalid_token", err.Error())
+	}
+
+	subject, _ := claims["sub"].(string)
+	user := request.findUser(subject)
+	if subject == "" || user == nil {
+		return oidcError(c, fiber.StatusUnauthorized, "invalid_token", "the token is not issued to a user")
+	}
+	userinfo := maps.Clone(user.Claims)
+	if userinfo == nil {
+		userinfo = make(map[string]any)
+	}
+	userinfo["sub"] = user.Subject
+	return c.Status(fiber.StatusOK).JSON(userinfo)
+}
+
+// getOidcSettings returns the settings of the stub provider of an oidc workspace, without the client secrets below the editor role.
+func getOidcSettings(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	if workspace.Type != models.OidcWorkspace {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] is not an oidc workspace", workspace.Id),
+		})
+	}
+	provider, _, err := getOidcProvider(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	settings := provider.Settings
+	if !hasRole(c, models.RoleEditor) {
+		settings.Clients = slices.Clone(settings.Clients)
+		for i := range settings.Clients {
+			settings.Clients[i].ClientSecret = ""
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
+
+// setOidcSettings replaces the clients, users, and claims of the stub provider, its signing key is kept.
+func setOidcSettings(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	if workspace.Type != models.OidcWorkspace {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] is not an oidc workspace", workspace.Id),
+		})
+	}
+	var settings models.OidcSettings
+	if err := c.BodyParser(&settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if err := settings.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	provider, _, err := getOidcProvider(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	provider.Settings = settings
+	if err := database.Store.SaveOidcProvider(c.Context(), *provider); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(provider.Settings)
+}
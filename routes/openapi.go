@@ -0,0 +1,220 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"moksarab/database"
+	"moksarab/models"
+	"slices"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetOpenapiDocumentRequest gives the OpenAPI 3 document as JSON or YAML, and how the requests are validated against it.
+type SetOpenapiDocumentRequest struct {
+	Document string `json:"document"`
+	// Validation is strict or lenient (default)
+	Validation string `json:"validation"`
+}
+
+type OpenapiDocumentResponse struct {
+	models.OpenapiDocument
+	// Schemas are the names of the component schemas, the responses can $ref them as #/components/schemas/<name>
+	Schemas []string `json:"schemas"`
+	// BrokenResponses are the responses generated from a schema that the document can't generate anymore
+	BrokenResponses []BrokenSchemaResponse `json:"broken_responses,omitempty"`
+}
+
+// BrokenSchemaResponse is a response generated from a schema whose $ref don't resolve in the new document.
+type BrokenSchemaResponse struct {
+	ResponseId int64  `json:"response_id"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Message    string `json:"message"`
+}
+
+// openapiDocuments caches the parsed OpenAPI document of each workspace with the document it was parsed from,
+// so it is parsed again when another instance sharing the database replaces it.
+var openapiDocuments = struct {
+	sync.Mutex
+	documents map[int64]cachedOpenapiDocument
+}{documents: make(map[int64]cachedOpenapiDocument)}
+
+type cachedOpenapiDocument struct {
+	raw    string
+	parsed *openapi3.T
+	// paths are the path templates of the document compiled once, at the root and under the path of each server
+	paths []openapiPath
+}
+
+func newCachedOpenapiDocument(raw string, parsed *openapi3.T) cachedOpenapiDocument {
+	return cachedOpenapiDocument{raw: raw, parsed: parsed, paths: compileOpenapiPaths(parsed)}
+}
+
+func setOpenapiDocument(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody SetOpenapiDocumentRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if reqBody.Validation == "" {
+		reqBody.Validation = models.LenientValidation
+	}
+	var parsed *openapi3.T
+	err := errors.New("document is required")
+	if reqBody.Validation != models.StrictValidation && reqBody.Validation != models.LenientValidation {
+		err = fmt.Errorf("validation must be %s or %s", models.StrictValidation, models.LenientValidation)
+	} else if reqBody.Document != "" {
+		parsed, err = parseOpenapiDocument(c.Context(), reqBody.Document)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	broken, err := getBrokenSchemaResponses(c.Context(), workspace.Id, parsed)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	document := models.OpenapiDocument{Workspace: workspace.Id, Document: reqBody.Document, Validation: reqBody.Validation}
+	if err := database.Store.SaveOpenapiDocument(c.Context(), document); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	openapiDocuments.Lock()
+	openapiDocuments.documents[workspace.Id] = newCachedOpenapiDocument(document.Document, parsed)
+	openapiDocuments.Unlock()
+	return c.Status(fiber.StatusOK).JSON(OpenapiDocumentResponse{OpenapiDocument: document, Schemas: getComponentSchemas(parsed), BrokenResponses: broken})
+}
+
+func getOpenapiDocument(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	document, err := database.Store.GetOpenapiDocument(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if document == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no OpenAPI document", workspace.Id),
+		})
+	}
+	cached, err := getCachedOpenapiDocument(c.Context(), *document)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(OpenapiDocumentResponse{OpenapiDocument: *document, Schemas: getComponentSchemas(cached.parsed)})
+}
+
+// deleteOpenapiDocument answers with the responses generated from a schema that are broken without the document, if any.
+func deleteOpenapiDocument(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	broken, err := getBrokenSchemaResponses(c.Context(), workspace.Id, nil)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	deleted, err := database.Store.DeleteOpenapiDocument(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	openapiDocuments.Lock()
+	delete(openapiDocuments.documents, workspace.Id)
+	openapiDocuments.Unlock()
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%d] has no OpenAPI document", workspace.Id),
+		})
+	}
+	if len(broken) > 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"broken_responses": broken})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// parseOpenapiDocument loads and validates the document, its $ref can only point inside of it.
+func parseOpenapiDocument(ctx context.Context, document string) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	parsed, err := loader.LoadFromData([]byte(document))
+	if err != nil {
+		return nil, fmt.Errorf("document is not a valid OpenAPI 3 document: %w", err)
+	}
+	if err := parsed.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("document is not a valid OpenAPI 3 document: %w", err)
+	}
+	return parsed, nil
+}
+
+// loadOpenapiDocument returns nil when the workspace has no OpenAPI document.
+func loadOpenapiDocument(ctx context.Context, workspaceId int64) (*openapi3.T, error) {
+	document, err := database.Store.GetOpenapiDocument(ctx, workspaceId)
+	if err != nil || document == nil {
+		return nil, err
+	}
+	cached, err := getCachedOpenapiDocument(ctx, *document)
+	if err != nil {
+		return nil, err
+	}
+	return cached.parsed, nil
+}
+
+// getCachedOpenapiDocument parses the stored document of the workspace, unless it is cached already.
+func getCachedOpenapiDocument(ctx context.Context, document models.OpenapiDocument) (cachedOpenapiDocument, error) {
+	openapiDocuments.Lock()
+	cached, found := openapiDocuments.documents[document.Workspace]
+	openapiDocuments.Unlock()
+	if found && cached.raw == document.Document {
+		return cached, nil
+	}
+
+	parsed, err := parseOpenapiDocument(ctx, document.Document)
+	if err != nil {
+		return cachedOpenapiDocument{}, err
+	}
+	cached = newCachedOpenapiDocument(document.Document, parsed)
+	openapiDocuments.Lock()
+	openapiDocuments.documents[document.Workspace] = cached
+	openapiDocuments.Unlock()
+	return cached, nil
+}
+
+// getBrokenSchemaResponses finds the responses of the workspace generated from a schema that can't be generated with the document.
+func getBrokenSchemaResponses(ctx context.Context, workspaceId int64, document *openapi3.T) ([]BrokenSchemaResponse, error) {
+	mocks, err := database.Store.GetMocks(ctx, int(workspaceId))
+	if err != nil {
+		return nil, err
+	}
+	var broken []BrokenSchemaResponse
+	for _, mock := range mocks {
+		if mock.Schema == nil {
+			continue
+		}
+		if _, err := generateSchemaBody(document, mock.Schema, mock.Seed); err != nil {
+			broken = append(broken, BrokenSchemaResponse{ResponseId: mock.ResponseId, Method: mock.Method, Path: mock.FullPath, Message: err.Error()})
+		}
+	}
+	return broken, nil
+}
+
+func getComponentSchemas(document *openapi3.T) []string {
+	if document.Components == nil {
+		return []string{}
+	}
+	return slices.Sorted(maps.Keys(document.Components.Schemas))
+}
@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+const requestViolationsLocal = "requestViolations"
+
+var pathTemplateParam = regexp.MustCompile(`\{([^}/]+)\}`)
+
+// validateOpenapiRequest validates the request against its operation in the OpenAPI document of the workspace, if any.
+// The violations are recorded in the journal, and the request is answered with them in strict mode.
+func validateOpenapiRequest(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	document, err := database.Store.GetOpenapiDocument(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	if document == nil {
+		return false, nil
+	}
+	cached, err := getCachedOpenapiDocument(c.Context(), *document)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+	}
+	route, pathParams := findOpenapiRoute(cached, c.Method(), trimmedPath)
+	if route == nil {
+		return false, nil
+	}
+
+	request, err := adaptor.ConvertRequest(c, true)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+	}
+	err = openapi3filter.ValidateRequest(c.Context(), &openapi3filter.RequestValidationInput{
+		Request:    request,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:          true,
+			SkipSettingDefaults: true,
+			// the workspace has its own access token, the security schemes of the document are not checked
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	violations := getRequestViolations(err, models.RequestViolation{})
+	if len(violations) == 0 {
+		return false, nil
+	}
+	c.Locals(requestViolationsLocal, violations)
+	if document.Validation != models.StrictValidation {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":      "Bad Request",
+		"message":    fmt.Sprintf("request does not match the operation %s %s of the OpenAPI document", route.Method, route.Path),
+		"violations": violations,
+	})
+}
+
+// openapiPath is a path template of the document compiled to a regexp, whose {params} are one segment or part of one.
+type openapiPath struct {
+	template string
+	pattern  *regexp.Regexp
+	params   []string
+}
+
+// compileOpenapiPaths compiles the path templates of the document, at the root and under the path of each of its servers.
+func compileOpenapiPaths(document *openapi3.T) []openapiPath {
+	basePaths := []string{""}
+	for _, server := range document.Servers {
+		if serverUrl, err := url.Parse(server.URL); err == nil && strings.Trim(serverUrl.Path, "/") != "" {
+			basePaths = append(basePaths, "/"+strings.Trim(serverUrl.Path, "/"))
+		}
+	}
+
+	var paths []openapiPath
+	for _, template := range document.Paths.InMatchingOrder() {
+		for _, basePath := range basePaths {
+			path := openapiPath{template: template}
+			var pattern strings.Builder
+			pattern.WriteString("^")
+			last := 0
+			fullTemplate := basePath + template
+			for _, match := range pathTemplateParam.FindAllStringSubmatchIndex(fullTemplate, -1) {
+				pattern.WriteString(regexp.QuoteMeta(fullTemplate[last:match[0]]))
+				pattern.WriteString("([^/]+)")
+				path.params = append(path.params, fullTemplate[match[2]:match[3]])
+				last = match[1]
+			}
+			pattern.WriteString(regexp.QuoteMeta(fullTemplate[last:]))
+			pattern.WriteString("/?$")
+			path.pattern = regexp.MustCompile(pattern.String())
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// findOpenapiRoute finds the operation of the path among the compiled paths of the document.
+// The path with the fewest params wins when several match, e.g. /users/me over /users/{id}.
+func findOpenapiRoute(document cachedOpenapiDocument, method string, path string) (*routers.Route, map[string]string) {
+	var found *routers.Route
+	var foundParams map[string]string
+	for _, candidate := range document.paths {
+		pathItem := document.parsed.Paths.Value(candidate.template)
+		operation := pathItem.GetOperation(method)
+		if operation == nil {
+			continue
+		}
+		matches := candidate.pattern.FindStringSubmatch(path)
+		if matches == nil || (found != nil && (len(candidate.params) > len(foundParams) || (len(candidate.params) == len(foundParams) && candidate.template > found.Path))) {
+			continue
+		}
+		params := make(map[string]string, len(candidate.params))
+		for i, name := range candidate.params {
+			params[name] = matches[i+1]
+			if unescaped, err := url.PathUnescape(matches[i+1]); err == nil {
+				params[name] = unescaped
+			}
+		}
+		found = &routers.Route{Spec: document.parsed, Path: candidate.template, PathItem: pathItem, Method: method, Operation: operation}
+		foundParams = params
+	}
+	return found, foundParams
+}
+
+// getRequestViolations flattens the errors of the validation, with where they are in the request.
+func getRequestViolations(err error, violation models.RequestViolation) []models.RequestViolation {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case openapi3.MultiError:
+		var violations []models.RequestViolation
+		for _, err := range err {
+			violations = append(violations, getRequestViolations(err, violation)...)
+		}
+		return violations
+	case *openapi3filter.RequestError:
+		if err.Parameter != nil {
+			violation.In, violation.Name = err.Parameter.In, err.Parameter.Name
+		} else {
+			violation.In = "body"
+		}
+		switch err.Err.(type) {
+		case openapi3.MultiError, *openapi3.SchemaError:
+			return getRequestViolations(err.Err, violation)
+		}
+		violation.Message = err.Reason
+		if err.Err != nil && (violation.Message == "" || violation.Message == err.Err.Error()) {
+			violation.Message = err.Err.Error()
+		} else if err.Err != nil {
+			violation.Message += ": " + err.Err.Error()
+		}
+		return []models.RequestViolation{violation}
+	case *openapi3.SchemaError:
+		if pointer := err.JSONPointer(); len(pointer) > 0 && violation.In == "body" {
+			violation.Name = "/" + strings.Join(pointer, "/")
+		}
+		violation.Message = err.Reason
+		if violation.Message == "" {
+			violation.Message = err.Error()
+		}
+		return []models.RequestViolation{violation}
+	default:
+		violation.Message = err.Error()
+		return []models.RequestViolation{violation}
+	}
+}
@@ -0,0 +1,456 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const defaultResourceIdField = "id"
+
+type CreateResourceRequest struct {
+	Path    string           `json:"path"`
+	IdField string           `json:"id_field"`
+	State   string           `json:"state"`
+	Seed    models.JsonValue `json:"seed"`
+}
+
+// seededResources are the resources whose state is memory that have their seed in memory since the start.
+var seededResources = struct {
+	sync.Mutex
+	ids map[int64]bool
+}{ids: make(map[int64]bool)}
+
+func createResource(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateResourceRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if reqBody.IdField == "" {
+		reqBody.IdField = defaultResourceIdField
+	}
+	if reqBody.State == "" {
+		reqBody.State = models.MemoryResourceState
+	}
+	resource := models.Resource{
+		Workspace: workspace.Id,
+		Path:      reqBody.Path,
+		IdField:   reqBody.IdField,
+		State:     reqBody.State,
+		Seed:      reqBody.Seed,
+	}
+	seed, err := validateResource(resource)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if resource.Id, err = database.Store.CreateResource(c.Context(), resource); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if err := resetResource(c.Context(), resource, seed); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": resource.Id})
+}
+
+// validateResource makes sure the seed is an array of objects with distinct ids, returning its items.
+func validateResource(resource models.Resource) ([]models.ResourceItem, error) {
+	if !isValidPath(resource.Path) || strings.Contains(resource.Path, ":") || strings.Contains(resource.Path, "*") || resource.Path == "/" {
+		return nil, fmt.Errorf("path [%s] must be a path without params", resource.Path)
+	}
+	if resource.State != models.MemoryResourceState && resource.State != models.DatabaseResourceState {
+		return nil, fmt.Errorf("state must be %s or %s", models.MemoryResourceState, models.DatabaseResourceState)
+	}
+	return seedItems(resource)
+}
+
+func seedItems(resource models.Resource) ([]models.ResourceItem, error) {
+	var seed []models.JsonObject
+	if resource.Seed != nil {
+		if err := json.Unmarshal(resource.Seed, &seed); err != nil {
+			return nil, errors.New("seed must be an array of objects")
+		}
+	}
+	items := []models.ResourceItem{}
+	for _, data := range seed {
+		if data == nil {
+			return nil, errors.New("seed must be an array of objects")
+		}
+		if _, found := data[resource.IdField]; !found {
+			data[resource.IdField] = nextResourceItemId(items)
+		}
+		itemId, ok := resourceItemId(data[resource.IdField])
+		if !ok {
+			return nil, fmt.Errorf("%s of the seed items must be a string or a number", resource.IdField)
+		}
+		if slices.ContainsFunc(items, func(item models.ResourceItem) bool { return item.ItemId == itemId }) {
+			return nil, fmt.Errorf("seed has more than one item with %s [%s]", resource.IdField, itemId)
+		}
+		items = append(items, models.ResourceItem{Resource: resource.Id, ItemId: itemId, Data: data})
+	}
+	return items, nil
+}
+
+// resourceItemId is the value of the id field as a string, which must be a non empty string or a number.
+func resourceItemId(value any) (string, bool) {
+	switch id := value.(type) {
+	case string:
+		return id, id != ""
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(id, 10), true
+	}
+	return "", false
+}
+
+// nextResourceItemId follows the greatest id when they are all integers, or is a random UUID.
+func nextResourceItemId(items []models.ResourceItem) any {
+	var greatest int64
+	for _, item := range items {
+		id, err := strconv.ParseInt(item.ItemId, 10, 64)
+		if err != nil {
+			return uuid.NewString()
+		}
+		greatest = max(greatest, id)
+	}
+	return greatest + 1
+}
+
+// resourceItems is where the items of the resource are kept, the ones in memory are seeded on their first use since the start.
+// The seeding holds the lock, so the concurrent first requests seed the items once.
+func resourceItems(ctx context.Context, resource models.Resource) (database.ResourceItemStore, error) {
+	if resource.State != models.MemoryResourceState {
+		return database.Store, nil
+	}
+	seededResources.Lock()
+	defer seededResources.Unlock()
+
+	if !seededResources.ids[resource.Id] {
+		seed, err := seedItems(resource)
+		if err != nil {
+			return nil, err
+		}
+		if err := resetMemoryResource(ctx, resource, seed); err != nil {
+			return nil, err
+		}
+	}
+	return database.MemoryResourceItems, nil
+}
+
+func resetResource(ctx context.Context, resource models.Resource, seed []models.ResourceItem) error {
+	if resource.State == models.DatabaseResourceState {
+		for i := range seed {
+			seed[i].Resource = resource.Id
+		}
+		return database.Store.ResetResourceItems(ctx, resource.Id, seed)
+	}
+	seededResources.Lock()
+	defer seededResources.Unlock()
+	return resetMemoryResource(ctx, resource, seed)
+}
+
+// resetMemoryResource replaces the items kept in memory by the seed, seededResources must be locked.
+func resetMemoryResource(ctx context.Context, resource models.Resource, seed []models.ResourceItem) error {
+	for i := range seed {
+		seed[i].Resource = resource.Id
+	}
+	seededResources.ids[resource.Id] = true
+	return database.MemoryResourceItems.ResetResourceItems(ctx, resource.Id, seed)
+}
+
+func getResources(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	resources, err := database.Store.GetResources(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(resources)
+}
+
+// findResource finds the resource of the :resourceId param in the workspace, it answers the request and returns nil when there is none.
+func findResource(c *fiber.Ctx) (*models.Resource, error) {
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	resourceId, err := strconv.ParseInt(c.Params("resourceId"), 10, 64)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "resourceId must be a number",
+		})
+	}
+	resources, err := database.Store.GetResources(c.Context(), workspace.Id)
+	if err != nil {
+		return nil, HandleSQLErrors(c, err)
+	}
+	i := slices.IndexFunc(resources, func(resource models.Resource) bool { return resource.Id == resourceId })
+	if i < 0 {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("resource [%d] is not found", resourceId),
+		})
+	}
+	return &resources[i], nil
+}
+
+func deleteResource(c *fiber.Ctx) error {
+
+	resource, err := findResource(c)
+	if resource == nil {
+		return err
+	}
+	if _, err := database.Store.DeleteResource(c.Context(), resource.Workspace, resource.Id); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	seededResources.Lock()
+	delete(seededResources.ids, resource.Id)
+	seededResources.Unlock()
+	if err := database.MemoryResourceItems.ResetResourceItems(c.Context(), resource.Id, nil); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// resetResourceItems restores the seed of the resource, dropping every change made to its items.
+func resetResourceItems(c *fiber.Ctx) error {
+
+	resource, err := findResource(c)
+	if resource == nil {
+		return err
+	}
+	seed, err := seedItems(*resource)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+	}
+	if err := resetResource(c.Context(), *resource, seed); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// serveResourceMocks serves the list, get, create, update, patch, and delete of the items of the resource at the path,
+// it returns false when the path is neither the path of a resource nor the path of one of its items.
+func serveResourceMocks(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	resources, err := database.Store.GetResources(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+
+	var resource *models.Resource
+	var itemId string
+	for i := range resources {
+		if trimmedPath == resources[i].Path {
+			resource = &resources[i]
+			break
+		}
+		if rest, found := strings.CutPrefix(trimmedPath, resources[i].Path+"/"); found && rest != "" && !strings.Contains(rest, "/") {
+			// the id outlives the request when the item is stored in memory
+			resource, itemId = &resources[i], strings.Clone(rest)
+			break
+		}
+	}
+	if resource == nil {
+		return false, nil
+	}
+
+	items, err := resourceItems(c.Context(), *resource)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	switch {
+	case itemId == "" && c.Method() == fiber.MethodGet:
+		return true, listResourceItems(c, items, *resource)
+	case itemId == "" && c.Method() == fiber.MethodPost:
+		return true, createResourceItem(c, items, *resource)
+	case itemId != "" && c.Method() == fiber.MethodGet:
+		return true, getResourceItem(c, items, *resource, itemId)
+	case itemId != "" && (c.Method() == fiber.MethodPut || c.Method() == fiber.MethodPatch):
+		return true, updateResourceItem(c, items, *resource, itemId)
+	case itemId != "" && c.Method() == fiber.MethodDelete:
+		return true, deleteResourceItem(c, items, *resource, itemId)
+	}
+
+	allowed := "GET, PUT, PATCH, DELETE"
+	if itemId == "" {
+		allowed = "GET, POST"
+	}
+	c.Set(fiber.HeaderAllow, allowed)
+	return true, c.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{
+		"error":   "Method Not Allowed",
+		"message": fmt.Sprintf("resource [%s] only allows %s on this path", resource.Path, allowed),
+	})
+}
+
+func listResourceItems(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource) error {
+	pageNumber := c.QueryInt("page", 0)
+	pageSize := c.QueryInt("size", 10)
+	if pageNumber < 0 || pageSize < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "Page must be grater than 0 and size must be grater than 1",
+		})
+	}
+
+	all, err := items.GetResourceItems(c.Context(), resource.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	content := []models.JsonObject{}
+	for _, item := range all[min(pageNumber*pageSize, len(all)):min((pageNumber+1)*pageSize, len(all))] {
+		content = append(content, item.Data)
+	}
+	return c.Status(fiber.StatusOK).JSON(models.PageOf(content, pageNumber, pageSize, len(all)))
+}
+
+func findResourceItem(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource, itemId string) (*models.ResourceItem, error) {
+	all, err := items.GetResourceItems(c.Context(), resource.Id)
+	if err != nil {
+		return nil, HandleSQLErrors(c, err)
+	}
+	i := slices.IndexFunc(all, func(item models.ResourceItem) bool { return item.ItemId == itemId })
+	if i < 0 {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("item [%s] of resource [%s] is not found", itemId, resource.Path),
+		})
+	}
+	return &all[i], nil
+}
+
+func getResourceItem(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource, itemId string) error {
+	item, err := findResourceItem(c, items, resource, itemId)
+	if item == nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(item.Data)
+}
+
+func parseResourceItem(c *fiber.Ctx) (models.JsonObject, error) {
+	var data models.JsonObject
+	if err := json.Unmarshal(c.Body(), &data); err != nil || data == nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "the body must be a JSON object",
+		})
+	}
+	return data, nil
+}
+
+func createResourceItem(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource) error {
+	data, err := parseResourceItem(c)
+	if data == nil {
+		return err
+	}
+	if _, found := data[resource.IdField]; !found {
+		all, err := items.GetResourceItems(c.Context(), resource.Id)
+		if err != nil {
+			return HandleSQLErrors(c, err)
+		}
+		data[resource.IdField] = nextResourceItemId(all)
+	}
+	itemId, ok := resourceItemId(data[resource.IdField])
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("%s must be a string or a number", resource.IdField),
+		})
+	}
+	if err := items.CreateResourceItem(c.Context(), models.ResourceItem{Resource: resource.Id, ItemId: itemId, Data: data}); err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(data)
+}
+
+// updateResourceItem replaces the item on PUT, and applies the body as a JSON merge patch on PATCH, the id never changes.
+func updateResourceItem(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource, itemId string) error {
+	item, err := findResourceItem(c, items, resource, itemId)
+	if item == nil {
+		return err
+	}
+	data, err := parseResourceItem(c)
+	if data == nil {
+		return err
+	}
+	if value, found := data[resource.IdField]; found {
+		if id, _ := resourceItemId(value); id != itemId {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Bad Request",
+				"message": fmt.Sprintf("%s cannot be changed", resource.IdField),
+			})
+		}
+	}
+
+	if c.Method() == fiber.MethodPatch {
+		data = mergePatch(item.Data, data)
+	}
+	data[resource.IdField] = item.Data[resource.IdField]
+	updated, err := items.UpdateResourceItem(c.Context(), models.ResourceItem{Resource: resource.Id, ItemId: itemId, Data: data})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !updated {
+		// deleted in the meantime
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("item [%s] of resource [%s] is not found", itemId, resource.Path),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(data)
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396): null removes a field, and objects are merged recursively.
+func mergePatch(target map[string]any, patch map[string]any) map[string]any {
+	merged := make(map[string]any, len(target))
+	for key, value := range target {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		patchObject, isObject := value.(map[string]any)
+		switch {
+		case value == nil:
+			delete(merged, key)
+		case isObject:
+			targetObject, _ := merged[key].(map[string]any)
+			merged[key] = mergePatch(targetObject, patchObject)
+		default:
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+func deleteResourceItem(c *fiber.Ctx, items database.ResourceItemStore, resource models.Resource, itemId string) error {
+	deleted, err := items.DeleteResourceItem(c.Context(), resource.Id, itemId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("item [%s] of resource [%s] is not found", itemId, resource.Path),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
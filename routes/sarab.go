@@ -1,86 +1,233 @@
 package routes
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"fmt"
 	"moksarab/config"
 	"moksarab/database"
+	"moksarab/models"
+	"net"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 )
 
-/*
-SELECT rr.status, rr.response, rr.path_params,
-	COALESCE('/:' || r0.param_name, r0.path) || COALESCE('/:' || r1.param_name, r1.path) AS full_path -- loop over paths in original order
-FROM route_response rr
-	-- loop over paths in reverse order
-	JOIN route r1 ON r1.id = rr.path AND (r1.path = '/1' OR r1.is_param = 1)
-	JOIN route r0 ON r0.id = r1.parent_path AND (r0.path = '/test' OR r0.is_param = 1)
-WHERE rr.method = 'GET'
-	AND r1.workspace = 4269
-ORDER BY rr.path_params IS NULL, rr.path_params;
-*/
+const (
+	wildcardSegment = "/*"
+	catchAllSegment = "/**"
+)
+
+// segmentKind orders route segments by specificity, the lower the more specific.
+type segmentKind int
+
+const (
+	literalKind segmentKind = iota
+	constrainedParamKind
+	paramKind
+	wildcardKind
+	catchAllKind
+)
+
+// namedParamConstraints are the constraints that can be used by name, e.g. `/:id<uuid>`
+var namedParamConstraints = map[string]string{
+	"int":   `\d+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+var compiledParamConstraints sync.Map
 
 type SarabResponse struct {
-	Status    int            `json:"status"`
-	Response  sql.NullString `json:"response"`
-	PathParam sql.NullString `json:"path_param"`
-	FullPath  string         `json:"full_path"`
+	Status    int               `json:"status"`
+	Response  sql.NullString    `json:"response"`
+	PathParam models.PathParams `json:"path_param"`
+	FullPath  string            `json:"full_path"`
 }
 
 func HandleSarabRequests(c *fiber.Ctx) error {
-	workspaceId := 4269
+	workspace, err := findWorkspace(c)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if workspace == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("workspace [%s] is not found", c.Params("workspace")),
+		})
+	}
+
+	trimmedPath := strings.TrimPrefix(c.Path(), "/sarab")
 	if config.WorkspaceEnabled {
-		var err error
-		if workspaceId, err = c.ParamsInt("workspaceId", -1); err != nil || workspaceId == -1 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "workspaceId must be valid integer",
-			})
+		trimmedPath = strings.TrimPrefix(trimmedPath, "/"+c.Params("workspace"))
+	}
+	return serveWorkspaceMocks(c, workspace, trimmedPath)
+}
+
+// HandleHostRequests serves the requests to a host mapped to a workspace by the workspace mocks, at the root of the host.
+// The requests to any other host go on to the next handlers.
+func HandleHostRequests(c *fiber.Ctx) error {
+	host := strings.ToLower(c.Hostname())
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	workspace, err := database.Store.GetWorkspaceByHost(c.Context(), host)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if workspace == nil {
+		return c.Next()
+	}
+	return serveWorkspaceMocks(c, workspace, c.Path())
+}
+
+// serveWorkspaceMocks responds with the most specific mock response of the workspace matching the path.
+func serveWorkspaceMocks(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) error {
+	defer recordHttpRequest(c, workspace, trimmedPath)
+	workspaceId := int(workspace.Id)
+	if workspace.AccessTokenHash.Valid && !isValidAccessToken(c, workspace.AccessTokenHash.String) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Unauthorized",
+			"message": "this workspace requires its access token in the X-Sarab-Token header or the sarab_token query param",
+		})
+	}
+	if handled, err := validateOpenapiRequest(c, workspace, trimmedPath); handled {
+		return err
+	}
+
+	if workspace.Type == models.OidcWorkspace {
+		if handled, err := serveOidcEndpoint(c, workspace, trimmedPath); handled {
+			return err
 		}
 	}
-	re := regexp.MustCompile(`^/sarab/\d+`)
-	trimmedPath := re.ReplaceAllString(c.Path(), "")
+	if handled, err := serveWebsocketMock(c, workspace, trimmedPath); handled {
+		return err
+	}
+	if handled, err := serveSoapMocks(c, workspace, trimmedPath); handled {
+		return err
+	}
+	if handled, err := serveGraphqlMocks(c, workspace, trimmedPath); handled {
+		return err
+	}
+	if handled, err := serveResourceMocks(c, workspace, trimmedPath); handled {
+		return err
+	}
+
 	pathParts := getPathParts(trimmedPath)
-	slices.Reverse(pathParts)
-
-	query := fmt.Sprintf(`
-			SELECT rr.status, rr.response, rr.path_params,
-				%s
-			FROM route_response rr
-				%s
-			WHERE rr.method = ?
-				AND r0.workspace = ?
-			ORDER BY rr.path_params IS NULL, rr.path_params
-			`, getFullPathSelector(len(pathParts)), getJoins(pathParts),
-	)
-
-	rows, err := database.Db.QueryContext(
-		c.Context(),
-		query,
-		c.Method(),
-		workspaceId,
-	)
+
+	routesById, err := database.Store.GetRoutes(c.Context(), workspaceId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+
+	routeResponses, err := database.Store.GetRouteResponses(c.Context(), workspaceId, c.Method())
 	if err != nil {
 		return HandleSQLErrors(c, err)
 	}
 
-	for rows.Next() {
-		var response SarabResponse
-		rows.Scan(&response.Status, &response.Response, &response.PathParam, &response.FullPath)
-		mapPathParamsToFullPath(&response)
+	// the responses whose route matches the path, before the matchers pick one of them
+	type candidate struct {
+		routeResponse models.RouteResponse
+		response      SarabResponse
+		specificity   []segmentKind
+		params        map[string]string
+	}
+	var candidates []candidate
+	var candidatesSpecificity []segmentKind
+	for _, routeResponse := range routeResponses {
+		chain := getRouteChain(routesById, routeResponse.Path)
+		response := SarabResponse{
+			Status:    routeResponse.Status,
+			Response:  routeResponse.Response,
+			PathParam: routeResponse.PathParams,
+			FullPath:  getChainFullPath(chain),
+		}
 		log.Debugf("trying to match [%s] with found response: %+v", trimmedPath, response)
-		if trimmedPath == response.FullPath || !response.PathParam.Valid {
-			rows.Close()
-			if response.Response.Valid {
-				return c.Status(response.Status).SendString(response.Response.String)
+
+		params, specificity, ok := matchRouteChain(chain, pathParts)
+		if !ok || !pathParamsMatch(response.PathParam, params) {
+			continue
+		}
+		if candidates == nil || slices.Compare(specificity, candidatesSpecificity) < 0 {
+			candidatesSpecificity = specificity
+		}
+		candidates = append(candidates, candidate{routeResponse, response, specificity, params})
+	}
+
+	// the most specific route with jwt matchers requires a token valid for one of them, whatever response would be picked
+	token := newBearerJwt(c)
+	var candidatesMatchers []models.Matchers
+	for _, candidate := range candidates {
+		if slices.Equal(candidate.specificity, candidatesSpecificity) {
+			candidatesMatchers = append(candidatesMatchers, candidate.routeResponse.Matchers)
+		}
+	}
+	if err := token.validate(c, candidatesMatchers); err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Unauthorized",
+			"message": err.Error(),
+		})
+	}
+
+	var matched *SarabResponse
+	var matchedSpecificity []segmentKind
+	var matchedResponse models.RouteResponse
+	var matchedParams map[string]string
+	for _, candidate := range candidates {
+		if !matchersMatch(c, token, candidate.routeResponse.Matchers) {
+			continue
+		}
+		// responses with path params come first, so only a strictly more specific route may replace the current match,
+		// or on the same route one as specific to the path params but with more matchers
+		comparison := slices.Compare(candidate.specificity, matchedSpecificity)
+		if matched == nil || comparison < 0 ||
+			(comparison == 0 && (candidate.routeResponse.PathParams == nil) == (matchedResponse.PathParams == nil) && len(candidate.routeResponse.Matchers) > len(matchedResponse.Matchers)) {
+			matched = &candidate.response
+			matchedSpecificity = candidate.specificity
+			matchedResponse = candidate.routeResponse
+			matchedParams = candidate.params
+		}
+	}
+
+	if matched != nil {
+		if err := fireCallbacks(c, workspace, matchedResponse.Id, matchedParams, trimmedPath); err != nil {
+			return HandleSQLErrors(c, err)
+		}
+		if !matchedResponse.Stream.IsZero() {
+			return sendStream(c, matched.Status, matchedResponse.Stream)
+		}
+		if matchedResponse.Schema != nil {
+			body, err := generateSchemaResponse(c.Context(), workspace.Id, matchedResponse.Schema, matchedResponse.Seed)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   "Internal Server Error",
+					"message": fmt.Sprintf("response [%d] could not be generated from its schema: %v", matchedResponse.Id, err),
+				})
+			}
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Status(matched.Status).Send(body)
+		}
+		if matched.Response.Valid && matchedResponse.Templated {
+			body, err := renderTemplatedResponse(matched.Response.String, matchedResponse.Seed)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   "Internal Server Error",
+					"message": fmt.Sprintf("response [%d] could not be rendered: %v", matchedResponse.Id, err),
+				})
 			}
-			return c.SendStatus(response.Status)
+			return c.Status(matched.Status).SendString(body)
 		}
+		if matched.Response.Valid {
+			return c.Status(matched.Status).SendString(matched.Response.String)
+		}
+		return c.SendStatus(matched.Status)
 	}
 
 	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -89,50 +236,131 @@ func HandleSarabRequests(c *fiber.Ctx) error {
 	})
 }
 
-func getFullPathSelector(partsLength int) string {
-	selector := ""
-	for i := range partsLength {
-		selector = selector + fmt.Sprintf("COALESCE('/:' || r%d.param_name, r%d.path) ", i, i)
-		if i+1 != partsLength {
-			selector = selector + " || "
+func isValidAccessToken(c *fiber.Ctx, accessTokenHash string) bool {
+	accessToken := c.Get("X-Sarab-Token")
+	if accessToken == "" {
+		accessToken = c.Query("sarab_token")
+	}
+	return accessTokenMatches(accessToken, accessTokenHash)
+}
+
+func accessTokenMatches(accessToken string, accessTokenHash string) bool {
+	return accessToken != "" && subtle.ConstantTimeCompare([]byte(hashSecret(accessToken)), []byte(accessTokenHash)) == 1
+}
+
+// getRouteChain climbs up parent_path from the given route and returns the segments from root to leaf.
+func getRouteChain(routesById map[int64]models.Route, routeId int64) []models.Route {
+	var chain []models.Route
+	for id := (sql.NullInt64{Int64: routeId, Valid: true}); id.Valid; {
+		route, found := routesById[id.Int64]
+		if !found {
+			break
 		}
+		chain = append(chain, route)
+		id = route.ParentPath
 	}
-	return selector + " AS full_path "
+	slices.Reverse(chain)
+	return chain
 }
 
-func getJoins(pathParts []string) string {
-	lastPartIndex := len(pathParts) - 1
-	joins := fmt.Sprintf(" JOIN route r%d ON r%d.id = rr.path AND (r%d.path = '%s' OR r%d.is_param = 1)\n",
-		lastPartIndex,
-		lastPartIndex,
-		lastPartIndex,
-		pathParts[0],
-		lastPartIndex,
-	)
-
-	for i := 1; i < len(pathParts); i++ {
-		thisPartIndex := lastPartIndex - i
-		joins += fmt.Sprintf(" JOIN route r%d ON r%d.id = r%d.parent_path AND (r%d.path = '%s' OR r%d.is_param = 1)\n",
-			thisPartIndex,
-			thisPartIndex,
-			thisPartIndex+1,
-			thisPartIndex,
-			pathParts[i],
-			thisPartIndex,
-		)
-	}
-
-	return joins
+func getChainFullPath(chain []models.Route) string {
+	var fullPath strings.Builder
+	for _, route := range chain {
+		if route.IsParam {
+			fullPath.WriteString("/:" + route.ParamName.String + route.ParamConstraint.String)
+		} else {
+			fullPath.WriteString(route.Path)
+		}
+	}
+	return fullPath.String()
 }
 
-func mapPathParamsToFullPath(response *SarabResponse) {
+func getSegmentKind(route models.Route) segmentKind {
+	switch {
+	case route.IsParam && route.ParamConstraint.Valid:
+		return constrainedParamKind
+	case route.IsParam:
+		return paramKind
+	case route.Path == wildcardSegment:
+		return wildcardKind
+	case route.Path == catchAllSegment:
+		return catchAllKind
+	default:
+		return literalKind
+	}
+}
 
-	if response.PathParam.Valid {
-		for part := range strings.SplitSeq(response.PathParam.String, ", ") {
-			kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
-			if len(kv) == 2 {
-				response.FullPath = strings.ReplaceAll(response.FullPath, ":"+strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+// matchRouteChain matches the request path parts against the route segments, returning the bound
+// path params and the kind of each matched segment to rank the match by its specificity.
+func matchRouteChain(chain []models.Route, pathParts []string) (map[string]string, []segmentKind, bool) {
+	params := make(map[string]string)
+	specificity := make([]segmentKind, 0, len(chain))
+	for i, route := range chain {
+		kind := getSegmentKind(route)
+		specificity = append(specificity, kind)
+		if kind == catchAllKind {
+			return params, specificity, true
+		}
+		if i >= len(pathParts) {
+			return nil, nil, false
+		}
+		switch kind {
+		case literalKind:
+			if route.Path != pathParts[i] {
+				return nil, nil, false
 			}
+		case constrainedParamKind, paramKind:
+			value := strings.TrimPrefix(pathParts[i], "/")
+			if route.ParamConstraint.Valid {
+				constraint, err := compileParamConstraint(route.ParamConstraint.String)
+				if err != nil || !constraint.MatchString(value) {
+					return nil, nil, false
+				}
+			}
+			params[route.ParamName.String] = value
+		}
+	}
+	return params, specificity, len(chain) == len(pathParts)
+}
+
+func pathParamsMatch(pathParams models.PathParams, params map[string]string) bool {
+	for name, expected := range pathParams {
+		if value, bound := params[name]; !bound || value != expected {
+			return false
 		}
 	}
+	return true
+}
+
+// compileParamConstraint compiles a param constraint, either a regex `(\d+)` or a named one `<uuid>`,
+// so that it has to match the whole segment value.
+func compileParamConstraint(constraint string) (*regexp.Regexp, error) {
+	if compiled, found := compiledParamConstraints.Load(constraint); found {
+		return compiled.(*regexp.Regexp), nil
+	}
+
+	var expression string
+	switch {
+	case strings.HasPrefix(constraint, "<") && strings.HasSuffix(constraint, ">"):
+		named, found := namedParamConstraints[strings.Trim(constraint, "<>")]
+		if !found {
+			return nil, fmt.Errorf("unknown param constraint %s", constraint)
+		}
+		expression = named
+	case strings.HasPrefix(constraint, "(") && strings.HasSuffix(constraint, ")"):
+		// the outer parens must be one group, e.g. not `(\d+)|(x)`, or the anchors would only apply to a part of it
+		expression = constraint[1 : len(constraint)-1]
+		if _, err := regexp.Compile(expression); err != nil {
+			return nil, fmt.Errorf("invalid param constraint %s: %w", constraint, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid param constraint %s", constraint)
+	}
+
+	compiled, err := regexp.Compile("^(?:" + expression + ")$")
+	if err != nil {
+		return nil, err
+	}
+	compiledParamConstraints.Store(constraint, compiled)
+	return compiled, nil
 }
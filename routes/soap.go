@@ -0,0 +1,335 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"moksarab/database"
+	"moksarab/models"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/gofiber/fiber/v2"
+)
+
+// the namespaces of the SOAP 1.1 and 1.2 envelopes
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// soapPrefix is the prefix of the envelope namespace in the XPaths of the mocks, whichever the SOAP version of the request.
+const soapPrefix = "soap"
+
+// soapFaultCodes are the fault codes by their SOAP 1.1 and 1.2 names.
+var soapFaultCodes = map[string][2]string{
+	"Client":          {"Client", "Sender"},
+	"Sender":          {"Client", "Sender"},
+	"Server":          {"Server", "Receiver"},
+	"Receiver":        {"Server", "Receiver"},
+	"VersionMismatch": {"VersionMismatch", "VersionMismatch"},
+	"MustUnderstand":  {"MustUnderstand", "MustUnderstand"},
+}
+
+type CreateSoapMockRequest struct {
+	Path       string              `json:"path"`
+	Action     string              `json:"action"`
+	XPaths     models.XPathMatches `json:"xpaths"`
+	Namespaces models.StringMap    `json:"namespaces"`
+	Status     int                 `json:"status"`
+	Body       string              `json:"body"`
+	Fault      models.SoapFault    `json:"fault"`
+}
+
+func createSoapMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateSoapMockRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if reqBody.Status == 0 {
+		reqBody.Status = fiber.StatusOK
+		if !reqBody.Fault.IsZero() {
+			reqBody.Status = fiber.StatusInternalServerError
+		}
+	}
+	if err := validateSoapMock(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	id, err := database.Store.CreateSoapMock(c.Context(), models.SoapMock{
+		Workspace:  workspace.Id,
+		Path:       reqBody.Path,
+		Action:     reqBody.Action,
+		XPaths:     reqBody.XPaths,
+		Namespaces: reqBody.Namespaces,
+		Status:     reqBody.Status,
+		Body:       reqBody.Body,
+		Fault:      reqBody.Fault,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": id})
+}
+
+func validateSoapMock(mock CreateSoapMockRequest) error {
+	if !isValidPath(mock.Path) || strings.Contains(mock.Path, ":") || strings.Contains(mock.Path, "*") {
+		return fmt.Errorf("path [%s] must be a path without params", mock.Path)
+	}
+	if !isValidHttpResponseStatus(mock.Status) {
+		return fmt.Errorf("status [%d] must be valid", mock.Status)
+	}
+	if _, found := mock.Namespaces[soapPrefix]; found {
+		return fmt.Errorf("namespace prefix [%s] is reserved for the envelope namespace of the requests", soapPrefix)
+	}
+	namespaces := soapXPathNamespaces(mock.Namespaces, soap11Namespace)
+	for _, match := range mock.XPaths {
+		if _, err := xpath.CompileWithNS(match.Expression, namespaces); err != nil {
+			return fmt.Errorf("xpath [%s] is invalid: %w", match.Expression, err)
+		}
+	}
+	if mock.Fault.IsZero() {
+		if err := validateXmlFragment(mock.Body); err != nil {
+			return fmt.Errorf("body must be XML: %w", err)
+		}
+		return nil
+	}
+	if mock.Body != "" {
+		return errors.New("either body or fault must be given, not both")
+	}
+	if mock.Fault.Reason == "" {
+		return errors.New("fault reason is required")
+	}
+	if _, found := soapFaultCodes[mock.Fault.Code]; mock.Fault.Code != "" && !found {
+		return fmt.Errorf("fault code [%s] must be Client, Server, Sender, Receiver, VersionMismatch or MustUnderstand", mock.Fault.Code)
+	}
+	if err := validateXmlFragment(mock.Fault.Detail); err != nil {
+		return fmt.Errorf("fault detail must be XML: %w", err)
+	}
+	return nil
+}
+
+// validateXmlFragment makes sure the content of an element, such as the soap:Body, is well-formed.
+func validateXmlFragment(fragment string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func getSoapMocks(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mocks, err := database.Store.GetSoapMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(mocks)
+}
+
+func deleteSoapMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mockId, err := strconv.ParseInt(c.Params("mockId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "mockId must be a number",
+		})
+	}
+	deleted, err := database.Store.DeleteSoapMock(c.Context(), workspace.Id, mockId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("SOAP mock [%d] is not found", mockId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// serveSoapMocks answers the envelopes posted to the path of a SOAP mock of the workspace with the most specific mock,
+// or with a fault when none of them matches. It returns false for any other request, so the mocks are tried.
+func serveSoapMocks(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	if c.Method() != fiber.MethodPost {
+		return false, nil
+	}
+
+	mocks, err := database.Store.GetSoapMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	onPath := false
+	for _, mock := range mocks {
+		onPath = onPath || mock.Path == trimmedPath
+	}
+	if !onPath {
+		return false, nil
+	}
+
+	envelope, namespace, err := parseSoapEnvelope(c.Body())
+	if err != nil {
+		return true, sendSoapFault(c, soap11Namespace, fiber.StatusBadRequest, models.SoapFault{Code: "Client", Reason: err.Error()})
+	}
+	action := getSoapAction(c)
+
+	// the mock with the most criteria wins, the first one created on a tie
+	var matched *models.SoapMock
+	matchedCriteria := -1
+	for i, mock := range mocks {
+		if mock.Path != trimmedPath || (mock.Action != "" && mock.Action != action) {
+			continue
+		}
+		criteria := len(mock.XPaths)
+		if mock.Action != "" {
+			criteria++
+		}
+		if criteria > matchedCriteria && soapXPathsMatch(envelope, namespace, mock) {
+			matched, matchedCriteria = &mocks[i], criteria
+		}
+	}
+	if matched == nil {
+		return true, sendSoapFault(c, namespace, fiber.StatusInternalServerError, models.SoapFault{
+			Code:   "Client",
+			Reason: fmt.Sprintf("no SOAP mock matches the SOAPAction [%s] and the envelope", action),
+		})
+	}
+	if !matched.Fault.IsZero() {
+		return true, sendSoapFault(c, namespace, matched.Status, matched.Fault)
+	}
+	c.Set(fiber.HeaderContentType, soapContentType(namespace))
+	return true, c.Status(matched.Status).SendString(soapEnvelope(namespace, matched.Body))
+}
+
+// parseSoapEnvelope parses a SOAP 1.1 or 1.2 envelope, returning its namespace.
+func parseSoapEnvelope(body []byte) (*xmlquery.Node, string, error) {
+	document, err := xmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("the request is not XML: %w", err)
+	}
+	root := xmlquery.FindOne(document, "/*")
+	if root == nil || root.Data != "Envelope" || (root.NamespaceURI != soap11Namespace && root.NamespaceURI != soap12Namespace) {
+		return nil, "", errors.New("the request is not a SOAP envelope")
+	}
+	return document, root.NamespaceURI, nil
+}
+
+// getSoapAction is the SOAPAction header of SOAP 1.1, or the action param of the SOAP 1.2 content type.
+func getSoapAction(c *fiber.Ctx) string {
+	if action := c.Get("SOAPAction"); action != "" {
+		return strings.Trim(action, `"`)
+	}
+	if _, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType)); err == nil {
+		return params["action"]
+	}
+	return ""
+}
+
+func soapXPathNamespaces(namespaces models.StringMap, envelopeNamespace string) map[string]string {
+	all := map[string]string{soapPrefix: envelopeNamespace}
+	for prefix, uri := range namespaces {
+		all[prefix] = uri
+	}
+	return all
+}
+
+func soapXPathsMatch(envelope *xmlquery.Node, envelopeNamespace string, mock models.SoapMock) bool {
+	namespaces := soapXPathNamespaces(mock.Namespaces, envelopeNamespace)
+	for _, match := range mock.XPaths {
+		expression, err := xpath.CompileWithNS(match.Expression, namespaces)
+		if err != nil || !xpathMatches(expression.Evaluate(xmlquery.CreateXPathNavigator(envelope)), match.Equals) {
+			return false
+		}
+	}
+	return true
+}
+
+// xpathMatches tells if an XPath result has any node, or is true, or when equals is given, if a node or the result is equals.
+func xpathMatches(result any, equals string) bool {
+	switch value := result.(type) {
+	case *xpath.NodeIterator:
+		for value.MoveNext() {
+			if equals == "" || strings.TrimSpace(value.Current().Value()) == equals {
+				return true
+			}
+		}
+		return false
+	case bool:
+		if equals == "" {
+			return value
+		}
+		return strconv.FormatBool(value) == equals
+	case float64:
+		if equals == "" {
+			return value != 0
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64) == equals
+	case string:
+		if equals == "" {
+			return value != ""
+		}
+		return value == equals
+	}
+	return false
+}
+
+func soapContentType(envelopeNamespace string) string {
+	if envelopeNamespace == soap12Namespace {
+		return "application/soap+xml; charset=utf-8"
+	}
+	return "text/xml; charset=utf-8"
+}
+
+func soapEnvelope(envelopeNamespace string, body string) string {
+	return xml.Header + `<soap:Envelope xmlns:soap="` + envelopeNamespace + `"><soap:Body>` + body + `</soap:Body></soap:Envelope>`
+}
+
+// sendSoapFault answers with the fault in the SOAP version of the request, Server or Receiver when it has no code.
+func sendSoapFault(c *fiber.Ctx, envelopeNamespace string, status int, fault models.SoapFault) error {
+	version := 0
+	if envelopeNamespace == soap12Namespace {
+		version = 1
+	}
+	code := soapFaultCodes["Server"][version]
+	if names, found := soapFaultCodes[fault.Code]; found {
+		code = names[version]
+	}
+	var reason strings.Builder
+	xml.EscapeText(&reason, []byte(fault.Reason))
+
+	var body string
+	if version == 0 {
+		body = "<soap:Fault><faultcode>soap:" + code + "</faultcode><faultstring>" + reason.String() + "</faultstring>"
+		if fault.Detail != "" {
+			body += "<detail>" + fault.Detail + "</detail>"
+		}
+	} else {
+		body = "<soap:Fault><soap:Code><soap:Value>soap:" + code + "</soap:Value></soap:Code>" +
+			`<soap:Reason><soap:Text xml:lang="en">` + reason.String() + "</soap:Text></soap:Reason>"
+		if fault.Detail != "" {
+			body += "<soap:Detail>" + fault.Detail + "</soap:Detail>"
+		}
+	}
+	c.Set(fiber.HeaderContentType, soapContentType(envelopeNamespace))
+	return c.Status(status).SendString(soapEnvelope(envelopeNamespace, body+"</soap:Fault>"))
+}
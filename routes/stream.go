@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"bufio"
+	"errors"
+	"moksarab/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func validateStream(stream models.ResponseStream, hasBody bool) error {
+	if stream.IsZero() {
+		return nil
+	}
+	if hasBody {
+		return errors.New("a response is either a body or a stream")
+	}
+	return stream.Validate()
+}
+
+// sendStream writes the chunks of the stream as they are due, flushing each one so the client gets it right away.
+func sendStream(c *fiber.Ctx, status int, stream models.ResponseStream) error {
+	if stream.Type == models.SseStream {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	} else if stream.ContentType != "" {
+		c.Set(fiber.HeaderContentType, stream.ContentType)
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	}
+
+	c.Status(status).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for _, chunk := range stream.Chunks {
+			time.Sleep(time.Duration(chunk.DelayMs) * time.Millisecond)
+			if stream.Type == models.SseStream {
+				writeSseEvent(w, chunk)
+			} else {
+				w.WriteString(chunk.Data)
+			}
+			// the client is gone
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// writeSseEvent writes the chunk as an event, with a data line for every line of its data.
+func writeSseEvent(w *bufio.Writer, chunk models.StreamChunk) {
+	if chunk.Id != "" {
+		w.WriteString("id: " + chunk.Id + "\n")
+	}
+	if chunk.Event != "" {
+		w.WriteString("event: " + chunk.Event + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(chunk.Data, "\r\n", "\n"), "\n") {
+		w.WriteString("data: " + line + "\n")
+	}
+	w.WriteString("\n")
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"moksarab/certs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getTlsCa returns the PEM of the generated CA, for the clients to trust the HTTPS certificate.
+func getTlsCa(c *fiber.Ctx) error {
+	caPem := certs.GeneratedCaPem()
+	if len(caPem) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": "there is no generated CA, HTTPS is either disabled or uses a supplied certificate",
+		})
+	}
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Send(caPem)
+}
@@ -0,0 +1,271 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreateWebsocketMockRequest struct {
+	Path    string                  `json:"path"`
+	Steps   []models.WebsocketStep  `json:"steps"`
+	Replies []models.WebsocketReply `json:"replies"`
+}
+
+// websocketConnections numbers the WebSocket connections, to group their frames in the journal.
+var websocketConnections atomic.Int64
+
+func createWebsocketMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody CreateWebsocketMockRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	if !isValidPath(reqBody.Path) || strings.Contains(reqBody.Path, ":") || strings.Contains(reqBody.Path, "*") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("path [%s] must be a path without params", reqBody.Path),
+		})
+	}
+	script := models.WebsocketScript{Steps: reqBody.Steps, Replies: reqBody.Replies}
+	if err := script.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	id, err := database.Store.CreateWebsocketMock(c.Context(), models.WebsocketMock{
+		Workspace: workspace.Id,
+		Path:      reqBody.Path,
+		Script:    script,
+	})
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": id})
+}
+
+func getWebsocketMocks(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mocks, err := database.Store.GetWebsocketMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(mocks)
+}
+
+func deleteWebsocketMock(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	mockId, err := strconv.ParseInt(c.Params("mockId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": "mockId must be a number",
+		})
+	}
+	deleted, err := database.Store.DeleteWebsocketMock(c.Context(), workspace.Id, mockId)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("WebSocket mock [%d] is not found", mockId),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// serveWebsocketMock upgrades the WebSocket requests to the path of a WebSocket mock of the workspace and runs its script,
+// it returns false for any other request.
+func serveWebsocketMock(c *fiber.Ctx, workspace *models.Workspace, trimmedPath string) (bool, error) {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return false, nil
+	}
+
+	mocks, err := database.Store.GetWebsocketMocks(c.Context(), workspace.Id)
+	if err != nil {
+		return true, HandleSQLErrors(c, err)
+	}
+	index := slices.IndexFunc(mocks, func(mock models.WebsocketMock) bool { return mock.Path == trimmedPath })
+	if index < 0 {
+		return false, nil
+	}
+
+	session := websocketSession{
+		mock:       mocks[index],
+		connection: strconv.FormatInt(websocketConnections.Add(1), 10),
+	}
+	return true, websocket.New(session.run)(c)
+}
+
+// websocketSession runs the script of a WebSocket mock on one connection.
+type websocketSession struct {
+	mock       models.WebsocketMock
+	connection string
+	conn       *websocket.Conn
+	// inbound are the client messages, closed once the client closes or the connection breaks
+	inbound chan string
+}
+
+func (session *websocketSession) run(conn *websocket.Conn) {
+	session.conn = conn
+	session.inbound = make(chan string)
+	go session.read()
+	// the reader must be done with the connection before it is released
+	defer func() {
+		conn.Close()
+		for range session.inbound {
+		}
+	}()
+
+	for _, step := range session.mock.Script.Steps {
+		switch step.Type {
+		case models.SendStep:
+			if _, open := session.wait(time.Duration(step.DelayMs)*time.Millisecond, nil); !open {
+				return
+			}
+			if session.send(step.Message) != nil {
+				return
+			}
+		case models.ExpectStep:
+			timeout := forever
+			if step.TimeoutMs > 0 {
+				timeout = time.Duration(step.TimeoutMs) * time.Millisecond
+			}
+			matched, open := session.wait(timeout, step.Match)
+			if !open {
+				return
+			}
+			if !matched {
+				session.close(websocket.ClosePolicyViolation, "expected message not received")
+				return
+			}
+		case models.CloseStep:
+			if _, open := session.wait(time.Duration(step.DelayMs)*time.Millisecond, nil); !open {
+				return
+			}
+			code := step.Code
+			if code == 0 {
+				code = websocket.CloseNormalClosure
+			}
+			session.close(code, step.Reason)
+			return
+		}
+	}
+	// the replies keep answering until the client closes
+	session.wait(forever, nil)
+}
+
+// read records the client messages and passes them on to the script, until the connection is closed.
+func (session *websocketSession) read() {
+	defer close(session.inbound)
+	for {
+		_, message, err := session.conn.ReadMessage()
+		if err != nil {
+			var closeError *fastws.CloseError
+			if errors.As(err, &closeError) {
+				session.record("in", closeError.Text, closeError.Code)
+			}
+			return
+		}
+		session.record("in", string(message), 0)
+		session.inbound <- string(message)
+	}
+}
+
+// forever is the timeout of wait that never times out.
+const forever time.Duration = -1
+
+// wait answers the client messages by the replies for timeout, or until a message matches expect.
+// It returns whether a message matched, and false for open once the client is gone.
+func (session *websocketSession) wait(timeout time.Duration, expect *models.MessageMatch) (matched bool, open bool) {
+	var timer <-chan time.Time
+	if timeout != forever {
+		timer = time.After(timeout)
+	}
+	for {
+		select {
+		case message, ok := <-session.inbound:
+			if !ok {
+				return false, false
+			}
+			if expect != nil && expect.Matches(message) {
+				return true, true
+			}
+			if session.reply(message) != nil {
+				return false, false
+			}
+		case <-timer:
+			return false, true
+		}
+	}
+}
+
+// reply answers the message by the first reply matching it, if any.
+func (session *websocketSession) reply(message string) error {
+	for _, reply := range session.mock.Script.Replies {
+		if reply.Match.Matches(message) {
+			time.Sleep(time.Duration(reply.DelayMs) * time.Millisecond)
+			return session.send(reply.Message)
+		}
+	}
+	return nil
+}
+
+func (session *websocketSession) send(message string) error {
+	if err := session.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		return err
+	}
+	session.record("out", message, 0)
+	return nil
+}
+
+// close sends the close frame and waits a moment for the client to close too.
+func (session *websocketSession) close(code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	if session.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline) != nil {
+		return
+	}
+	session.record("out", reason, code)
+	for {
+		select {
+		case _, ok := <-session.inbound:
+			if !ok {
+				return
+			}
+		case <-time.After(time.Until(deadline)):
+			return
+		}
+	}
+}
+
+func (session *websocketSession) record(direction string, message string, closeCode int) {
+	recordJournalEntry(models.JournalEntry{
+		Workspace:  session.mock.Workspace,
+		Protocol:   "websocket",
+		Path:       session.mock.Path,
+		Connection: session.connection,
+		Direction:  direction,
+		Message:    message,
+		CloseCode:  closeCode,
+	})
+}
@@ -0,0 +1,458 @@
+package routes
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"moksarab/database"
+	"moksarab/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// the namespaces of the SOAP 1.1 and 1.2 bindings of a WSDL 1.1 document
+const (
+	wsdlSoap11Namespace = "http://schemas.xmlsoap.org/wsdl/soap/"
+	wsdlSoap12Namespace = "http://schemas.xmlsoap.org/wsdl/soap12/"
+)
+
+// xsdMaxDepth stops the samples of recursive types.
+const xsdMaxDepth = 8
+
+// xsdSampleValues are the sample values of the built-in XML Schema types.
+var xsdSampleValues = map[string]string{
+	"boolean":            "false",
+	"int":                "0",
+	"integer":            "0",
+	"long":               "0",
+	"short":              "0",
+	"byte":               "0",
+	"decimal":            "0",
+	"unsignedInt":        "0",
+	"unsignedLong":       "0",
+	"unsignedShort":      "0",
+	"unsignedByte":       "0",
+	"nonNegativeInteger": "0",
+	"positiveInteger":    "1",
+	"double":             "0.0",
+	"float":              "0.0",
+	"dateTime":           "2024-01-01T00:00:00Z",
+	"date":               "2024-01-01",
+	"time":               "00:00:00",
+	"base64Binary":       "",
+}
+
+type ImportWsdlRequest struct {
+	// Path is the path the operations are mocked on
+	Path string `json:"path"`
+	Wsdl string `json:"wsdl"`
+}
+
+// WsdlOperation is an operation scaffolded from a WSDL, with a sample of its request envelope.
+type WsdlOperation struct {
+	Name    string `json:"name"`
+	Action  string `json:"action,omitempty"`
+	MockId  int64  `json:"mock_id"`
+	Request string `json:"request"`
+}
+
+type wsdlDefinitions struct {
+	XMLName         xml.Name       `xml:"definitions"`
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Schemas         []xsdSchema    `xml:"types>schema"`
+	Messages        []wsdlMessage  `xml:"message"`
+	PortTypes       []wsdlPortType `xml:"portType"`
+	Bindings        []wsdlBinding  `xml:"binding"`
+}
+
+type wsdlMessage struct {
+	Name  string `xml:"name,attr"`
+	Parts []struct {
+		Name    string `xml:"name,attr"`
+		Element string `xml:"element,attr"`
+		Type    string `xml:"type,attr"`
+	} `xml:"part"`
+}
+
+type wsdlPortType struct {
+	Name       string `xml:"name,attr"`
+	Operations []struct {
+		Name  string `xml:"name,attr"`
+		Input struct {
+			Message string `xml:"message,attr"`
+		} `xml:"input"`
+		Output struct {
+			Message string `xml:"message,attr"`
+		} `xml:"output"`
+	} `xml:"operation"`
+}
+
+type wsdlBinding struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+	Soap struct {
+		XMLName xml.Name
+		Style   string `xml:"style,attr"`
+	} `xml:"binding"`
+	Operations []struct {
+		Name string `xml:"name,attr"`
+		Soap struct {
+			Action string `xml:"soapAction,attr"`
+			Style  string `xml:"style,attr"`
+		} `xml:"operation"`
+		Input struct {
+			Body struct {
+				Namespace string `xml:"namespace,attr"`
+			} `xml:"body"`
+		} `xml:"input"`
+	} `xml:"operation"`
+}
+
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Elements           []xsdElement     `xml:"element"`
+	ComplexTypes       []xsdComplexType `xml:"complexType"`
+	SimpleTypes        []xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	Form        string          `xml:"form,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+	SimpleType  *xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdComplexType struct {
+	Name      string       `xml:"name,attr"`
+	Sequence  []xsdElement `xml:"sequence>element"`
+	All       []xsdElement `xml:"all>element"`
+	Choice    []xsdElement `xml:"choice>element"`
+	Extension *struct {
+		Base     string       `xml:"base,attr"`
+		Sequence []xsdElement `xml:"sequence>element"`
+	} `xml:"complexContent>extension"`
+}
+
+type xsdSimpleType struct {
+	Name        string `xml:"name,attr"`
+	Restriction struct {
+		Base         string `xml:"base,attr"`
+		Enumerations []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"enumeration"`
+	} `xml:"restriction"`
+}
+
+// xsdSampler writes sample XML of the elements and types of the schemas, looked up by their local names.
+type xsdSampler struct {
+	elements     map[string]xsdElement
+	complexTypes map[string]xsdComplexType
+	simpleTypes  map[string]xsdSimpleType
+	// schemas are the schemas declaring the elements and types, for their namespace
+	schemas map[string]*xsdSchema
+}
+
+func newXsdSampler(schemas []xsdSchema) *xsdSampler {
+	sampler := &xsdSampler{
+		elements:     make(map[string]xsdElement),
+		complexTypes: make(map[string]xsdComplexType),
+		simpleTypes:  make(map[string]xsdSimpleType),
+		schemas:      make(map[string]*xsdSchema),
+	}
+	for i := range schemas {
+		schema := &schemas[i]
+		for _, element := range schema.Elements {
+			sampler.elements[element.Name] = element
+			sampler.schemas["element:"+element.Name] = schema
+		}
+		for _, complexType := range schema.ComplexTypes {
+			sampler.complexTypes[complexType.Name] = complexType
+			sampler.schemas["type:"+complexType.Name] = schema
+		}
+		for _, simpleType := range schema.SimpleTypes {
+			sampler.simpleTypes[simpleType.Name] = simpleType
+		}
+	}
+	return sampler
+}
+
+// localName is the name of a QName attribute without its prefix, e.g. GetOrder for tns:GetOrder.
+func localName(qname string) string {
+	return qname[strings.LastIndex(qname, ":")+1:]
+}
+
+// writeGlobalElement writes a sample of a top level element, returning its namespace.
+func (sampler *xsdSampler) writeGlobalElement(builder *strings.Builder, name string, parentNamespace string) (string, error) {
+	element, found := sampler.elements[localName(name)]
+	if !found {
+		return "", fmt.Errorf("element [%s] is not in the types of the WSDL", name)
+	}
+	namespace := sampler.schemas["element:"+element.Name].TargetNamespace
+	sampler.writeElement(builder, element, namespace, parentNamespace, 0)
+	return namespace, nil
+}
+
+// writeElement writes the element in its namespace, declared as the default namespace when it isn't the one of its parent.
+func (sampler *xsdSampler) writeElement(builder *strings.Builder, element xsdElement, namespace string, parentNamespace string, depth int) {
+	if depth > xsdMaxDepth {
+		return
+	}
+	builder.WriteString("<" + element.Name)
+	if namespace != parentNamespace {
+		builder.WriteString(` xmlns="`)
+		xml.EscapeText(builder, []byte(namespace))
+		builder.WriteString(`"`)
+	}
+	builder.WriteString(">")
+
+	switch {
+	case element.ComplexType != nil:
+		sampler.writeComplexType(builder, *element.ComplexType, namespace, depth)
+	case element.SimpleType != nil:
+		builder.WriteString(sampler.simpleValue(*element.SimpleType))
+	default:
+		sampler.writeType(builder, element.Type, namespace, depth)
+	}
+	builder.WriteString("</" + element.Name + ">")
+}
+
+func (sampler *xsdSampler) writeType(builder *strings.Builder, typeName string, namespace string, depth int) {
+	name := localName(typeName)
+	if complexType, found := sampler.complexTypes[name]; found {
+		sampler.writeComplexType(builder, complexType, namespace, depth)
+		return
+	}
+	if simpleType, found := sampler.simpleTypes[name]; found {
+		builder.WriteString(sampler.simpleValue(simpleType))
+		return
+	}
+	if value, found := xsdSampleValues[name]; found {
+		builder.WriteString(value)
+		return
+	}
+	builder.WriteString("?")
+}
+
+func (sampler *xsdSampler) simpleValue(simpleType xsdSimpleType) string {
+	if len(simpleType.Restriction.Enumerations) > 0 {
+		var value strings.Builder
+		xml.EscapeText(&value, []byte(simpleType.Restriction.Enumerations[0].Value))
+		return value.String()
+	}
+	if value, found := xsdSampleValues[localName(simpleType.Restriction.Base)]; found {
+		return value
+	}
+	return "?"
+}
+
+// writeComplexType writes the children of the type, only the first one of a choice.
+func (sampler *xsdSampler) writeComplexType(builder *strings.Builder, complexType xsdComplexType, namespace string, depth int) {
+	var children []xsdElement
+	if complexType.Extension != nil {
+		if base, found := sampler.complexTypes[localName(complexType.Extension.Base)]; found {
+			sampler.writeComplexType(builder, base, namespace, depth+1)
+		}
+		children = append(children, complexType.Extension.Sequence...)
+	}
+	children = append(children, complexType.Sequence...)
+	children = append(children, complexType.All...)
+	if len(complexType.Choice) > 0 {
+		children = append(children, complexType.Choice[0])
+	}
+
+	schema := sampler.schemas["type:"+complexType.Name]
+	for _, child := range children {
+		if child.Ref != "" {
+			sampler.writeGlobalElement(builder, child.Ref, namespace)
+			continue
+		}
+		qualified := child.Form == "qualified"
+		if child.Form == "" && schema != nil {
+			qualified = schema.ElementFormDefault == "qualified"
+		} else if child.Form == "" {
+			qualified = namespace != "" && sampler.qualifiedNamespace(namespace)
+		}
+		childNamespace := ""
+		if qualified && schema != nil {
+			childNamespace = schema.TargetNamespace
+		} else if qualified {
+			childNamespace = namespace
+		}
+		sampler.writeElement(builder, child, childNamespace, namespace, depth+1)
+	}
+}
+
+// qualifiedNamespace tells if the local elements of the schema of the namespace are qualified, for the anonymous types.
+func (sampler *xsdSampler) qualifiedNamespace(namespace string) bool {
+	for _, schema := range sampler.schemas {
+		if schema.TargetNamespace == namespace {
+			return schema.ElementFormDefault == "qualified"
+		}
+	}
+	return false
+}
+
+// importWsdl scaffolds a SOAP mock answering a sample response for each operation of the SOAP bindings of a WSDL 1.1 document,
+// returning the operations with a sample of their request envelope. The mocks replace those imported before at the path with the same action,
+// the hand-written ones are kept.
+func importWsdl(c *fiber.Ctx) error {
+
+	workspace := c.Locals(workspaceLocal).(*models.Workspace)
+	var reqBody ImportWsdlRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+	if !isValidPath(reqBody.Path) || strings.Contains(reqBody.Path, ":") || strings.Contains(reqBody.Path, "*") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("path [%s] must be a path without params", reqBody.Path),
+		})
+	}
+
+	var definitions wsdlDefinitions
+	if err := xml.Unmarshal([]byte(reqBody.Wsdl), &definitions); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": fmt.Sprintf("wsdl must be a WSDL 1.1 document: %v", err),
+		})
+	}
+	mocks, requests, err := scaffoldWsdlOperations(definitions, reqBody.Path)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+
+	ids, err := database.Store.ReplaceSoapMocks(c.Context(), workspace.Id, mocks)
+	if err != nil {
+		return HandleSQLErrors(c, err)
+	}
+	operations := make([]WsdlOperation, len(mocks))
+	for i, mock := range mocks {
+		operations[i] = WsdlOperation{Name: requests[i].name, Action: mock.Action, MockId: ids[i], Request: requests[i].envelope}
+	}
+	return c.Status(fiber.StatusCreated).JSON(operations)
+}
+
+type wsdlRequest struct {
+	name     string
+	envelope string
+}
+
+// scaffoldWsdlOperations builds the mocks of the operations, matched by their SOAPAction and the element of their request,
+// the first binding of an operation wins.
+func scaffoldWsdlOperations(definitions wsdlDefinitions, path string) ([]models.SoapMock, []wsdlRequest, error) {
+	sampler := newXsdSampler(definitions.Schemas)
+	messages := make(map[string]wsdlMessage)
+	for _, message := range definitions.Messages {
+		messages[message.Name] = message
+	}
+
+	var mocks []models.SoapMock
+	var requests []wsdlRequest
+	scaffolded := make(map[string]bool)
+	for _, binding := range definitions.Bindings {
+		envelopeNamespace := soap11Namespace
+		switch binding.Soap.XMLName.Space {
+		case wsdlSoap11Namespace:
+		case wsdlSoap12Namespace:
+			envelopeNamespace = soap12Namespace
+		default:
+			continue
+		}
+		var portType *wsdlPortType
+		for i := range definitions.PortTypes {
+			if definitions.PortTypes[i].Name == localName(binding.Type) {
+				portType = &definitions.PortTypes[i]
+			}
+		}
+		if portType == nil {
+			return nil, nil, fmt.Errorf("port type [%s] of binding [%s] is not found", binding.Type, binding.Name)
+		}
+
+		for _, operation := range binding.Operations {
+			if scaffolded[operation.Name] {
+				continue
+			}
+			scaffolded[operation.Name] = true
+			style := operation.Soap.Style
+			if style == "" {
+				style = binding.Soap.Style
+			}
+			rpcNamespace := operation.Input.Body.Namespace
+			if rpcNamespace == "" {
+				rpcNamespace = definitions.TargetNamespace
+			}
+
+			for _, abstract := range portType.Operations {
+				if abstract.Name != operation.Name {
+					continue
+				}
+				var request, response strings.Builder
+				requestNamespace, requestElement, err := writeWsdlMessage(&request, sampler, messages[localName(abstract.Input.Message)], style, abstract.Name, rpcNamespace)
+				if err != nil {
+					return nil, nil, fmt.Errorf("operation [%s]: %w", abstract.Name, err)
+				}
+				if abstract.Output.Message != "" {
+					if _, _, err := writeWsdlMessage(&response, sampler, messages[localName(abstract.Output.Message)], style, abstract.Name+"Response", rpcNamespace); err != nil {
+						return nil, nil, fmt.Errorf("operation [%s]: %w", abstract.Name, err)
+					}
+				}
+
+				mock := models.SoapMock{Path: path, Action: operation.Soap.Action, Status: fiber.StatusOK, Body: response.String()}
+				if requestElement != "" {
+					expression := "/soap:Envelope/soap:Body/" + requestElement
+					if requestNamespace != "" {
+						expression = "/soap:Envelope/soap:Body/tns:" + requestElement
+						mock.Namespaces = models.StringMap{"tns": requestNamespace}
+					}
+					mock.XPaths = models.XPathMatches{{Expression: expression}}
+				}
+				mocks = append(mocks, mock)
+				requests = append(requests, wsdlRequest{name: abstract.Name, envelope: soapEnvelope(envelopeNamespace, request.String())})
+			}
+		}
+	}
+	if len(mocks) == 0 {
+		return nil, nil, errors.New("wsdl has no operation bound to SOAP")
+	}
+	return mocks, requests, nil
+}
+
+// writeWsdlMessage writes a sample of the content of the soap:Body of the message, returning the namespace and name of its element.
+// The parts of a document message are elements, while the parts of an rpc message are wrapped in an element named after the operation.
+func writeWsdlMessage(builder *strings.Builder, sampler *xsdSampler, message wsdlMessage, style string, wrapper string, rpcNamespace string) (string, string, error) {
+	if style == "rpc" {
+		builder.WriteString("<" + wrapper + ` xmlns="`)
+		xml.EscapeText(builder, []byte(rpcNamespace))
+		builder.WriteString(`">`)
+		for _, part := range message.Parts {
+			sampler.writeElement(builder, xsdElement{Name: part.Name, Type: part.Type}, "", rpcNamespace, 0)
+		}
+		builder.WriteString("</" + wrapper + ">")
+		return rpcNamespace, wrapper, nil
+	}
+
+	var namespace, element string
+	for i, part := range message.Parts {
+		if part.Element == "" {
+			return "", "", fmt.Errorf("part [%s] of a document message must be an element", part.Name)
+		}
+		partNamespace, err := sampler.writeGlobalElement(builder, part.Element, "")
+		if err != nil {
+			return "", "", err
+		}
+		if i == 0 {
+			namespace, element = partNamespace, localName(part.Element)
+		}
+	}
+	return namespace, element, nil
+}